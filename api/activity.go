@@ -0,0 +1,133 @@
+package api
+
+import (
+	"database/sql"
+	"math"
+	"strings"
+	"time"
+)
+
+// HourActivity 是一周中某一天某个小时的在线人数统计，Weekday 以周日为 0
+type HourActivity struct {
+	Weekday time.Weekday `json:"weekday"`
+	Hour    int          `json:"hour"`
+	Average float64      `json:"average"`
+	Peak    int          `json:"peak"`
+	// Samples 为该时段内服务器在线时的记录条数，为 0 表示没有数据
+	Samples int `json:"samples"`
+}
+
+// DayActivity 是某一天的在线人数统计，Unique 为当天出现过的不同玩家数
+type DayActivity struct {
+	Date    string  `json:"date"`
+	Average float64 `json:"average"`
+	Peak    int     `json:"peak"`
+	Unique  int     `json:"unique"`
+	Samples int     `json:"samples"`
+}
+
+// Activity 是一段时间内按星期 × 小时以及按日汇总的在线人数，时间均按 Timezone 划分
+type Activity struct {
+	Timezone string         `json:"timezone"`
+	Since    time.Time      `json:"since"`
+	Until    time.Time      `json:"until"`
+	Heatmap  []HourActivity `json:"heatmap"`
+	Daily    []DayActivity  `json:"daily"`
+}
+
+// activityCounter 累计一个时段内的在线人数
+type activityCounter struct {
+	total   int
+	peak    int
+	samples int
+}
+
+func (c *activityCounter) add(players int) {
+	c.total += players
+	c.samples++
+	if players > c.peak {
+		c.peak = players
+	}
+}
+
+func (c *activityCounter) average() float64 {
+	if c.samples == 0 {
+		return 0
+	}
+	return math.Round(float64(c.total)/float64(c.samples)*100) / 100
+}
+
+// getActivity 统计 since 到 until 之间的在线人数分布，只计入服务器在线（含 degraded）时的记录，
+// 离线期间既不算作 0 人也不计入样本数
+func getActivity(database *sql.DB, server string, since, until time.Time, location *time.Location) (Activity, error) {
+	activity := Activity{
+		Timezone: location.String(),
+		Since:    since.In(location),
+		Until:    until.In(location),
+		Heatmap:  make([]HourActivity, 0, 7*24),
+		Daily:    []DayActivity{},
+	}
+
+	rows, err := database.Query(`SELECT time_index, online_player, COALESCE(player_list, '') FROM data
+		WHERE server = ? AND time_index >= ? AND time_index <= ? AND `+statusColumn+` IN (?, ?)
+		ORDER BY time_index ASC`,
+		server, since.Format("2006-01-02 15:04:05"), until.Format("2006-01-02 15:04:05"), statusOnline, statusDegraded)
+	if err != nil {
+		return activity, err
+	}
+	defer rows.Close()
+
+	var hours [7][24]activityCounter
+	var days []string
+	daily := map[string]*activityCounter{}
+	unique := map[string]map[string]bool{}
+	for rows.Next() {
+		var t time.Time
+		var players int
+		var playerList string
+		if err := rows.Scan(&t, &players, &playerList); err != nil {
+			return activity, err
+		}
+		t = localTime(t).In(location)
+		hours[t.Weekday()][t.Hour()].add(players)
+
+		date := t.Format("2006-01-02")
+		if daily[date] == nil {
+			days = append(days, date)
+			daily[date] = &activityCounter{}
+			unique[date] = map[string]bool{}
+		}
+		daily[date].add(players)
+		if playerList != "" {
+			for _, player := range strings.Split(playerList, ",") {
+				unique[date][player] = true
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return activity, err
+	}
+
+	for weekday := range hours {
+		for hour, counter := range hours[weekday] {
+			activity.Heatmap = append(activity.Heatmap, HourActivity{
+				Weekday: time.Weekday(weekday),
+				Hour:    hour,
+				Average: counter.average(),
+				Peak:    counter.peak,
+				Samples: counter.samples,
+			})
+		}
+	}
+	for _, date := range days {
+		counter := daily[date]
+		activity.Daily = append(activity.Daily, DayActivity{
+			Date:    date,
+			Average: counter.average(),
+			Peak:    counter.peak,
+			Unique:  len(unique[date]),
+			Samples: counter.samples,
+		})
+	}
+	return activity, nil
+}
@@ -0,0 +1,537 @@
+package api
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/MeowLynxSea/Uptimeow/config"
+	"github.com/MeowLynxSea/Uptimeow/internal/notify"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// adminMux 分发已通过认证的管理接口请求
+var adminMux = http.NewServeMux()
+
+func init() {
+	adminMux.HandleFunc("POST /api/admin/incidents", createIncidentHandler)
+	adminMux.HandleFunc("PATCH /api/admin/incidents/{id}", editIncidentHandler)
+	adminMux.HandleFunc("POST /api/admin/incidents/{id}/updates", addIncidentUpdateHandler)
+	adminMux.HandleFunc("POST /api/admin/incidents/{id}/resolve", resolveIncidentHandler)
+	adminMux.HandleFunc("GET /api/admin/notifications", listNotificationsHandler)
+	adminMux.HandleFunc("POST /api/admin/notifications/test", testNotificationHandler)
+	adminMux.HandleFunc("GET /api/admin/silences", listSilencesHandler)
+	adminMux.HandleFunc("POST /api/admin/silences", createSilenceHandler)
+	adminMux.HandleFunc("DELETE /api/admin/silences/{id}", expireSilenceHandler)
+}
+
+// AdminHandler 处理 /api/admin/ 下的管理接口，请求需在 Authorization 头中携带 Bearer 令牌
+func AdminHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	token := GlobalConfig.Admin.Token
+	if token == "" {
+		http.Error(w, "Admin API disabled", http.StatusNotFound)
+		return
+	}
+	provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	adminMux.ServeHTTP(w, r)
+}
+
+// incidentRequest 是创建或修改事件的请求体，修改时为空的字段保持不变
+type incidentRequest struct {
+	Title    string   `json:"title"`
+	Severity string   `json:"severity"`
+	Servers  []string `json:"servers"`
+	// Message 为 Markdown 格式的说明，创建时作为时间线的第一条记录
+	Message string `json:"message"`
+	// Broadcast 表示同时通过已配置的通知渠道推送
+	Broadcast bool `json:"broadcast"`
+}
+
+// validate 检查严重程度与服务器 ID
+func (req incidentRequest) validate() (string, bool) {
+	switch req.Severity {
+	case "", config.SeverityInfo, config.SeverityWarning, config.SeverityCritical:
+	default:
+		return "Invalid severity", false
+	}
+	for _, server := range req.Servers {
+		if _, ok := GlobalConfig.Server(server); !ok {
+			return "Unknown server " + server, false
+		}
+	}
+	return "", true
+}
+
+// createIncidentHandler 发布一个事件，severity 缺省为 warning，servers 为空表示影响所有服务器
+func createIncidentHandler(w http.ResponseWriter, r *http.Request) {
+	var req incidentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Title == "" {
+		http.Error(w, "Missing title", http.StatusBadRequest)
+		return
+	}
+	if message, ok := req.validate(); !ok {
+		http.Error(w, message, http.StatusBadRequest)
+		return
+	}
+	if req.Severity == "" {
+		req.Severity = config.SeverityWarning
+	}
+
+	now := time.Now().Format("2006-01-02 15:04:05")
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	result, err := tx.Exec("INSERT INTO incidents (server, type, title, severity, started_at) VALUES ('', ?, ?, ?, ?)",
+		incidentManual, req.Title, req.Severity, now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	id, _ := result.LastInsertId()
+	if err := setIncidentServers(tx, id, req.Servers); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := insertIncidentUpdate(tx, id, updateOpened, req.Message, now); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if req.Broadcast {
+		broadcastIncident(id, "【公告】", req.Message)
+	}
+	writeIncident(w, id)
+}
+
+// editIncidentHandler 修改管理员发布的事件的标题、严重程度或受影响的服务器
+func editIncidentHandler(w http.ResponseWriter, r *http.Request) {
+	incident, ok := lookupIncident(w, r)
+	if !ok {
+		return
+	}
+	if incident.Type != incidentManual {
+		http.Error(w, "Only manual incidents can be edited", http.StatusConflict)
+		return
+	}
+	var req incidentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if message, ok := req.validate(); !ok {
+		http.Error(w, message, http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	if req.Title != "" {
+		_, err = tx.Exec("UPDATE incidents SET title = ? WHERE id = ?", req.Title, incident.ID)
+	}
+	if err == nil && req.Severity != "" {
+		_, err = tx.Exec("UPDATE incidents SET severity = ? WHERE id = ?", req.Severity, incident.ID)
+	}
+	if err == nil && req.Servers != nil {
+		err = setIncidentServers(tx, incident.ID, req.Servers)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeIncident(w, incident.ID)
+}
+
+// addIncidentUpdateHandler 在事件的时间线上发布一条进展，自动记录的事件也可以补充说明
+func addIncidentUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	incident, ok := lookupIncident(w, r)
+	if !ok {
+		return
+	}
+	var req incidentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Message == "" {
+		http.Error(w, "Missing message", http.StatusBadRequest)
+		return
+	}
+	if err := insertIncidentUpdate(db, incident.ID, updateManual, req.Message, time.Now().Format("2006-01-02 15:04:05")); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if req.Broadcast {
+		broadcastIncident(incident.ID, "【进展】", req.Message)
+	}
+	writeIncident(w, incident.ID)
+}
+
+// resolveIncidentHandler 结束管理员发布的事件，自动记录的事件由监控在恢复时结束
+func resolveIncidentHandler(w http.ResponseWriter, r *http.Request) {
+	incident, ok := lookupIncident(w, r)
+	if !ok {
+		return
+	}
+	if incident.Type != incidentManual {
+		http.Error(w, "Only manual incidents can be resolved", http.StatusConflict)
+		return
+	}
+	if incident.Status == incidentResolved {
+		http.Error(w, "Incident already resolved", http.StatusConflict)
+		return
+	}
+	// 请求体可以省略
+	var req incidentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().Format("2006-01-02 15:04:05")
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec("UPDATE incidents SET resolved_at = ? WHERE id = ?", now, incident.ID)
+	if err == nil {
+		err = insertIncidentUpdate(tx, incident.ID, updateResolved, req.Message, now)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if req.Broadcast {
+		broadcastIncident(incident.ID, "【已解决】", req.Message)
+	}
+	writeIncident(w, incident.ID)
+}
+
+// lookupIncident 根据路径中的 id 查找事件，找不到时写入错误响应
+func lookupIncident(w http.ResponseWriter, r *http.Request) (Incident, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return Incident{}, false
+	}
+	incident, err := getIncident(db, id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Unknown incident", http.StatusNotFound)
+		return incident, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return incident, false
+	}
+	return incident, true
+}
+
+// writeIncident 返回事件的最新内容
+func writeIncident(w http.ResponseWriter, id int64) {
+	incident, err := getIncident(db, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeResponse(w, incident)
+}
+
+// setIncidentServers 替换事件影响的服务器
+func setIncidentServers(database execer, id int64, servers []string) error {
+	if _, err := database.Exec("DELETE FROM incident_servers WHERE incident_id = ?", id); err != nil {
+		return err
+	}
+	for _, server := range servers {
+		if _, err := database.Exec("INSERT INTO incident_servers (incident_id, server) VALUES (?, ?)", id, server); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// broadcastIncident 通过通知渠道推送事件的进展，推送成功时记录在时间线上
+func broadcastIncident(id int64, prefix, message string) {
+	incident, err := getIncident(db, id)
+	if err != nil {
+		return
+	}
+	servers := "全部服务器"
+	if len(incident.Servers) > 0 {
+		names := make([]string, 0, len(incident.Servers))
+		for _, id := range incident.Servers {
+			server, _ := GlobalConfig.Server(id)
+			names = append(names, server.ServerInfo.Name)
+		}
+		servers = strings.Join(names, "、")
+	}
+	body := "影响范围：" + servers + "\n"
+	if message != "" {
+		body += message + "\n"
+	}
+	now := time.Now()
+	sendNotification(notify.Message{
+		Kind:     notify.KindAnnouncement,
+		Severity: incident.Severity,
+		Title:    prefix + incident.Title,
+		Body:     body + "时间：" + now.Format("2006-01-02 15:04:05"),
+		Servers:  incident.Servers,
+		Time:     now,
+	}, "", func(delivered []string) {
+		insertIncidentUpdate(db, id, updateNotification, deliveredNote(delivered, prefix+incident.Title), now.Format("2006-01-02 15:04:05"))
+	})
+}
+
+// listNotificationsHandler 查询通知日志，可按渠道（channel）与推送结果（status 为 sent 或 failed）筛选，
+// since 的格式为 2006/01/02 15:04:05
+func listNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := notificationFilter{channel: query.Get("channel")}
+	switch query.Get("status") {
+	case "":
+	case "sent", "failed":
+		failed := query.Get("status") == "failed"
+		filter.failed = &failed
+	default:
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+	if param := query.Get("since"); param != "" {
+		since, err := time.ParseInLocation("2006/01/02 15:04:05", param, time.Local)
+		if err != nil {
+			http.Error(w, "Invalid since", http.StatusBadRequest)
+			return
+		}
+		filter.since = since
+	}
+	limit, ok := parseLimit(query.Get("limit"), 50, 500)
+	if !ok {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+	filter.limit = limit
+
+	notifications, err := listNotifications(db, filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeResponse(w, notifications)
+}
+
+// testNotificationHandler 向指定渠道推送一条测试消息，不受渠道的严重程度与服务器设置限制，用于检查渠道配置
+func testNotificationHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Channel string `json:"channel"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	for _, channel := range notificationChannels {
+		if channel.Name != req.Channel {
+			continue
+		}
+		now := time.Now()
+		msg := notify.Message{
+			Kind:     notify.KindSystem,
+			Severity: config.SeverityInfo,
+			Title:    "【测试】Uptimeow 通知渠道测试",
+			Body:     "渠道：" + channel.Name + "（" + channel.Type + "）\n时间：" + now.Format("2006-01-02 15:04:05"),
+			Servers:  []string{},
+			Time:     now,
+		}
+		err := deliver(channel, msg)
+		result := Notification{Time: now, Channel: channel.Name, Kind: msg.Kind, Severity: msg.Severity, Servers: msg.Servers, Title: msg.Title, Success: err == nil}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		writeResponse(w, result)
+		return
+	}
+	http.Error(w, "Unknown channel", http.StatusNotFound)
+}
+
+// silenceRequest 是创建静默的请求体，starts_at 与 ends_at 的格式为 2006/01/02 15:04:05；
+// starts_at 缺省为当前时间，未指定 ends_at 时以 duration（例如 2h）计算结束时间
+type silenceRequest struct {
+	Servers    []string `json:"servers"`
+	Rules      []string `json:"rules"`
+	Severities []string `json:"severities"`
+	Comment    string   `json:"comment"`
+	StartsAt   string   `json:"starts_at"`
+	EndsAt     string   `json:"ends_at"`
+	Duration   string   `json:"duration"`
+}
+
+// validate 检查匹配条件并计算静默的起止时间
+func (req silenceRequest) validate(now time.Time) (Silence, string, bool) {
+	silence := Silence{Servers: req.Servers, Rules: req.Rules, Severities: req.Severities, Comment: req.Comment, CreatedAt: now, StartsAt: now}
+	if len(req.Servers) == 0 && len(req.Rules) == 0 && len(req.Severities) == 0 {
+		return silence, "At least one of servers, rules and severities is required", false
+	}
+	for _, server := range req.Servers {
+		if _, ok := GlobalConfig.Server(server); !ok {
+			return silence, "Unknown server " + server, false
+		}
+	}
+	for _, rule := range req.Rules {
+		known := false
+		for _, server := range GlobalConfig.Servers {
+			for _, serverRule := range server.Rules {
+				known = known || serverRule.Name == rule
+			}
+		}
+		if !known {
+			return silence, "Unknown rule " + rule, false
+		}
+	}
+	for _, severity := range req.Severities {
+		switch severity {
+		case config.SeverityInfo, config.SeverityWarning, config.SeverityCritical:
+		default:
+			return silence, "Invalid severity", false
+		}
+	}
+	for _, list := range []*[]string{&silence.Servers, &silence.Rules, &silence.Severities} {
+		if *list == nil {
+			*list = []string{}
+		}
+	}
+
+	if req.StartsAt != "" {
+		startsAt, err := time.ParseInLocation("2006/01/02 15:04:05", req.StartsAt, time.Local)
+		if err != nil {
+			return silence, "Invalid starts_at", false
+		}
+		silence.StartsAt = startsAt
+	}
+	switch {
+	case req.EndsAt != "":
+		endsAt, err := time.ParseInLocation("2006/01/02 15:04:05", req.EndsAt, time.Local)
+		if err != nil {
+			return silence, "Invalid ends_at", false
+		}
+		silence.EndsAt = endsAt
+	case req.Duration != "":
+		duration, err := time.ParseDuration(req.Duration)
+		if err != nil || duration <= 0 {
+			return silence, "Invalid duration", false
+		}
+		silence.EndsAt = silence.StartsAt.Add(duration)
+	default:
+		return silence, "Missing ends_at or duration", false
+	}
+	if !silence.EndsAt.After(silence.StartsAt) || !silence.EndsAt.After(now) {
+		return silence, "Silence ends before it starts or has already ended", false
+	}
+	return silence, "", true
+}
+
+// listSilencesHandler 返回尚未结束的静默，all=true 时同时返回已结束的静默
+func listSilencesHandler(w http.ResponseWriter, r *http.Request) {
+	result, err := listSilences(db, r.URL.Query().Get("all") == "true")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeResponse(w, result)
+}
+
+// createSilenceHandler 创建一个静默，生效期间匹配的告警、重复提醒与升级均不推送
+func createSilenceHandler(w http.ResponseWriter, r *http.Request) {
+	var req silenceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	// 数据库中的时间精确到秒
+	silence, message, ok := req.validate(time.Now().Truncate(time.Second))
+	if !ok {
+		http.Error(w, message, http.StatusBadRequest)
+		return
+	}
+	id, err := insertSilence(db, silence)
+	if err == nil {
+		err = loadSilences(db)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	silence.ID = id
+	log.Println("[INFO] 已创建静默 #" + strconv.FormatInt(id, 10) + "，至 " + silence.EndsAt.Format("2006-01-02 15:04:05"))
+	writeResponse(w, silence)
+}
+
+// expireSilenceHandler 立即结束一个静默，尚未开始的静默同样不再生效
+func expireSilenceHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+	silence, err := getSilence(db, id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Unknown silence", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	now := time.Now().Truncate(time.Second)
+	if !silence.EndsAt.After(now) {
+		http.Error(w, "Silence already ended", http.StatusConflict)
+		return
+	}
+	if silence.StartsAt.After(now) {
+		silence.StartsAt = now
+	}
+	silence.EndsAt = now
+	_, err = db.Exec("UPDATE silences SET starts_at = ?, ends_at = ? WHERE id = ?",
+		silence.StartsAt.Format("2006-01-02 15:04:05"), now.Format("2006-01-02 15:04:05"), id)
+	if err == nil {
+		err = loadSilences(db)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Println("[INFO] 已结束静默 #" + strconv.FormatInt(id, 10))
+	writeResponse(w, silence)
+}
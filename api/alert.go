@@ -0,0 +1,342 @@
+package api
+
+import (
+	"fmt"
+	"github.com/MeowLynxSea/Uptimeow/config"
+	"github.com/MeowLynxSea/Uptimeow/internal/notify"
+	"log"
+	"math"
+	"strconv"
+	"time"
+)
+
+// alertState 是一条告警规则在一台服务器上的状态，各规则互不影响
+type alertState struct {
+	firing bool
+	// since 为下一次状态变化所需的条件（未告警时为告警条件，告警时为恢复条件）开始持续成立的时间，不成立时为零值
+	since time.Time
+	// samples 为该条件连续成立的检查次数
+	samples int
+	// changes 为抖动检测窗口内告警与恢复的时间
+	changes []time.Time
+	// flapping 表示告警正在抖动，期间不推送消息，事件保持进行
+	flapping bool
+	// silenced 表示告警发生在维护或静默期间，没有推送；维护或静默结束时仍在告警则补推，期间恢复则不推送恢复
+	silenced bool
+}
+
+// alertMetric 是可用于告警规则的数值指标，value 在指标暂时无法获得时返回 false
+type alertMetric struct {
+	name  string
+	unit  string
+	value func(live LiveState) (float64, bool)
+}
+
+// alertMetrics 为数值指标，status 指标比较的是服务器状态，单独处理
+var alertMetrics = map[string]alertMetric{
+	"tps": {"TPS", "", func(live LiveState) (float64, bool) {
+		// TPS 为 0 表示尚未收到数据
+		return live.Tps, live.IsOnline && live.Tps != 0
+	}},
+	"mspt": {"平均tick耗时", "ms", func(live LiveState) (float64, bool) {
+		if !live.IsOnline || live.Mspt == nil {
+			return 0, false
+		}
+		return live.Mspt.Avg, true
+	}},
+	"mspt_max": {"最大tick耗时", "ms", func(live LiveState) (float64, bool) {
+		if !live.IsOnline || live.Mspt == nil {
+			return 0, false
+		}
+		return live.Mspt.Max, true
+	}},
+	"players": {"在线人数", "", func(live LiveState) (float64, bool) {
+		return float64(live.OnlinePlayer), live.IsOnline
+	}},
+	"latency": {"延迟", "ms", func(live LiveState) (float64, bool) {
+		// 延迟为 0 表示没有启用能测量延迟的探测方式
+		return float64(live.Latency), live.IsOnline && live.Latency > 0
+	}},
+	"memory_used": {"已用内存", "MB", func(live LiveState) (float64, bool) {
+		if !live.IsOnline || live.Memory == nil {
+			return 0, false
+		}
+		return float64(live.Memory.Used), true
+	}},
+	"memory_percent": {"内存占用率", "%", func(live LiveState) (float64, bool) {
+		if !live.IsOnline || live.Memory == nil || live.Memory.Max <= 0 {
+			return 0, false
+		}
+		return math.Round(float64(live.Memory.Used)/float64(live.Memory.Max)*10000) / 100, true
+	}},
+}
+
+// opNames 是比较方式在消息中的说法
+var opNames = map[string]string{"<": "低于", "<=": "不高于", ">": "高于", ">=": "不低于", "==": "等于", "!=": "不等于"}
+
+// validateAlertRules 检查各服务器告警规则使用的指标是否存在
+func validateAlertRules(servers []config.ServerConfig) error {
+	for _, server := range servers {
+		for _, rule := range server.Rules {
+			if _, ok := alertMetrics[rule.Metric]; !ok && rule.Metric != "status" {
+				return fmt.Errorf("alert rule %q: unknown metric %q", rule.Name, rule.Metric)
+			}
+		}
+	}
+	return nil
+}
+
+// evaluate 判断条件是否满足，指标暂时无法获得时 known 为 false；
+// status 指标在 unreachable 时视为无法获得，因为此时尚未确认服务器是否离线
+func evaluate(metric string, condition config.AlertCondition, live LiveState) (matched, known bool) {
+	if metric == "status" {
+		if live.Status == statusUnreachable {
+			return false, false
+		}
+		if condition.Op == "!=" {
+			return live.Status != condition.Value, true
+		}
+		return live.Status == condition.Value, true
+	}
+
+	value, ok := alertMetrics[metric].value(live)
+	if !ok {
+		return false, false
+	}
+	switch condition.Op {
+	case "<":
+		return value < condition.Threshold, true
+	case "<=":
+		return value <= condition.Threshold, true
+	case ">":
+		return value > condition.Threshold, true
+	case ">=":
+		return value >= condition.Threshold, true
+	case "!=":
+		return value != condition.Threshold, true
+	default:
+		return value == condition.Threshold, true
+	}
+}
+
+// checkAlerts 依次推进服务器的各条告警规则，在规则告警或恢复时开始或结束对应的事件并推送消息
+func checkAlerts(state *serverState, live LiveState, currentTime time.Time) {
+	for _, rule := range state.server.Rules {
+		rule = networkRule(state.server.ID, rule)
+		alert, ok := state.alerts[rule.Name]
+		if !ok {
+			alert = &alertState{}
+			state.alerts[rule.Name] = alert
+		}
+		if alert.flapping && currentTime.Sub(alert.changes[len(alert.changes)-1]) >= rule.Flapping.Window {
+			endFlapping(state, rule, alert, live, currentTime)
+		}
+		if alert.silenced && alert.firing && !alert.flapping && suppression(state.server, rule.Name, rule.Severity, currentTime) == "" {
+			unsilenceAlert(state, rule, alert, live, currentTime)
+		}
+
+		// 告警时检查恢复条件，未配置时以告警条件不再满足为恢复条件，无需持续
+		condition, negate := rule.AlertCondition, false
+		if alert.firing {
+			if rule.Recover != nil {
+				condition = *rule.Recover
+			} else {
+				condition, negate = config.AlertCondition{Op: rule.Op, Threshold: rule.Threshold, Value: rule.Value}, true
+			}
+		}
+		matched, known := evaluate(rule.Metric, condition, live)
+		if !known || matched == negate {
+			alert.since, alert.samples = time.Time{}, 0
+			continue
+		}
+		if alert.since.IsZero() {
+			alert.since = currentTime
+		}
+		alert.samples++
+		if currentTime.Sub(alert.since) < condition.For || alert.samples < condition.Samples {
+			continue
+		}
+
+		alert.since, alert.samples = time.Time{}, 0
+		alert.firing = !alert.firing
+		if alert.recordChange(rule, currentTime) {
+			startFlapping(state, rule, alert, live, currentTime)
+			continue
+		}
+		if alert.flapping {
+			continue
+		}
+		if alert.firing {
+			fireAlert(state, rule, alert, live, currentTime)
+		} else {
+			recoverAlert(state, rule, alert, live, currentTime)
+		}
+	}
+}
+
+// recordChange 记录一次告警或恢复，在开始抖动时返回 true
+func (a *alertState) recordChange(rule config.AlertRule, at time.Time) bool {
+	if rule.Flapping == nil || rule.Flapping.Changes == 0 {
+		return false
+	}
+	a.changes = append(a.changes, at)
+	for len(a.changes) > 0 && at.Sub(a.changes[0]) > rule.Flapping.Window {
+		a.changes = a.changes[1:]
+	}
+	if a.flapping || len(a.changes) <= rule.Flapping.Changes {
+		return false
+	}
+	a.flapping = true
+	return true
+}
+
+// openAlertIncident 开始规则对应的事件，返回告警条件与当前值的描述
+func openAlertIncident(state *serverState, rule config.AlertRule, live LiveState, currentTime time.Time) (string, string) {
+	value, _ := currentValue(rule.Metric, live)
+	condition := describeCondition(rule.Metric, rule.AlertCondition)
+	note, number := observation(rule.Metric, live)
+	state.openIncident(rule.Name, rule.Title, rule.Severity, condition+"，"+value, note, number, currentTime)
+	return condition, value
+}
+
+// fireAlert 开始规则对应的事件，并把告警加入分组等待推送；服务器处于维护或告警匹配静默时只记录事件
+func fireAlert(state *serverState, rule config.AlertRule, alert *alertState, live LiveState, currentTime time.Time) {
+	condition, value := openAlertIncident(state, rule, live, currentTime)
+	if reason := suppression(state.server, rule.Name, rule.Severity, currentTime); reason != "" {
+		silenceAlert(state, rule, alert, reason, currentTime)
+		return
+	}
+	queueAlert(state, rule, condition, value, currentTime)
+}
+
+// recoverAlert 把恢复加入告警所在的分组等待推送，并结束规则对应的事件；
+// 在维护或静默期间发生的告警没有推送，恢复时也不推送，已推送的告警在维护或静默期间恢复时照常推送
+func recoverAlert(state *serverState, rule config.AlertRule, alert *alertState, live LiveState, currentTime time.Time) {
+	value, _ := currentValue(rule.Metric, live)
+	if !alert.silenced {
+		queueRecovery(state, rule, value, currentTime)
+	}
+	alert.silenced = false
+	state.resolveIncident(rule.Name, "已恢复，"+value, currentTime)
+}
+
+// silenceAlert 标记告警因维护或静默没有推送，并记录在事件时间线上
+func silenceAlert(state *serverState, rule config.AlertRule, alert *alertState, reason string, currentTime time.Time) {
+	alert.silenced = true
+	state.addIncidentUpdate(rule.Name, updateObservation, "不推送通知："+reason, currentTime)
+}
+
+// unsilenceAlert 在维护或静默结束后告警仍未恢复时，把告警加入分组补推
+func unsilenceAlert(state *serverState, rule config.AlertRule, alert *alertState, live LiveState, currentTime time.Time) {
+	alert.silenced = false
+	value, _ := currentValue(rule.Metric, live)
+	state.addIncidentUpdate(rule.Name, updateObservation, "维护或静默已结束，仍在告警，"+value, currentTime)
+	queueAlert(state, rule, describeCondition(rule.Metric, rule.AlertCondition), value, currentTime)
+}
+
+// startFlapping 在告警开始抖动时保持事件进行、把告警移出分组，并推送一条抖动通知代替之后的告警与恢复
+func startFlapping(state *serverState, rule config.AlertRule, alert *alertState, live LiveState, currentTime time.Time) {
+	if alert.firing {
+		openAlertIncident(state, rule, live, currentTime)
+	}
+	dropAlert(state, rule)
+	value, _ := currentValue(rule.Metric, live)
+	text := rule.Flapping.Window.String() + " 内告警与恢复 " + strconv.Itoa(len(alert.changes)) + " 次，暂停推送，状态稳定 " + rule.Flapping.Window.String() + " 后恢复推送"
+	state.addIncidentUpdate(rule.Name, updateObservation, "状态抖动："+text, currentTime)
+	notifyFlapping(state, rule, notify.KindAlert, "【抖动】"+rule.Title+"反复告警与恢复", text+"\n"+value, currentTime)
+}
+
+// endFlapping 在告警稳定一个检测窗口后结束抖动：仍在告警时重新加入分组，之后照常推送恢复、重复提醒与升级；已恢复时结束事件
+func endFlapping(state *serverState, rule config.AlertRule, alert *alertState, live LiveState, currentTime time.Time) {
+	alert.flapping, alert.changes, alert.silenced = false, nil, false
+	value, _ := currentValue(rule.Metric, live)
+	if alert.firing {
+		if reason := suppression(state.server, rule.Name, rule.Severity, currentTime); reason != "" {
+			state.addIncidentUpdate(rule.Name, updateObservation, "抖动结束，仍在告警，"+value, currentTime)
+			silenceAlert(state, rule, alert, reason, currentTime)
+			return
+		}
+		condition := describeCondition(rule.Metric, rule.AlertCondition)
+		requeueAlert(state, rule, condition, value, currentTime)
+		state.addIncidentUpdate(rule.Name, updateObservation, "抖动结束，仍在告警，"+value, currentTime)
+		notifyFlapping(state, rule, notify.KindAlert, severityPrefix[rule.Severity]+rule.Title+"抖动结束，仍在告警", condition+"\n"+value, currentTime)
+		return
+	}
+	notifyFlapping(state, rule, notify.KindRecovery, "【恢复】"+rule.Title+"抖动结束，已恢复", value, currentTime)
+	state.resolveIncident(rule.Name, "抖动结束，已恢复，"+value, currentTime)
+}
+
+// notifyFlapping 立即推送抖动通知，推送成功时记录在事件时间线上；维护或静默期间不推送
+func notifyFlapping(state *serverState, rule config.AlertRule, kind, title, body string, currentTime time.Time) {
+	if suppression(state.server, rule.Name, rule.Severity, currentTime) != "" {
+		return
+	}
+	// 推送在队列中完成，事件可能在此之前结束，因此先取出事件 ID
+	var incident int64
+	if open, ok := state.incidents[rule.Name]; ok {
+		incident = open.id
+	}
+	sendNotification(notify.Message{
+		Kind:     kind,
+		Severity: rule.Severity,
+		Title:    title,
+		Body:     "服务器：" + state.server.ServerInfo.Name + "\n" + body + "\n时间：" + currentTime.Format("2006-01-02 15:04:05"),
+		Servers:  []string{state.server.ID},
+		Time:     currentTime,
+	}, rule.Name, func(delivered []string) {
+		if incident == 0 {
+			return
+		}
+		if err := insertIncidentUpdate(db, incident, updateNotification, deliveredNote(delivered, title), currentTime.Format("2006-01-02 15:04:05")); err != nil {
+			log.Println("[ERROR] ["+state.server.ID+"] Failed to add incident update: ", err)
+		}
+	})
+}
+
+// describeCondition 以文字描述条件，例如 "TPS低于设定值(18.00)，持续30s"
+func describeCondition(metric string, condition config.AlertCondition) string {
+	var text string
+	if metric == "status" {
+		text = "状态" + opNames[condition.Op] + " " + condition.Value
+	} else {
+		m := alertMetrics[metric]
+		text = m.name + opNames[condition.Op] + "设定值(" + strconv.FormatFloat(condition.Threshold, 'f', 2, 64) + m.unit + ")"
+	}
+	if condition.For > 0 {
+		text += "，持续" + condition.For.String()
+	}
+	if condition.Samples > 1 {
+		text += "，连续" + strconv.Itoa(condition.Samples) + "次"
+	}
+	return text
+}
+
+// currentValue 以文字描述指标的当前值，status 指标附带原因
+func currentValue(metric string, live LiveState) (string, bool) {
+	if metric == "status" {
+		text := "当前状态：" + live.Status
+		if live.Reason != "" {
+			text += "\n原因：" + live.Reason
+		}
+		return text, true
+	}
+	m := alertMetrics[metric]
+	value, ok := m.value(live)
+	if !ok {
+		return "当前" + m.name + "：无数据", false
+	}
+	return "当前" + m.name + "：" + strconv.FormatFloat(value, 'f', 2, 64) + m.unit, true
+}
+
+// observation 返回用于判断事件期间是否出现变化的状态与数值，见 observeIncidents
+func observation(metric string, live LiveState) (string, float64) {
+	if metric == "status" {
+		// 探测失败的原因中常含有随机的本地端口等信息，因此只比较状态，degraded 时再比较原因类别
+		if live.Status == statusDegraded {
+			return live.Status + "：" + reasonCategory(live.Reason), 0
+		}
+		return live.Status, 0
+	}
+	value, _ := alertMetrics[metric].value(live)
+	return "", value
+}
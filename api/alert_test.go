@@ -0,0 +1,307 @@
+package api
+
+import (
+	"github.com/MeowLynxSea/Uptimeow/config"
+	"github.com/MeowLynxSea/Uptimeow/internal/collector"
+	"slices"
+	"testing"
+	"time"
+)
+
+// tickAlerts 与 saveCron 一样检查一台服务器的告警并推送分组，返回推送的消息，见 sentMessages
+func tickAlerts(state *serverState, queue chan notificationJob, now time.Time, live LiveState) []string {
+	checkAlerts(state, live, now)
+	flushAlertGroups(now)
+	return sentMessages(queue)
+}
+
+func withTPS(tps float64) LiveState {
+	return LiveState{IsOnline: true, Status: statusOnline, Tps: tps}
+}
+
+func TestRecordChange(t *testing.T) {
+	detection := &config.FlapDetection{Changes: 3, Window: 10 * time.Minute}
+	tests := []struct {
+		name     string
+		flapping *config.FlapDetection
+		changes  []time.Duration
+		// started 为开始抖动的那次变化的序号，-1 表示没有开始抖动
+		started int
+		// kept 为最后一次变化后窗口内记录的变化次数
+		kept int
+	}{
+		{"disabled", &config.FlapDetection{}, []time.Duration{0, time.Minute, 2 * time.Minute, 3 * time.Minute, 4 * time.Minute}, -1, 0},
+		{"within window", detection, []time.Duration{0, time.Minute, 2 * time.Minute, 3 * time.Minute}, 3, 4},
+		{"at threshold", detection, []time.Duration{0, time.Minute, 2 * time.Minute}, -1, 3},
+		{"spread out", detection, []time.Duration{0, 6 * time.Minute, 12 * time.Minute, 18 * time.Minute, 24 * time.Minute}, -1, 2},
+		{"window edge", detection, []time.Duration{0, 4 * time.Minute, 8 * time.Minute, 10 * time.Minute}, 3, 4},
+		{"started once", detection, []time.Duration{0, time.Minute, 2 * time.Minute, 3 * time.Minute, 4 * time.Minute, 5 * time.Minute}, 3, 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := config.AlertRule{Name: "offline", Flapping: tt.flapping}
+			alert := &alertState{}
+			started := -1
+			for i, offset := range tt.changes {
+				if alert.recordChange(rule, at(offset)) {
+					if started >= 0 {
+						t.Errorf("change %d started flapping again", i)
+					}
+					started = i
+				}
+			}
+			if started != tt.started || len(alert.changes) != tt.kept || alert.flapping != (tt.started >= 0) {
+				t.Errorf("got started at %d with %d changes kept (flapping %v), want %d with %d",
+					started, len(alert.changes), alert.flapping, tt.started, tt.kept)
+			}
+		})
+	}
+}
+
+// alertStep 是一次检查时服务器的状态与期望推送的消息
+type alertStep struct {
+	at     time.Duration
+	status string
+	want   []string
+}
+
+// TestAlertFlapping 检查抖动期间只推送抖动通知，状态稳定一个窗口后结束抖动：仍在告警时重新加入分组照常提醒，已恢复时结束事件
+func TestAlertFlapping(t *testing.T) {
+	rules := config.WarnTypes{Offline: true}.Rules()
+	rules[0].Flapping = &config.FlapDetection{Changes: 2, Window: 5 * time.Minute}
+	flapping := []alertStep{
+		{0, statusOffline, []string{"ops 【紧急】服务器离线"}},
+		{10 * time.Second, statusOnline, []string{"ops 【恢复】服务器离线已恢复"}},
+		{20 * time.Second, statusOffline, []string{"ops 【抖动】服务器离线反复告警与恢复"}},
+		{30 * time.Second, statusOnline, nil},
+		{40 * time.Second, statusOffline, nil},
+	}
+	tests := []struct {
+		name string
+		end  []alertStep
+	}{
+		{"still firing", []alertStep{
+			{5*time.Minute + 30*time.Second, statusOffline, nil},
+			{5*time.Minute + 40*time.Second, statusOffline, []string{"ops 【紧急】服务器离线抖动结束，仍在告警"}},
+			{time.Hour + 5*time.Minute + 40*time.Second, statusOffline, []string{"ops 【未恢复】服务器离线仍未恢复"}},
+			{time.Hour + 6*time.Minute, statusOnline, []string{"ops 【恢复】服务器离线已恢复"}},
+		}},
+		{"recovered", []alertStep{
+			{time.Minute, statusOnline, nil},
+			{6 * time.Minute, statusOnline, []string{"ops 【恢复】服务器离线抖动结束，已恢复"}},
+			{time.Hour + 6*time.Minute, statusOnline, nil},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestDB(t)
+			queue := captureNotifications(t)
+			setRoute(t, config.Route{Receivers: []string{"ops"}, RepeatInterval: time.Hour})
+			state := testState("survival")
+			state.server.Rules = rules
+
+			for _, step := range slices.Concat(flapping, tt.end) {
+				got := tickAlerts(state, queue, at(step.at), withStatus(step.status))
+				if !slices.Equal(got, step.want) {
+					t.Errorf("%s: got %q, want %q", step.at, got, step.want)
+				}
+			}
+			if state.alerts["offline"].flapping {
+				t.Error("still flapping")
+			}
+			var incidents int
+			if err := db.QueryRow("SELECT COUNT(*) FROM incidents WHERE resolved_at IS NULL").Scan(&incidents); err != nil {
+				t.Fatal(err)
+			}
+			if incidents != 0 {
+				t.Errorf("got %d open incidents", incidents)
+			}
+		})
+	}
+}
+
+// TestRecoverThreshold 检查配置了恢复阈值时，指标在告警阈值与恢复阈值之间波动不会恢复
+func TestRecoverThreshold(t *testing.T) {
+	var warn config.WarnTypes
+	warn.LowTps.Enabled, warn.LowTps.Threold, warn.LowTps.RecoverThreshold = true, 18, 19.5
+	noRecover := warn
+	noRecover.LowTps.RecoverThreshold = 0
+
+	tests := []struct {
+		name string
+		warn config.WarnTypes
+		tps  []float64
+		want []bool
+	}{
+		{"hysteresis", warn, []float64{20, 17.9, 18.5, 19.4, 19.5, 18.1, 17}, []bool{false, true, true, true, false, false, true}},
+		{"no recover threshold", noRecover, []float64{20, 17.9, 18.5, 17.9, 18, 17.99}, []bool{false, true, false, true, false, true}},
+		// 无数据时保持当前状态
+		{"unknown", warn, []float64{17, 0, 19}, []bool{true, true, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestDB(t)
+			queue := captureNotifications(t)
+			setRoute(t, config.Route{Receivers: []string{"ops"}})
+			state := testState("survival")
+			state.server.Rules = tt.warn.Rules()
+
+			var got []bool
+			for i, tps := range tt.tps {
+				tickAlerts(state, queue, at(time.Duration(i)*10*time.Second), withTPS(tps))
+				got = append(got, state.alerts["low_tps"].firing)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestNetworkFlapping 检查群组服成员的离线告警同样经过抖动检测与告警条件的持续时长
+func TestNetworkFlapping(t *testing.T) {
+	useTestDB(t)
+	queue := captureNotifications(t)
+	setRoute(t, config.Route{Receivers: []string{"ops"}})
+	rules := config.WarnTypes{Offline: true}.Rules()
+	rules[0].For = 20 * time.Second
+	rules[0].Flapping = &config.FlapDetection{Changes: 2, Window: 5 * time.Minute}
+	members := setupNetwork(t, rules)
+
+	steps := []struct {
+		at       time.Duration
+		statuses map[string]string
+		want     []string
+	}{
+		// 持续不足 20 秒的离线不告警
+		{0, map[string]string{"lobby": statusOffline}, nil},
+		{10 * time.Second, nil, nil},
+		{20 * time.Second, map[string]string{"lobby": statusOffline}, nil},
+		{30 * time.Second, map[string]string{"lobby": statusOffline}, nil},
+		{40 * time.Second, map[string]string{"lobby": statusOffline}, []string{"ops 【警告】群组服 MeowNet 子服离线"}},
+		{50 * time.Second, nil, []string{"ops 【恢复】群组服 MeowNet 子服离线已恢复"}},
+		{time.Minute, map[string]string{"lobby": statusOffline}, nil},
+		{70 * time.Second, map[string]string{"lobby": statusOffline}, nil},
+		{80 * time.Second, map[string]string{"lobby": statusOffline}, []string{"ops 【抖动】群组服 MeowNet 子服离线反复告警与恢复"}},
+		{90 * time.Second, nil, nil},
+		{90*time.Second + 5*time.Minute, nil, []string{"ops 【恢复】群组服 MeowNet 子服离线抖动结束，已恢复"}},
+	}
+	for _, step := range steps {
+		got := tickNetwork(members, queue, at(step.at), step.statuses)
+		if !slices.Equal(got, step.want) {
+			t.Errorf("%s: got %q, want %q", step.at, got, step.want)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	mspt := &collector.TickTimes{Avg: 40, Max: 120}
+	tests := []struct {
+		metric    string
+		condition config.AlertCondition
+		live      LiveState
+		matched   bool
+		known     bool
+	}{
+		{"status", config.AlertCondition{Op: "==", Value: statusOffline}, withStatus(statusOffline), true, true},
+		{"status", config.AlertCondition{Op: "==", Value: statusOffline}, withStatus(statusOnline), false, true},
+		{"status", config.AlertCondition{Op: "!=", Value: statusOnline}, withStatus(statusDegraded), true, true},
+		// unreachable 时尚未确认是否离线
+		{"status", config.AlertCondition{Op: "==", Value: statusOffline}, withStatus(statusUnreachable), false, false},
+		{"tps", config.AlertCondition{Op: "<", Threshold: 18}, withTPS(17.5), true, true},
+		{"tps", config.AlertCondition{Op: "<", Threshold: 18}, withTPS(18), false, true},
+		{"tps", config.AlertCondition{Op: "<=", Threshold: 18}, withTPS(18), true, true},
+		// TPS 为 0 表示尚未收到数据
+		{"tps", config.AlertCondition{Op: "<", Threshold: 18}, withTPS(0), false, false},
+		{"tps", config.AlertCondition{Op: "<", Threshold: 18}, withStatus(statusOffline), false, false},
+		{"mspt", config.AlertCondition{Op: ">", Threshold: 50}, LiveState{IsOnline: true, Mspt: mspt}, false, true},
+		{"mspt_max", config.AlertCondition{Op: ">=", Threshold: 120}, LiveState{IsOnline: true, Mspt: mspt}, true, true},
+		{"mspt", config.AlertCondition{Op: ">", Threshold: 50}, LiveState{IsOnline: true}, false, false},
+		{"players", config.AlertCondition{Op: "==", Threshold: 0}, LiveState{IsOnline: true}, true, true},
+		{"players", config.AlertCondition{Op: "!=", Threshold: 0}, LiveState{IsOnline: true, OnlinePlayer: 3}, true, true},
+		{"latency", config.AlertCondition{Op: ">", Threshold: 200}, LiveState{IsOnline: true, Latency: 250}, true, true},
+		{"latency", config.AlertCondition{Op: ">", Threshold: 200}, LiveState{IsOnline: true}, false, false},
+		{"memory_percent", config.AlertCondition{Op: ">", Threshold: 90}, LiveState{IsOnline: true, Memory: &collector.MemorySample{Used: 3700, Max: 4096}}, true, true},
+		{"memory_percent", config.AlertCondition{Op: ">", Threshold: 90}, LiveState{IsOnline: true, Memory: &collector.MemorySample{Used: 3700}}, false, false},
+		{"memory_used", config.AlertCondition{Op: ">", Threshold: 4000}, LiveState{IsOnline: true, Memory: &collector.MemorySample{Used: 3700, Max: 4096}}, false, true},
+	}
+	for _, tt := range tests {
+		matched, known := evaluate(tt.metric, tt.condition, tt.live)
+		if matched != tt.matched || known != tt.known {
+			t.Errorf("%s %s %v%s: got %v, %v, want %v, %v", tt.metric, tt.condition.Op, tt.condition.Threshold, tt.condition.Value,
+				matched, known, tt.matched, tt.known)
+		}
+	}
+}
+
+// TestAlertForAndSamples 检查告警条件需持续 for 时长并连续成立 samples 次，中途不成立或无数据时重新计算
+func TestAlertForAndSamples(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition config.AlertCondition
+		tps       []float64
+		want      []bool
+	}{
+		{"immediate", config.AlertCondition{}, []float64{17, 19}, []bool{true, false}},
+		{"for", config.AlertCondition{For: 20 * time.Second}, []float64{17, 17, 17, 17}, []bool{false, false, true, true}},
+		{"for interrupted", config.AlertCondition{For: 20 * time.Second}, []float64{17, 17, 19, 17, 17, 17}, []bool{false, false, false, false, false, true}},
+		{"for reset by no data", config.AlertCondition{For: 20 * time.Second}, []float64{17, 0, 17, 17, 17}, []bool{false, false, false, false, true}},
+		{"samples", config.AlertCondition{Samples: 3}, []float64{17, 17, 17}, []bool{false, false, true}},
+		{"samples interrupted", config.AlertCondition{Samples: 3}, []float64{17, 17, 19, 17, 17, 17}, []bool{false, false, false, false, false, true}},
+		// 两者都需满足
+		{"for and samples", config.AlertCondition{For: 10 * time.Second, Samples: 3}, []float64{17, 17, 17}, []bool{false, false, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestDB(t)
+			captureNotifications(t)
+			setRoute(t, config.Route{})
+			rule := config.AlertRule{Name: "low_tps", Title: "TPS过低", Metric: "tps", Severity: config.SeverityWarning, AlertCondition: tt.condition}
+			rule.Op, rule.Threshold = "<", 18
+			state := testState("survival")
+			state.server.Rules = []config.AlertRule{rule}
+
+			var got []bool
+			for i, tps := range tt.tps {
+				checkAlerts(state, withTPS(tps), at(time.Duration(i)*10*time.Second))
+				got = append(got, state.alerts["low_tps"].firing)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestAlertRulesIndependent 检查同一服务器的各条规则互不影响，各自开始与结束事件
+func TestAlertRulesIndependent(t *testing.T) {
+	useTestDB(t)
+	queue := captureNotifications(t)
+	setRoute(t, config.Route{Receivers: []string{"ops"}, GroupBy: []string{"rule"}})
+	var warn config.WarnTypes
+	warn.Offline, warn.Degraded = true, true
+	warn.LowTps.Enabled, warn.LowTps.Threold = true, 18
+	state := testState("survival")
+	state.server.Rules = warn.Rules()
+
+	degraded := withTPS(17)
+	degraded.Status = statusDegraded
+	steps := []struct {
+		live LiveState
+		want []string
+	}{
+		{withTPS(20), nil},
+		{degraded, []string{"ops 【警告】TPS过低", "ops 【警告】服务器监控异常"}},
+		// 离线时 TPS 无数据，保持告警
+		{withStatus(statusOffline), []string{"ops 【紧急】服务器离线"}},
+		// degraded 需恢复 online 才恢复
+		{degraded, []string{"ops 【恢复】服务器离线已恢复"}},
+		{withTPS(20), []string{"ops 【恢复】TPS过低已恢复", "ops 【恢复】服务器监控异常已恢复"}},
+	}
+	for i, step := range steps {
+		got := tickAlerts(state, queue, at(time.Duration(i)*10*time.Second), step.live)
+		if !slices.Equal(got, step.want) {
+			t.Errorf("step %d: got %q, want %q", i, got, step.want)
+		}
+	}
+}
@@ -0,0 +1,377 @@
+package api
+
+import (
+	"github.com/MeowLynxSea/Uptimeow/config"
+	"github.com/MeowLynxSea/Uptimeow/internal/notify"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// groupedAlert 是分组中的一条告警，resolvedAt 为零值表示仍在告警
+type groupedAlert struct {
+	state *serverState
+	rule  config.AlertRule
+	// incident 为对应事件的 ID，推送后在事件时间线上记录，事件未能记录时为 0
+	incident int64
+	// condition 与 value 为告警条件与告警时的指标值，recovery 为恢复时的指标值
+	condition, value, recovery string
+	firedAt, resolvedAt        time.Time
+	// notified 表示告警消息已推送，未推送就恢复的告警直接从分组中移除
+	notified bool
+}
+
+// alertGroup 是一组合并推送的告警，同一组的告警、恢复、重复提醒与升级构成同一条消息线索
+type alertGroup struct {
+	route  *config.Route
+	alerts []*groupedAlert
+	// pendingSince 为最早一项尚未推送的变化（新告警或恢复）的时间，没有时为零值
+	pendingSince time.Time
+	// lastSent 为最近一次向 route.Receivers 推送的时间，用于重复提醒
+	lastSent time.Time
+	// escalated 为已触发的升级数量，升级后的渠道也会收到该组之后的消息
+	escalated int
+}
+
+// alertGroups 为进行中的告警分组，键为路由节点与分组依据的取值，只在 saveCron 中访问
+var alertGroups = map[string]*alertGroup{}
+
+// severityRank 用于选出一组告警中最高的严重程度
+var severityRank = map[string]int{config.SeverityInfo: 0, config.SeverityWarning: 1, config.SeverityCritical: 2}
+
+// severityPrefix 为告警消息标题的前缀
+var severityPrefix = map[string]string{config.SeverityCritical: "【紧急】", config.SeverityWarning: "【警告】", config.SeverityInfo: "【提示】"}
+
+// queueAlert 把告警加入其匹配的各路由节点的分组，在 flushAlertGroups 中推送
+func queueAlert(state *serverState, rule config.AlertRule, condition, value string, at time.Time) {
+	groupAlert(&groupedAlert{state: state, rule: rule, condition: condition, value: value, firedAt: at})
+}
+
+// requeueAlert 把抖动结束后仍在告警的告警重新加入分组，抖动通知已说明其状态，因此视为已推送
+func requeueAlert(state *serverState, rule config.AlertRule, condition, value string, at time.Time) {
+	groupAlert(&groupedAlert{state: state, rule: rule, condition: condition, value: value, firedAt: at, notified: true})
+}
+
+// groupAlert 把告警加入其匹配的各路由节点的分组，未推送的告警会让分组在等待 group_wait 后推送；
+// 各分组分别记录告警是否已推送，因此每个分组持有一份副本
+func groupAlert(alert *groupedAlert) {
+	state, rule := alert.state, alert.rule
+	if incident, ok := state.incidents[rule.Name]; ok {
+		alert.incident = incident.id
+	}
+	servers := []string{state.server.ID}
+	for _, matched := range matchRoutes(&GlobalConfig.Warn.Route, "root", servers, rule.Name, rule.Severity) {
+		key := matched.id
+		for _, label := range matched.route.GroupBy {
+			switch label {
+			case "server":
+				key += "|" + state.server.ID
+			case "rule":
+				key += "|" + rule.Name
+			case "severity":
+				key += "|" + rule.Severity
+			}
+		}
+		group, ok := alertGroups[key]
+		if !ok {
+			// 已推送的告警从加入分组时开始计算重复提醒
+			group = &alertGroup{route: matched.route, lastSent: alert.firedAt}
+			alertGroups[key] = group
+		}
+		copied := *alert
+		group.alerts = append(group.alerts, &copied)
+		if !alert.notified && group.pendingSince.IsZero() {
+			group.pendingSince = alert.firedAt
+		}
+	}
+}
+
+// dropAlert 把开始抖动的告警移出分组，不推送恢复
+func dropAlert(state *serverState, rule config.AlertRule) {
+	for key, group := range alertGroups {
+		group.alerts = slices.DeleteFunc(group.alerts, func(alert *groupedAlert) bool {
+			return alert.state == state && alert.rule.Name == rule.Name
+		})
+		if len(group.alerts) == 0 {
+			delete(alertGroups, key)
+		}
+	}
+}
+
+// queueRecovery 标记告警已恢复，尚未推送过的告警直接移除，不再推送
+func queueRecovery(state *serverState, rule config.AlertRule, value string, at time.Time) {
+	for key, group := range alertGroups {
+		for i, alert := range group.alerts {
+			if alert.state != state || alert.rule.Name != rule.Name || !alert.resolvedAt.IsZero() {
+				continue
+			}
+			if !alert.notified {
+				group.alerts = slices.Delete(group.alerts, i, i+1)
+				if len(group.alerts) == 0 {
+					delete(alertGroups, key)
+				}
+				break
+			}
+			alert.resolvedAt, alert.recovery = at, value
+			if group.pendingSince.IsZero() {
+				group.pendingSince = at
+			}
+			break
+		}
+	}
+}
+
+// flushAlertGroups 在每轮检查结束时调用：推送等待时间已到的分组变化、到期的重复提醒与升级
+func flushAlertGroups(now time.Time) {
+	silencePending(now)
+	for key, group := range alertGroups {
+		if !group.pendingSince.IsZero() && now.Sub(group.pendingSince) >= group.route.GroupWait {
+			group.sendUpdate(now)
+			if len(group.alerts) == 0 {
+				delete(alertGroups, key)
+				continue
+			}
+		} else if group.route.RepeatInterval > 0 && group.pendingSince.IsZero() && now.Sub(group.lastSent) >= group.route.RepeatInterval {
+			group.sendRepeat(now)
+		}
+		group.escalate(now)
+	}
+}
+
+// silencePending 把等待推送期间服务器进入维护或匹配了静默的告警移出分组，之后与维护或静默期间发生的告警一样处理
+func silencePending(now time.Time) {
+	silenced := map[*groupedAlert]string{}
+	for _, group := range alertGroups {
+		for _, alert := range group.alerts {
+			if alert.notified {
+				continue
+			}
+			if reason := suppression(alert.state.server, alert.rule.Name, alert.rule.Severity, now); reason != "" {
+				silenced[alert] = reason
+			}
+		}
+	}
+	if len(silenced) == 0 {
+		return
+	}
+	for key, group := range alertGroups {
+		group.alerts = slices.DeleteFunc(group.alerts, func(alert *groupedAlert) bool {
+			_, ok := silenced[alert]
+			return ok
+		})
+		if len(group.alerts) == 0 {
+			delete(alertGroups, key)
+		}
+	}
+	// 匹配多个路由节点的告警在各分组中各有一份副本，只处理一次
+	done := map[*alertState]bool{}
+	for alert, reason := range silenced {
+		state := alert.state.alerts[alert.rule.Name]
+		if !done[state] {
+			done[state] = true
+			silenceAlert(alert.state, alert.rule, state, reason, now)
+		}
+	}
+}
+
+// receivers 返回该组消息的渠道：路由节点的渠道与已触发的升级渠道
+func (g *alertGroup) receivers() []string {
+	receivers := slices.Clone(g.route.Receivers)
+	for _, escalation := range g.route.Escalations[:g.escalated] {
+		receivers = append(receivers, escalation.Receivers...)
+	}
+	return receivers
+}
+
+// firing 返回已推送且仍在告警的告警，服务器处于维护或匹配静默的告警不重复提醒，也不升级
+func (g *alertGroup) firing(now time.Time) []*groupedAlert {
+	var firing []*groupedAlert
+	for _, alert := range g.alerts {
+		if alert.notified && alert.resolvedAt.IsZero() && suppression(alert.state.server, alert.rule.Name, alert.rule.Severity, now) == "" {
+			firing = append(firing, alert)
+		}
+	}
+	return firing
+}
+
+// sendUpdate 把新告警与恢复合并为一条消息推送，之后移除已恢复的告警
+//
+// 只有一项变化时消息与单独推送时相同，否则列出新增、恢复与仍未恢复的告警
+func (g *alertGroup) sendUpdate(now time.Time) {
+	var added, recovered, still []*groupedAlert
+	for _, alert := range g.alerts {
+		switch {
+		case !alert.notified:
+			added = append(added, alert)
+		case !alert.resolvedAt.IsZero():
+			recovered = append(recovered, alert)
+		default:
+			still = append(still, alert)
+		}
+	}
+	// 等待期间新告警又恢复时没有需要推送的变化
+	if len(added) == 0 && len(recovered) == 0 {
+		g.pendingSince = time.Time{}
+		return
+	}
+	timeLine := "时间：" + now.Format("2006-01-02 15:04:05")
+
+	var msg notify.Message
+	switch {
+	case len(added) == 1 && len(recovered) == 0 && len(still) == 0:
+		alert := added[0]
+		msg = notify.Message{
+			Kind:  notify.KindAlert,
+			Title: severityPrefix[alert.rule.Severity] + alert.rule.Title,
+			Body:  "服务器：" + alert.state.server.ServerInfo.Name + "\n" + alert.condition + "\n" + alert.value + "\n" + timeLine,
+		}
+	case len(added) == 0 && len(recovered) == 1 && len(still) == 0:
+		alert := recovered[0]
+		msg = notify.Message{
+			Kind:  notify.KindRecovery,
+			Title: "【恢复】" + alert.rule.Title + "已恢复",
+			Body:  "服务器：" + alert.state.server.ServerInfo.Name + "\n" + alert.recovery + "\n" + timeLine,
+		}
+	case len(added) == 0 && len(still) == 0:
+		msg = notify.Message{
+			Kind:  notify.KindRecovery,
+			Title: "【恢复】" + strconv.Itoa(len(recovered)) + " 项告警已全部恢复",
+			Body:  alertLines(recovered, now) + timeLine,
+		}
+	default:
+		kind := notify.KindRecovery
+		if len(added) > 0 {
+			kind = notify.KindAlert
+		}
+		var counts []string
+		body := ""
+		if len(added) > 0 {
+			counts = append(counts, "新增 "+strconv.Itoa(len(added))+" 项")
+			body += "新增告警：\n" + alertLines(added, now)
+		}
+		if len(recovered) > 0 {
+			counts = append(counts, "恢复 "+strconv.Itoa(len(recovered))+" 项")
+			body += "已恢复：\n" + alertLines(recovered, now)
+		}
+		if len(still) > 0 {
+			body += "仍未恢复：\n" + alertLines(still, now)
+		}
+		counts = append(counts, "未恢复 "+strconv.Itoa(len(added)+len(still))+" 项")
+		msg = notify.Message{
+			Kind:  kind,
+			Title: severityPrefix[highestSeverity(slices.Concat(added, still))] + "告警汇总：" + strings.Join(counts, "，"),
+			Body:  body + timeLine,
+		}
+	}
+
+	involved := slices.Concat(added, recovered)
+	msg.Severity = highestSeverity(involved)
+	g.send(msg, g.receivers(), involved, now)
+	g.lastSent, g.pendingSince = now, time.Time{}
+
+	for _, alert := range added {
+		alert.notified = true
+	}
+	g.alerts = slices.DeleteFunc(g.alerts, func(alert *groupedAlert) bool { return !alert.resolvedAt.IsZero() })
+	if len(g.alerts) == 0 {
+		g.escalated = 0
+	}
+}
+
+// sendRepeat 提醒仍未恢复的告警
+func (g *alertGroup) sendRepeat(now time.Time) {
+	firing := g.firing(now)
+	if len(firing) == 0 {
+		return
+	}
+	title := strconv.Itoa(len(firing)) + " 项告警仍未恢复"
+	if len(firing) == 1 {
+		title = firing[0].rule.Title + "仍未恢复"
+	}
+	g.send(notify.Message{
+		Kind:     notify.KindAlert,
+		Severity: highestSeverity(firing),
+		Title:    "【未恢复】" + title,
+		Body:     alertLines(firing, now) + "时间：" + now.Format("2006-01-02 15:04:05"),
+	}, g.receivers(), firing, now)
+	g.lastSent = now
+}
+
+// escalate 在组内最早的告警持续未恢复达到升级时间时，推送到升级渠道
+func (g *alertGroup) escalate(now time.Time) {
+	firing := g.firing(now)
+	if len(firing) == 0 {
+		return
+	}
+	oldest := firing[0].firedAt
+	for _, alert := range firing {
+		if alert.firedAt.Before(oldest) {
+			oldest = alert.firedAt
+		}
+	}
+	for g.escalated < len(g.route.Escalations) {
+		escalation := g.route.Escalations[g.escalated]
+		if now.Sub(oldest) < escalation.After {
+			return
+		}
+		g.escalated++
+		g.send(notify.Message{
+			Kind:     notify.KindAlert,
+			Severity: highestSeverity(firing),
+			Title:    "【升级】告警已持续 " + escalation.After.String() + " 未恢复",
+			Body:     alertLines(firing, now) + "时间：" + now.Format("2006-01-02 15:04:05"),
+			AtMobile: escalation.AtMobile,
+		}, escalation.Receivers, firing, now)
+	}
+}
+
+// send 把消息放入推送队列，推送成功时记录在所涉及告警的事件时间线上
+func (g *alertGroup) send(msg notify.Message, receivers []string, alerts []*groupedAlert, now time.Time) {
+	msg.Time = now
+	// 推送在队列中完成，告警可能在此之前移出分组，因此先取出事件 ID
+	var incidents []int64
+	for _, alert := range alerts {
+		if !slices.Contains(msg.Servers, alert.state.server.ID) {
+			msg.Servers = append(msg.Servers, alert.state.server.ID)
+		}
+		if alert.incident != 0 {
+			incidents = append(incidents, alert.incident)
+		}
+	}
+	enqueueNotification(receivers, msg, func(delivered []string) {
+		note := deliveredNote(delivered, msg.Title)
+		for _, incident := range incidents {
+			if err := insertIncidentUpdate(db, incident, updateNotification, note, now.Format("2006-01-02 15:04:05")); err != nil {
+				log.Println("[ERROR] Failed to add incident update: ", err)
+			}
+		}
+	})
+}
+
+// alertLines 逐行列出告警，例如 "· 生存服 服务器离线：状态等于 offline，已持续 5m0s"
+func alertLines(alerts []*groupedAlert, now time.Time) string {
+	var b strings.Builder
+	for _, alert := range alerts {
+		b.WriteString("· " + alert.state.server.ServerInfo.Name + " " + alert.rule.Title + "：")
+		if alert.resolvedAt.IsZero() {
+			b.WriteString(alert.condition + "，已持续 " + now.Sub(alert.firedAt).Round(time.Second).String())
+		} else {
+			b.WriteString(strings.ReplaceAll(alert.recovery, "\n", "，") + "，持续 " + alert.resolvedAt.Sub(alert.firedAt).Round(time.Second).String())
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// highestSeverity 返回一组告警中最高的严重程度
+func highestSeverity(alerts []*groupedAlert) string {
+	severity := config.SeverityInfo
+	for _, alert := range alerts {
+		if severityRank[alert.rule.Severity] > severityRank[severity] {
+			severity = alert.rule.Severity
+		}
+	}
+	return severity
+}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"github.com/MeowLynxSea/Uptimeow/config"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// captureNotifications 在测试期间把消息放入新的队列，由测试自行取出
+func captureNotifications(t *testing.T) chan notificationJob {
+	queue := notificationQueue
+	notificationQueue = make(chan notificationJob, notificationQueueSize)
+	t.Cleanup(func() { notificationQueue = queue })
+	return notificationQueue
+}
+
+// drainNotifications 取出队列中的全部消息
+func drainNotifications(queue chan notificationJob) []notificationJob {
+	var jobs []notificationJob
+	for {
+		select {
+		case job := <-queue:
+			jobs = append(jobs, job)
+		default:
+			return jobs
+		}
+	}
+}
+
+// sentMessages 取出队列中的全部消息，每条为 "渠道,渠道 标题"，按字典序排列
+func sentMessages(queue chan notificationJob) []string {
+	var sent []string
+	for _, job := range drainNotifications(queue) {
+		sent = append(sent, strings.Join(job.receivers, ",")+" "+job.msg.Title)
+	}
+	slices.Sort(sent)
+	return sent
+}
+
+// setRoute 在测试期间使用指定的路由树，并清空告警分组
+func setRoute(t *testing.T, route config.Route) {
+	global := GlobalConfig
+	GlobalConfig.Warn.Route = route
+	alertGroups = map[string]*alertGroup{}
+	t.Cleanup(func() {
+		GlobalConfig = global
+		alertGroups = map[string]*alertGroup{}
+	})
+}
+
+func testState(id string) *serverState {
+	return newServerState(config.ServerConfig{ID: id, ServerInfo: config.ServerInfoConfig{Name: id}})
+}
+
+var offlineRule = config.AlertRule{Name: "offline", Title: "服务器离线", Severity: config.SeverityCritical}
+
+// TestAlertGroupEscalation 检查升级按时间依次触发，之后的重复提醒与恢复也推送到已触发的升级渠道
+func TestAlertGroupEscalation(t *testing.T) {
+	queue := captureNotifications(t)
+	setRoute(t, config.Route{
+		Receivers:      []string{"ops"},
+		RepeatInterval: time.Hour,
+		Escalations: []config.Escalation{
+			{After: 10 * time.Minute, Receivers: []string{"lead"}, AtMobile: "13800000000"},
+			{After: 30 * time.Minute, Receivers: []string{"boss"}, AtMobile: "*"},
+		},
+	})
+	state := testState("survival")
+
+	steps := []struct {
+		at        time.Duration
+		receivers []string
+		title     string
+		atMobile  string
+	}{
+		{0, []string{"ops"}, "【紧急】服务器离线", ""},
+		{5 * time.Minute, nil, "", ""},
+		{10 * time.Minute, []string{"lead"}, "【升级】告警已持续 10m0s 未恢复", "13800000000"},
+		{20 * time.Minute, nil, "", ""},
+		{40 * time.Minute, []string{"boss"}, "【升级】告警已持续 30m0s 未恢复", "*"},
+		{time.Hour, []string{"ops", "lead", "boss"}, "【未恢复】服务器离线仍未恢复", ""},
+		{65 * time.Minute, []string{"ops", "lead", "boss"}, "【恢复】服务器离线已恢复", ""},
+	}
+	queueAlert(state, offlineRule, "状态等于 offline", "当前状态：offline", at(0))
+	for _, step := range steps {
+		if step.at == 65*time.Minute {
+			queueRecovery(state, offlineRule, "当前状态：online", at(step.at))
+		}
+		flushAlertGroups(at(step.at))
+		jobs := drainNotifications(queue)
+		if step.receivers == nil {
+			if len(jobs) != 0 {
+				t.Errorf("%s: got %d messages, want none", step.at, len(jobs))
+			}
+			continue
+		}
+		if len(jobs) != 1 {
+			t.Fatalf("%s: got %d messages, want 1", step.at, len(jobs))
+		}
+		job := jobs[0]
+		if !slices.Equal(job.receivers, step.receivers) || job.msg.Title != step.title || job.msg.AtMobile != step.atMobile {
+			t.Errorf("%s: got %q to %v (at %q), want %q to %v (at %q)",
+				step.at, job.msg.Title, job.receivers, job.msg.AtMobile, step.title, step.receivers, step.atMobile)
+		}
+	}
+	if len(alertGroups) != 0 {
+		t.Errorf("got %d groups after recovery, want none", len(alertGroups))
+	}
+}
+
+// TestAlertRouting 检查告警按路由树选择节点，并按节点的 group_by 合并推送
+func TestAlertRouting(t *testing.T) {
+	survivalOps := config.Route{Match: config.RouteMatch{Servers: []string{"survival"}}, Receivers: []string{"survival-ops"}}
+	tests := []struct {
+		name  string
+		route config.Route
+		// want 为各渠道收到的消息标题
+		want map[string][]string
+	}{
+		{
+			name:  "one group",
+			route: config.Route{Receivers: []string{"ops"}},
+			want:  map[string][]string{"ops": {"【紧急】告警汇总：新增 2 项，未恢复 2 项"}},
+		},
+		{
+			name:  "group by server",
+			route: config.Route{Receivers: []string{"ops"}, GroupBy: []string{"server"}},
+			want:  map[string][]string{"ops": {"【紧急】服务器离线", "【紧急】服务器离线"}},
+		},
+		{
+			name:  "deepest match",
+			route: config.Route{Receivers: []string{"ops"}, Routes: []config.Route{survivalOps}},
+			want:  map[string][]string{"ops": {"【紧急】服务器离线"}, "survival-ops": {"【紧急】服务器离线"}},
+		},
+		{
+			name: "first match only",
+			route: config.Route{Receivers: []string{"ops"}, Routes: []config.Route{
+				survivalOps,
+				{Match: config.RouteMatch{Severities: []string{config.SeverityCritical}}, Receivers: []string{"oncall"}},
+			}},
+			want: map[string][]string{"oncall": {"【紧急】服务器离线"}, "survival-ops": {"【紧急】服务器离线"}},
+		},
+		{
+			name: "continue",
+			route: config.Route{Receivers: []string{"ops"}, Routes: []config.Route{
+				{Match: survivalOps.Match, Receivers: survivalOps.Receivers, Continue: true},
+				{Match: config.RouteMatch{Severities: []string{config.SeverityCritical}}, Receivers: []string{"oncall"}},
+			}},
+			want: map[string][]string{"oncall": {"【紧急】告警汇总：新增 2 项，未恢复 2 项"}, "survival-ops": {"【紧急】服务器离线"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue := captureNotifications(t)
+			setRoute(t, tt.route)
+			queueAlert(testState("survival"), offlineRule, "状态等于 offline", "当前状态：offline", at(0))
+			queueAlert(testState("creative"), offlineRule, "状态等于 offline", "当前状态：offline", at(0))
+			flushAlertGroups(at(0))
+
+			got := map[string][]string{}
+			for _, job := range drainNotifications(queue) {
+				for _, receiver := range job.receivers {
+					got[receiver] = append(got[receiver], job.msg.Title)
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for receiver, titles := range tt.want {
+				if strings.Join(got[receiver], "\n") != strings.Join(titles, "\n") {
+					t.Errorf("%s: got %q, want %q", receiver, got[receiver], titles)
+				}
+			}
+		})
+	}
+}
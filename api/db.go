@@ -0,0 +1,145 @@
+package api
+
+import (
+	"database/sql"
+)
+
+// migrateData 创建 data 表，并把旧版本创建的表升级到当前结构
+//
+// 旧版本只监控一台服务器，data 表以 time_index 为主键且没有 server 列，
+// 升级时这些数据归属于 legacyServer
+func migrateData(database *sql.DB, legacyServer string) error {
+	createTableSQL := `
+	CREATE TABLE IF NOT EXISTS data (
+		server TEXT NOT NULL,
+		time_index DATETIME NOT NULL,
+		online BOOLEAN,
+		tps REAL,
+		tps_estimated BOOLEAN,
+		online_player INTEGER,
+		max_player INTEGER,
+		player_list TEXT,
+		latency INTEGER,
+		mspt REAL,
+		mspt_min REAL,
+		mspt_max REAL,
+		status TEXT,
+		reason TEXT,
+		PRIMARY KEY (server, time_index)
+	);
+	`
+	if _, err := database.Exec(createTableSQL); err != nil {
+		return err
+	}
+
+	// latency 为 Server List Ping（未启用时为基岩版 ping）的往返时间（毫秒）
+	if err := ensureColumn(database, "data", "latency", "INTEGER"); err != nil {
+		return err
+	}
+
+	// tps_estimated 表示 TPS 由原版机制推算得到，而非服务端直接给出
+	if err := ensureColumn(database, "data", "tps_estimated", "BOOLEAN"); err != nil {
+		return err
+	}
+
+	// mspt、mspt_min、mspt_max 为最近 10 秒的平均、最小、最大 tick 耗时（毫秒），未采集时为空
+	for _, column := range []string{"mspt", "mspt_min", "mspt_max"} {
+		if err := ensureColumn(database, "data", column, "REAL"); err != nil {
+			return err
+		}
+	}
+
+	// status 为 online、degraded、unreachable 或 offline，reason 为非 online 时的原因；旧数据为空，按 online 列推断
+	for _, column := range []string{"status", "reason"} {
+		if err := ensureColumn(database, "data", column, "TEXT"); err != nil {
+			return err
+		}
+	}
+
+	hasServer, err := hasColumn(database, "data", "server")
+	if err != nil || hasServer {
+		return err
+	}
+
+	// SQLite 无法修改主键，只能重建表
+	tx, err := database.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err = tx.Exec(`ALTER TABLE data RENAME TO data_single`); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(createTableSQL); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO data (server, time_index, online, tps, tps_estimated, online_player, max_player, player_list, latency, mspt, mspt_min, mspt_max, status, reason)
+		SELECT ?, time_index, online, tps, tps_estimated, online_player, max_player, player_list, latency, mspt, mspt_min, mspt_max, status, reason FROM data_single`, legacyServer)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`DROP TABLE data_single`); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// migrateDimensionTPS 创建保存各维度 TPS 的 dimension_tps 表，mspt 为该维度的平均 tick 耗时（毫秒）
+func migrateDimensionTPS(database *sql.DB) error {
+	_, err := database.Exec(`
+	CREATE TABLE IF NOT EXISTS dimension_tps (
+		server TEXT NOT NULL,
+		time_index DATETIME NOT NULL,
+		dimension TEXT NOT NULL,
+		tps REAL,
+		mspt REAL,
+		PRIMARY KEY (server, time_index, dimension)
+	);
+	`)
+	return err
+}
+
+// migrateSoftware 创建 software 表，每当识别出的服务端类型或版本变化时记录一行
+func migrateSoftware(database *sql.DB) error {
+	_, err := database.Exec(`
+	CREATE TABLE IF NOT EXISTS software (
+		server TEXT NOT NULL,
+		time_index DATETIME NOT NULL,
+		family TEXT NOT NULL,
+		version TEXT,
+		build TEXT,
+		PRIMARY KEY (server, time_index)
+	);
+	`)
+	return err
+}
+
+// hasColumn 判断表中是否存在指定的列
+func hasColumn(database *sql.DB, table, column string) (bool, error) {
+	rows, err := database.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// ensureColumn 在旧版本创建的表中补充新增的列，列已存在时不做任何操作
+func ensureColumn(database *sql.DB, table, column, definition string) error {
+	exists, err := hasColumn(database, table, column)
+	if err != nil || exists {
+		return err
+	}
+	_, err = database.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition)
+	return err
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"database/sql"
+	"github.com/MeowLynxSea/Uptimeow/internal/collector"
+	"time"
+)
+
+// DimensionData 是单个维度在某一时刻的 TPS 记录
+type DimensionData struct {
+	Time time.Time `json:"time"`
+	Tps  float64   `json:"tps"`
+	Mspt float64   `json:"mspt"`
+}
+
+// getDimensions 返回某一时刻记录的各维度 TPS
+func getDimensions(database *sql.DB, server string, t time.Time) ([]collector.DimensionTPS, error) {
+	rows, err := database.Query(`SELECT dimension, tps, mspt FROM dimension_tps
+		WHERE server = ? AND time_index = ? ORDER BY dimension`, server, t.Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var dimensions []collector.DimensionTPS
+	for rows.Next() {
+		var dimension collector.DimensionTPS
+		if err := rows.Scan(&dimension.Name, &dimension.TPS, &dimension.MSPT); err != nil {
+			return nil, err
+		}
+		dimensions = append(dimensions, dimension)
+	}
+	return dimensions, rows.Err()
+}
+
+// getDimensionHistory 返回单个维度在 since 之后的 TPS 记录
+func getDimensionHistory(database *sql.DB, server, dimension string, since time.Time) ([]DimensionData, error) {
+	rows, err := database.Query(`SELECT time_index, tps, mspt FROM dimension_tps
+		WHERE server = ? AND dimension = ? AND time_index > ? ORDER BY time_index ASC`, server, dimension, since.Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	data := []DimensionData{}
+	for rows.Next() {
+		var dd DimensionData
+		if err := rows.Scan(&dd.Time, &dd.Tps, &dd.Mspt); err != nil {
+			return nil, err
+		}
+		data = append(data, dd)
+	}
+	return data, rows.Err()
+}
@@ -4,39 +4,40 @@ import (
 	"database/sql"
 	"encoding/json"
 	"github.com/MeowLynxSea/Uptimeow/config"
-	"github.com/MeowLynxSea/Uptimeow/internal/rcon"
+	"github.com/MeowLynxSea/Uptimeow/internal/collector"
+	"github.com/MeowLynxSea/Uptimeow/internal/event"
+	"github.com/MeowLynxSea/Uptimeow/internal/monitor"
+	"github.com/MeowLynxSea/Uptimeow/internal/notify"
 	_ "github.com/glebarez/sqlite"
 	"github.com/gorilla/websocket"
 	"github.com/robfig/cron/v3"
-	"github.com/wanghuiyt/ding"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 )
 
 var GlobalConfig config.ConfigData
-var saveCron = cron.New()
-var isOnline bool
-var tps, tps5, tps15 float64
-var onlinePlayer, maxPlayer int
-var playerList []string
-var db *sql.DB
-var warnLevel int
 
-const (
-	warnLevelNormal   = 0
-	warnLevelWarning  = 1
-	warnLevelCritical = 2
-)
+// saveCron 定时保存数据并检查告警，上一次尚未结束时跳过本次，使 alertGroups 等状态不会被并发访问
+var saveCron = cron.New(cron.WithChain(cron.SkipIfStillRunning(cron.DefaultLogger)))
+var bus = event.NewBus()
+var db *sql.DB
 
 type ServerData struct {
 	Time         time.Time `json:"time"`
 	IsOnline     bool      `json:"is_online"`
 	Tps          float64   `json:"tps"`
+	TpsEstimated bool      `json:"tps_estimated"`
 	OnlinePlayer int       `json:"online_player"`
 	MaxPlayer    int       `json:"max_player"`
+	Latency      int64     `json:"latency"`
+	// Mspt、MsptMax 为最近 10 秒的平均与最大 tick 耗时（毫秒），未采集时为 0
+	Mspt    float64 `json:"mspt"`
+	MsptMax float64 `json:"mspt_max"`
+	Status  string  `json:"status"`
 }
 
 // Response 是发送给WebSocket客户端的响应结构
@@ -46,52 +47,91 @@ type Response struct {
 }
 
 type ServerInfo struct {
+	ServerID          string `json:"server_id"`
 	ServerName        string `json:"server_name"`
 	ServerAddress     string `json:"server_address"`
 	ServerWebsite     string `json:"server_website"`
 	ServerDescription string `json:"server_description"`
+	// Status 为最近一次 Server List Ping 的结果，未启用 slp 探测或探测失败时为空
+	Status *PingStatus `json:"status,omitempty"`
+	// BedrockStatus 为最近一次基岩版 ping 的结果，未启用 bedrock 探测或探测失败时为空
+	BedrockStatus *BedrockStatus `json:"bedrock_status,omitempty"`
+	// QueryStatus 为最近一次 Query 完整状态查询的结果，未启用 query 探测或探测失败时为空
+	QueryStatus *QueryStatus `json:"query_status,omitempty"`
+	// Software 为最近一次通过 RCON 识别出的服务端类型，未启用 rcon 探测或尚未连接时为空
+	Software *SoftwareInfo `json:"software,omitempty"`
+}
+
+// ServerSummary 是服务器列表中的一项，附带实时状态
+type ServerSummary struct {
+	ServerID      string `json:"server_id"`
+	ServerName    string `json:"server_name"`
+	ServerAddress string `json:"server_address"`
+	LiveState
+}
+
+type PingStatus struct {
+	Version      string   `json:"version"`
+	Protocol     int      `json:"protocol"`
+	Motd         string   `json:"motd"`
+	OnlinePlayer int      `json:"online_player"`
+	MaxPlayer    int      `json:"max_player"`
+	PlayerSample []string `json:"player_sample"`
+	Latency      int64    `json:"latency"`
+}
+
+type BedrockStatus struct {
+	Edition      string `json:"edition"`
+	Motd         string `json:"motd"`
+	SubMotd      string `json:"sub_motd"`
+	Protocol     int    `json:"protocol"`
+	Version      string `json:"version"`
+	OnlinePlayer int    `json:"online_player"`
+	MaxPlayer    int    `json:"max_player"`
+	ServerGUID   string `json:"server_guid"`
+	GameMode     string `json:"game_mode"`
+	// PortV4 与 PortV6 为服务器声明的端口，较旧的服务端不返回时为 0
+	PortV4  int   `json:"port_v4"`
+	PortV6  int   `json:"port_v6"`
+	Latency int64 `json:"latency"`
+}
+
+type QueryStatus struct {
+	Motd         string   `json:"motd"`
+	Version      string   `json:"version"`
+	Software     string   `json:"software"`
+	Plugins      []string `json:"plugins"`
+	Map          string   `json:"map"`
+	OnlinePlayer int      `json:"online_player"`
+	MaxPlayer    int      `json:"max_player"`
+	PlayerList   []string `json:"player_list"`
+	Latency      int64    `json:"latency"`
 }
 
 type DetailedInfo struct {
 	Time         time.Time `json:"time"`
 	IsOnline     bool      `json:"is_online"`
 	Tps          float64   `json:"tps"`
+	TpsEstimated bool      `json:"tps_estimated"`
 	OnlinePlayer int       `json:"online_player"`
 	MaxPlayer    int       `json:"max_player"`
 	PlayerList   string    `json:"player_list,omitempty"`
+	Latency      int64     `json:"latency"`
+	Mspt         float64   `json:"mspt"`
+	MsptMin      float64   `json:"mspt_min"`
+	MsptMax      float64   `json:"mspt_max"`
+	// Dimensions 为同一时刻记录的各维度 TPS，没有记录时为空
+	Dimensions []collector.DimensionTPS `json:"dimensions,omitempty"`
+	Status     string                   `json:"status"`
+	Reason     string                   `json:"reason,omitempty"`
 }
 
-func pushDingTalkBot(message string, msgtype string) {
-	if GlobalConfig.Warn.DingTalkBot.Enabled {
-		dingMsger := ding.Webhook{
-			AccessToken: GlobalConfig.Warn.DingTalkBot.AccessToken,
-			Secret:      GlobalConfig.Warn.DingTalkBot.Secret,
-		}
-		if GlobalConfig.Warn.DingTalkBot.AtMobile != "" {
-			err := dingMsger.SendMessageText(message, GlobalConfig.Warn.DingTalkBot.AtMobile)
-			if err != nil {
-				log.Println("[ERROR] 钉钉机器人推送失败，原因: ", err)
-			} else {
-				log.Println("[INFO] 钉钉机器人推送[" + msgtype + "]成功")
-			}
-		} else {
-			err := dingMsger.SendMessageText(message)
-			if err != nil {
-				log.Println("[ERROR] 钉钉机器人推送失败，原因: ", err)
-			} else {
-				log.Println("[INFO] 钉钉机器人推送[" + msgtype + "]成功")
-			}
-		}
-	}
-}
-
-func init() {
+// Start 读取配置、打开数据库并开始监控各服务器，需在处理请求前调用一次
+func Start() {
 	GlobalConfig = config.Load()
-	warnLevel = 0
-
-	pushDingTalkBot("【成功】Uptimeow 监控已上线", "成功消息")
 
-	db, err := sql.Open("sqlite", "data/history.db")
+	var err error
+	db, err = sql.Open("sqlite", "data/history.db")
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -102,89 +142,168 @@ func init() {
 		log.Fatal(err)
 	}
 
-	// 创建表data
-	createTableSQL := `
-	CREATE TABLE IF NOT EXISTS data (
-		time_index DATETIME NOT NULL PRIMARY KEY,
-		online BOOLEAN,
-		tps INTEGER,
-		online_player INTEGER,
-		max_player INTEGER,
-		player_list TEXT
-	);
-	`
-	_, err = db.Exec(createTableSQL)
-	if err != nil {
+	// 创建或升级表data，旧版本的数据归属于第一台服务器
+	if err = migrateData(db, GlobalConfig.Servers[0].ID); err != nil {
+		log.Fatal(err)
+	}
+	if err = migrateDimensionTPS(db); err != nil {
+		log.Fatal(err)
+	}
+	if err = migrateSoftware(db); err != nil {
+		log.Fatal(err)
+	}
+	if err = migrateSessions(db); err != nil {
+		log.Fatal(err)
+	}
+	if err = migrateIncidents(db); err != nil {
+		log.Fatal(err)
+	}
+	if err = migrateNotifications(db); err != nil {
+		log.Fatal(err)
+	}
+	if err = migrateSilences(db); err != nil {
 		log.Fatal(err)
 	}
 
+	if err = setupNotificationChannels(GlobalConfig.Warn.Channels); err != nil {
+		log.Fatal(err)
+	}
+	go runNotificationQueue()
+	sendNotification(notify.Message{Kind: notify.KindSystem, Severity: config.SeverityInfo, Title: "【成功】Uptimeow 监控已上线"}, "", nil)
+
+	if err = validateAlertRules(GlobalConfig.Servers); err != nil {
+		log.Fatal(err)
+	}
+	for _, server := range GlobalConfig.Servers {
+		states[server.ID] = newServerState(server)
+		if sessionTrackers[server.ID], err = loadSessionTracker(db, server.ID); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	saveCron.AddFunc("@every 10s", func() {
 		currentTime := time.Now()
-		// log.Println("[DEBUG] Saving data to database")
-		err = db.Ping()
-		if err != nil {
-			log.Println(err)
-		}
-		if !isOnline {
-			_, err = db.Exec("INSERT INTO data (time_index, online, tps, online_player, max_player, player_list) VALUES (?, ?, ?, ?, ?, ?)", currentTime.Format("2006-01-02 15:04:05"), 0, tps, 0, 0, "")
-		} else {
-			if tps != 0 {
-				_, err = db.Exec("INSERT INTO data (time_index, online, tps, online_player, max_player, player_list) VALUES (?, ?, ?, ?, ?, ?)", currentTime.Format("2006-01-02 15:04:05"), isOnline, tps, onlinePlayer, maxPlayer, strings.Join(playerList, ","))
-			}
-		}
-		if err != nil {
-			log.Println("[ERROR] Failed to insert data into database:] ", err)
+		for _, server := range GlobalConfig.Servers {
+			state := states[server.ID]
+			live := state.snapshot()
+			saveData(server, live, currentTime)
+			sessionTrackers[server.ID].update(db, live, currentTime)
+			checkAlerts(state, live, currentTime)
+			observeIncidents(state, live, currentTime)
 		}
+		flushAlertGroups(currentTime)
+	})
 
-		switch warnLevel {
-		case warnLevelNormal:
-			if !isOnline && GlobalConfig.Warn.EnabledType.Offline {
-				warnLevel = warnLevelCritical
-				pushDingTalkBot("【紧急】服务器离线\n经监测，服务器已离线，请尽快处理\n时间："+currentTime.Format("2006-01-02 15:04:05"), "异常告警")
-				break
-			}
-			if tps < GlobalConfig.Warn.EnabledType.LowTps.Threold && GlobalConfig.Warn.EnabledType.LowTps.Enabled && tps != 0 {
-				warnLevel = warnLevelWarning
-				pushDingTalkBot("【警告】TPS过低报警\n服务器TPS低于设定值("+strconv.FormatFloat(GlobalConfig.Warn.EnabledType.LowTps.Threold, 'f', 2, 64)+")\n当前TPS："+strconv.FormatFloat(tps, 'f', 2, 64)+"\n时间："+currentTime.Format("2006-01-02 15:04:05"), "异常告警")
-			}
-		case warnLevelWarning:
-			if !isOnline && GlobalConfig.Warn.EnabledType.Offline {
-				warnLevel = warnLevelCritical
-				pushDingTalkBot("【紧急】服务器离线\n经监测，服务器已离线，请尽快处理\n时间："+currentTime.Format("2006-01-02 15:04:05"), "异常告警")
-				break
-			}
-			if tps >= GlobalConfig.Warn.EnabledType.LowTps.Threold && GlobalConfig.Warn.EnabledType.LowTps.Enabled {
-				warnLevel = warnLevelNormal
-				pushDingTalkBot("【恢复】服务器TPS恢复正常\n时间："+currentTime.Format("2006-01-02 15:04:05"), "成功消息")
+	saveCron.Start()
+
+	go consumeEvents(bus.Subscribe(64 * len(GlobalConfig.Servers)))
+	for _, server := range GlobalConfig.Servers {
+		monitor.Start(server, bus)
+	}
+}
+
+// saveData 将服务器当前状态写入数据库
+func saveData(server config.ServerConfig, live LiveState, currentTime time.Time) {
+	// log.Println("[DEBUG] Saving data to database")
+	var err error
+	if !live.IsOnline {
+		_, err = db.Exec("INSERT INTO data (server, time_index, online, tps, online_player, max_player, player_list, latency, status, reason) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", server.ID, currentTime.Format("2006-01-02 15:04:05"), 0, live.Tps, 0, 0, "", 0, live.Status, live.Reason)
+	} else {
+		// 使用 RCON 时需等到首个 TPS 数据到达后再记录，其余探测方式和原版服务端没有 TPS 数据
+		if !live.awaitingTPS {
+			// 未采集 MSPT 时写入 NULL，以区别于耗时为 0
+			var mspt, msptMin, msptMax interface{}
+			if live.Mspt != nil {
+				mspt, msptMin, msptMax = live.Mspt.Avg, live.Mspt.Min, live.Mspt.Max
 			}
-		case warnLevelCritical:
-			if isOnline && GlobalConfig.Warn.EnabledType.Offline {
-				warnLevel = warnLevelNormal
-				pushDingTalkBot("【恢复】服务器已恢复在线\n时间："+currentTime.Format("2006-01-02 15:04:05"), "成功消息")
+			_, err = db.Exec("INSERT INTO data (server, time_index, online, tps, tps_estimated, online_player, max_player, player_list, latency, mspt, mspt_min, mspt_max, status, reason) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", server.ID, currentTime.Format("2006-01-02 15:04:05"), live.IsOnline, live.Tps, live.TpsEstimated, live.OnlinePlayer, live.MaxPlayer, strings.Join(live.PlayerList, ","), live.Latency, mspt, msptMin, msptMax, live.Status, live.Reason)
+			for _, dimension := range live.Dimensions {
+				if err != nil {
+					break
+				}
+				_, err = db.Exec("INSERT INTO dimension_tps (server, time_index, dimension, tps, mspt) VALUES (?, ?, ?, ?, ?)", server.ID, currentTime.Format("2006-01-02 15:04:05"), dimension.Name, dimension.TPS, dimension.MSPT)
 			}
 		}
-	})
+	}
+	if err != nil {
+		log.Println("[ERROR] ["+server.ID+"] Failed to insert data into database:] ", err)
+	}
+}
 
-	saveCron.Start()
+// lookupServer 根据请求参数 server 查找服务器，缺省为第一台服务器
+func lookupServer(r *http.Request) (*serverState, bool) {
+	id := r.URL.Query().Get("server")
+	if id == "" {
+		id = GlobalConfig.Servers[0].ID
+	}
+	state, ok := states[id]
+	return state, ok
+}
 
-	isOnline = false
-	go rcon.InitRcon(callback)
+// writeResponse 以 {"code": 200, "data": ...} 的格式写入响应体
+func writeResponse(w http.ResponseWriter, data interface{}) {
+	response := struct {
+		Code int         `json:"code"`
+		Data interface{} `json:"data"`
+	}{
+		Code: 200,
+		Data: data,
+	}
+
+	// 将响应结构序列化为JSON并写入响应体
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
 }
 
-func toInt(value interface{}) int {
-	switch v := value.(type) {
-	case int:
-		return v
-	case int64:
-		return int(v)
-	case float64:
-		return int(v)
-	case string:
-		i, _ := strconv.Atoi(v)
-		return i
-	default:
-		return 0
+// parseRange 解析形如 1h、30m 的时间范围参数，为空时返回 def
+func parseRange(param string, def time.Duration) (time.Duration, bool) {
+	if param == "" {
+		return def, true
+	}
+	window, err := time.ParseDuration(param)
+	if err != nil || window <= 0 {
+		return 0, false
+	}
+	return window, true
+}
+
+// parseTimeRange 解析统计时段：指定 since（可选 until，缺省为 now）时使用这两个时间，
+// 格式为 2006/01/02 15:04:05，按 location（即 web.timezone）解释，否则按 range 取最近一段时间
+func parseTimeRange(queryParams url.Values, now time.Time, location *time.Location) (time.Time, time.Time, bool) {
+	if param := queryParams.Get("since"); param != "" {
+		since, err := time.ParseInLocation("2006/01/02 15:04:05", param, location)
+		if err != nil {
+			return time.Time{}, time.Time{}, false
+		}
+		until := now
+		if param := queryParams.Get("until"); param != "" {
+			if until, err = time.ParseInLocation("2006/01/02 15:04:05", param, location); err != nil {
+				return time.Time{}, time.Time{}, false
+			}
+		}
+		if until.After(now) {
+			until = now
+		}
+		return since, until, since.Before(until)
+	}
+	window, ok := parseRange(queryParams.Get("range"), 0)
+	return now.Add(-window), now, ok
+}
+
+// parseLimit 解析条数参数，为空时返回 def，超过 max 时按 max 处理
+func parseLimit(param string, def, max int) (int, bool) {
+	if param == "" {
+		return def, true
+	}
+	limit, err := strconv.Atoi(param)
+	if err != nil || limit <= 0 {
+		return 0, false
 	}
+	if limit > max {
+		limit = max
+	}
+	return limit, true
 }
 
 var upgrader = websocket.Upgrader{
@@ -196,19 +315,14 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
-// WebSocketHandler 处理WebSocket连接
+// WebSocketHandler 处理WebSocket连接，通过参数 server 指定服务器
 func WebSocketHandler(w http.ResponseWriter, r *http.Request) {
-	localDB, err := sql.Open("sqlite", "data/history.db")
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer localDB.Close()
-
-	// 确保数据库连接是有效的
-	err = localDB.Ping()
-	if err != nil {
-		log.Fatal(err)
+	state, ok := lookupServer(r)
+	if !ok {
+		http.Error(w, "Unknown server", http.StatusNotFound)
+		return
 	}
+	serverID := state.server.ID
 
 	// 将HTTP连接升级为WebSocket连接
 	conn, err := upgrader.Upgrade(w, r, nil)
@@ -237,7 +351,7 @@ func WebSocketHandler(w http.ResponseWriter, r *http.Request) {
 				log.Println("Error parsing time:", err)
 				continue
 			}
-			resp.Data, err = getEarlierData(localDB, reqTime)
+			resp.Data, err = getEarlierData(db, serverID, reqTime)
 			if err != nil {
 				log.Println("Error getting data from database:", err)
 				continue
@@ -250,7 +364,7 @@ func WebSocketHandler(w http.ResponseWriter, r *http.Request) {
 				log.Println("Error parsing time:", err)
 				continue
 			}
-			resp.Data, err = getLaterData(localDB, reqTime)
+			resp.Data, err = getLaterData(db, serverID, reqTime)
 			if err != nil {
 				log.Println("Error getting data from database:", err)
 				continue
@@ -281,11 +395,11 @@ func WebSocketHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func getLaterData(database *sql.DB, t time.Time) ([]ServerData, error) {
+func getLaterData(database *sql.DB, server string, t time.Time) ([]ServerData, error) {
 	dbTime := t.Format("2006-01-02 15:04:05")
-	query := `SELECT time_index, online, tps, online_player, max_player
-			  FROM data WHERE time_index > ? ORDER BY time_index ASC`
-	rows, err := database.Query(query, dbTime)
+	query := `SELECT time_index, online, tps, COALESCE(tps_estimated, 0), online_player, max_player, COALESCE(latency, 0), COALESCE(mspt, 0), COALESCE(mspt_max, 0), ` + statusColumn + `
+			  FROM data WHERE server = ? AND time_index > ? ORDER BY time_index ASC`
+	rows, err := database.Query(query, server, dbTime)
 	if err != nil {
 		return nil, err
 	}
@@ -294,7 +408,7 @@ func getLaterData(database *sql.DB, t time.Time) ([]ServerData, error) {
 	var data []ServerData
 	for rows.Next() {
 		var sd ServerData
-		if err := rows.Scan(&sd.Time, &sd.IsOnline, &sd.Tps, &sd.OnlinePlayer, &sd.MaxPlayer); err != nil {
+		if err := rows.Scan(&sd.Time, &sd.IsOnline, &sd.Tps, &sd.TpsEstimated, &sd.OnlinePlayer, &sd.MaxPlayer, &sd.Latency, &sd.Mspt, &sd.MsptMax, &sd.Status); err != nil {
 			return nil, err
 		}
 		data = append(data, sd)
@@ -302,11 +416,11 @@ func getLaterData(database *sql.DB, t time.Time) ([]ServerData, error) {
 	return data, nil
 }
 
-func getEarlierData(database *sql.DB, t time.Time) ([]ServerData, error) {
+func getEarlierData(database *sql.DB, server string, t time.Time) ([]ServerData, error) {
 	dbTime := t.Format("2006-01-02 15:04:05")
-	query := `SELECT time_index, online, tps, online_player, max_player
-	          FROM data WHERE time_index < ? ORDER BY time_index DESC LIMIT 60`
-	rows, err := database.Query(query, dbTime)
+	query := `SELECT time_index, online, tps, COALESCE(tps_estimated, 0), online_player, max_player, COALESCE(latency, 0), COALESCE(mspt, 0), COALESCE(mspt_max, 0), ` + statusColumn + `
+	          FROM data WHERE server = ? AND time_index < ? ORDER BY time_index DESC LIMIT 60`
+	rows, err := database.Query(query, server, dbTime)
 	if err != nil {
 		return nil, err
 	}
@@ -315,7 +429,7 @@ func getEarlierData(database *sql.DB, t time.Time) ([]ServerData, error) {
 	var data []ServerData
 	for rows.Next() {
 		var sd ServerData
-		if err := rows.Scan(&sd.Time, &sd.IsOnline, &sd.Tps, &sd.OnlinePlayer, &sd.MaxPlayer); err != nil {
+		if err := rows.Scan(&sd.Time, &sd.IsOnline, &sd.Tps, &sd.TpsEstimated, &sd.OnlinePlayer, &sd.MaxPlayer, &sd.Latency, &sd.Mspt, &sd.MsptMax, &sd.Status); err != nil {
 			return nil, err
 		}
 		data = append(data, sd)
@@ -339,30 +453,52 @@ func APIHandler(w http.ResponseWriter, r *http.Request) {
 	queryParams := r.URL.Query()
 	requestType := queryParams.Get("type")
 
-	// 检查请求类型是否为 server_info
+	// 服务器列表和群组服不针对某一台服务器
+	if requestType == "server_list" {
+		servers := make([]ServerSummary, 0, len(GlobalConfig.Servers))
+		for _, server := range GlobalConfig.Servers {
+			servers = append(servers, summarize(server))
+		}
+		writeResponse(w, servers)
+		return
+	}
+	if handleNetworkRequest(w, r) {
+		return
+	}
+	if handleIncidentRequest(w, r) {
+		return
+	}
+
+	state, ok := lookupServer(r)
+	if !ok {
+		http.Error(w, "Unknown server", http.StatusNotFound)
+		return
+	}
+	server := state.server
+
 	switch requestType {
 	case "server_info":
 		// 准备要返回的数据
 		serverInfo := ServerInfo{
-			ServerName:        GlobalConfig.ServerInfo.Name,
-			ServerAddress:     GlobalConfig.ServerInfo.Address,
-			ServerWebsite:     GlobalConfig.ServerInfo.Website,
-			ServerDescription: GlobalConfig.ServerInfo.Description,
+			ServerID:          server.ID,
+			ServerName:        server.ServerInfo.Name,
+			ServerAddress:     server.ServerInfo.Address,
+			ServerWebsite:     server.ServerInfo.Website,
+			ServerDescription: server.ServerInfo.Description,
 		}
-
-		// 创建响应结构
-		response := struct {
-			Code int        `json:"code"`
-			Data ServerInfo `json:"data"`
-		}{
-			Code: 200,
-			Data: serverInfo,
+		state.mu.Lock()
+		serverInfo.Status = state.slpStatus
+		serverInfo.BedrockStatus = state.bedrockStatus
+		serverInfo.QueryStatus = state.queryStatus
+		if state.software != nil {
+			software := *state.software
+			software.Collectors = state.collectors
+			software.Unsupported = state.unsupported
+			serverInfo.Software = &software
 		}
+		state.mu.Unlock()
 
-		// 将响应结构序列化为JSON并写入响应体
-		if err := json.NewEncoder(w).Encode(response); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
+		writeResponse(w, serverInfo)
 	case "detailed_info":
 		clientTimeFormat := "2006/01/02 15:04:05"
 		t, err := time.Parse(clientTimeFormat, queryParams.Get("time"))
@@ -372,81 +508,185 @@ func APIHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		dbTime := t.Format("2006-01-02 15:04:05")
 
-		localDB, err := sql.Open("sqlite", "data/history.db")
-		if err != nil {
-			log.Fatal(err)
+		query := `SELECT time_index, online, tps, COALESCE(tps_estimated, 0), online_player, max_player, player_list, COALESCE(latency, 0),
+			  COALESCE(mspt, 0), COALESCE(mspt_min, 0), COALESCE(mspt_max, 0), ` + statusColumn + `, COALESCE(reason, '')
+			  FROM data WHERE server = ? AND time_index > ? ORDER BY time_index ASC LIMIT 1`
+		var sd DetailedInfo
+		err = db.QueryRow(query, server.ID, dbTime).Scan(&sd.Time, &sd.IsOnline, &sd.Tps, &sd.TpsEstimated, &sd.OnlinePlayer, &sd.MaxPlayer, &sd.PlayerList, &sd.Latency, &sd.Mspt, &sd.MsptMin, &sd.MsptMax, &sd.Status, &sd.Reason)
+		if err == sql.ErrNoRows {
+			http.Error(w, "No data after the given time", http.StatusNotFound)
+			return
 		}
-		defer localDB.Close()
-		query := `SELECT time_index, online, tps, online_player, max_player, player_list
-			  FROM data WHERE time_index > ? ORDER BY time_index ASC`
-		rows, err := localDB.Query(query, dbTime)
 		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if sd.Dimensions, err = getDimensions(db, server.ID, sd.Time); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		defer rows.Close()
 
-		var data []DetailedInfo
-		for rows.Next() {
-			var sd DetailedInfo
-			var playerList string
-			if err := rows.Scan(&sd.Time, &sd.IsOnline, &sd.Tps, &sd.OnlinePlayer, &sd.MaxPlayer, &playerList); err != nil {
+		writeResponse(w, sd)
+	case "tick_stats":
+		// 统计最近一段时间（缺省 1 小时）内 tick 耗时的分位数
+		window, ok := parseRange(queryParams.Get("range"), time.Hour)
+		if !ok {
+			http.Error(w, "Invalid range", http.StatusBadRequest)
+			return
+		}
+		stats, err := getTickStats(db, server.ID, time.Now().Add(-window))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeResponse(w, stats)
+	case "dimension_history":
+		// 单个维度最近一段时间（缺省 1 小时）的 TPS 记录
+		dimension := queryParams.Get("dimension")
+		if dimension == "" {
+			http.Error(w, "Missing dimension", http.StatusBadRequest)
+			return
+		}
+		window, ok := parseRange(queryParams.Get("range"), time.Hour)
+		if !ok {
+			http.Error(w, "Invalid range", http.StatusBadRequest)
+			return
+		}
+		history, err := getDimensionHistory(db, server.ID, dimension, time.Now().Add(-window))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeResponse(w, history)
+	case "player_sessions":
+		// 玩家最近的会话，limit 缺省为 50、最大为 500
+		player := queryParams.Get("player")
+		if player == "" {
+			http.Error(w, "Missing player", http.StatusBadRequest)
+			return
+		}
+		limit, ok := parseLimit(queryParams.Get("limit"), 50, 500)
+		if !ok {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		sessions, err := getSessions(db, server.ID, player, limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeResponse(w, sessions)
+	case "playtime":
+		// 玩家的累计在线时长，指定 range 时只统计最近这段时间
+		player := queryParams.Get("player")
+		if player == "" {
+			http.Error(w, "Missing player", http.StatusBadRequest)
+			return
+		}
+		var since time.Time
+		if param := queryParams.Get("range"); param != "" {
+			window, ok := parseRange(param, 0)
+			if !ok {
+				http.Error(w, "Invalid range", http.StatusBadRequest)
 				return
 			}
-			sd.PlayerList = playerList
-			data = append(data, sd)
+			since = time.Now().Add(-window)
 		}
-		// 创建响应结构
-		response := struct {
-			Code int          `json:"code"`
-			Data DetailedInfo `json:"data"`
-		}{
-			Code: 200,
-			Data: data[0],
+		playtime, err := getPlaytime(db, server.ID, player, since)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
-
-		// 将响应结构序列化为JSON并写入响应体
-		if err := json.NewEncoder(w).Encode(response); err != nil {
+		writeResponse(w, playtime)
+	case "online_players":
+		// 当前在线的玩家及其本次已在线的时长
+		writeResponse(w, sessionTrackers[server.ID].onlineSessions(time.Now()))
+	case "activity":
+		// 最近一段时间（缺省 7 天）按星期 × 小时及按日汇总的在线人数，tz 可覆盖配置的时区
+		window, ok := parseRange(queryParams.Get("range"), 7*24*time.Hour)
+		if !ok {
+			http.Error(w, "Invalid range", http.StatusBadRequest)
+			return
+		}
+		location := GlobalConfig.Web.Location
+		if tz := queryParams.Get("tz"); tz != "" {
+			var err error
+			if location, err = time.LoadLocation(tz); err != nil {
+				http.Error(w, "Invalid tz", http.StatusBadRequest)
+				return
+			}
+		}
+		now := time.Now()
+		activity, err := getActivity(db, server.ID, now.Add(-window), now, location)
+		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeResponse(w, activity)
+	case "uptime":
+		// 可用率：缺省返回最近 24h、7d、30d、90d，指定 range 或 since/until（格式同 detailed_info 的 time）时只统计该时段
+		exclude := queryParams.Get("exclude_maintenance") == "true"
+		now := time.Now()
+		if queryParams.Get("range") == "" && queryParams.Get("since") == "" {
+			uptime, err := getUptime(db, server, now, exclude)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			writeResponse(w, uptime)
+			return
+		}
+		since, until, ok := parseTimeRange(queryParams, now, GlobalConfig.Web.Location)
+		if !ok {
+			http.Error(w, "Invalid range", http.StatusBadRequest)
+			return
+		}
+		uptime, err := getUptimeRange(db, server, since, until, exclude)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
+		writeResponse(w, uptime)
+	case "sla_report":
+		// 自然月的 SLA 报告，month 格式为 2006-01，缺省为本月
+		month := queryParams.Get("month")
+		if month == "" {
+			month = time.Now().In(GlobalConfig.Web.Location).Format("2006-01")
+		}
+		start, err := time.ParseInLocation("2006-01", month, GlobalConfig.Web.Location)
+		if err != nil {
+			http.Error(w, "Invalid month", http.StatusBadRequest)
+			return
+		}
+		now := time.Now()
+		if start.After(now) {
+			http.Error(w, "Month is in the future", http.StatusBadRequest)
+			return
+		}
+		exclude := queryParams.Get("exclude_maintenance") == "true"
+		report, err := getSLAReport(db, server, start, now, exclude)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeResponse(w, report)
+	case "maintenance":
+		// 正在进行与即将开始的计划维护，周期性的维护展开为各次维护；days 为向后查询的天数，缺省为 7，最多 90
+		days, ok := parseLimit(queryParams.Get("days"), 7, 90)
+		if !ok {
+			http.Error(w, "Invalid days", http.StatusBadRequest)
+			return
+		}
+		now := time.Now()
+		writeResponse(w, server.MaintenanceBetween(now, now.AddDate(0, 0, days)))
+	case "software_history":
+		history, err := getSoftwareHistory(db, server.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeResponse(w, history)
 	default:
 		http.Error(w, "Invalid request type", http.StatusBadRequest)
 	}
 }
-
-func callback(data string) {
-	// log.Println("[DEBUG] Receive callback data: " + data)
-
-	var jsonData map[string]interface{}
-	err := json.Unmarshal([]byte(data), &jsonData)
-	if err != nil {
-		log.Fatalln(err)
-	}
-
-	switch toInt(jsonData["type"]) {
-	case rcon.DataType_connection_success:
-		isOnline = true
-		log.Println("[INFO] RCON connection success")
-	case rcon.DataType_connection_error:
-		isOnline = false
-		tps, tps5, tps15, onlinePlayer, maxPlayer, playerList = 0, 0, 0, 0, 0, []string{}
-		log.Println("[ERROR] RCON connection error")
-	case rcon.DataType_execution_error:
-		isOnline = false
-		tps, tps5, tps15, onlinePlayer, maxPlayer, playerList = 0, 0, 0, 0, 0, []string{}
-		log.Println("[ERROR] RCON execution error")
-	case rcon.DataType_data_tps:
-		log.Println("[DEBUG] TPS: " + strconv.FormatFloat(jsonData["data"].(map[string]interface{})["l1m"].(float64), 'f', -1, 64))
-		tps = jsonData["data"].(map[string]interface{})["l1m"].(float64)
-		tps5 = jsonData["data"].(map[string]interface{})["l5m"].(float64)
-		tps15 = jsonData["data"].(map[string]interface{})["l15m"].(float64)
-	case rcon.DataType_data_list:
-		log.Println("[DEBUG] Player online: " + strconv.FormatFloat(jsonData["data"].(map[string]interface{})["online_player"].(float64), 'f', -1, 64) + "/" + strconv.FormatFloat(jsonData["data"].(map[string]interface{})["max_player"].(float64), 'f', -1, 64))
-		onlinePlayer = int(jsonData["data"].(map[string]interface{})["online_player"].(float64))
-		maxPlayer = int(jsonData["data"].(map[string]interface{})["max_player"].(float64))
-		//read player list
-		playerList = []string{}
-		for _, player := range jsonData["data"].(map[string]interface{})["player_list"].([]interface{}) {
-			playerList = append(playerList, player.(string))
-		}
-	}
-}
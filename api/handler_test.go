@@ -0,0 +1,31 @@
+package api
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestParseTimeRangeLocation(t *testing.T) {
+	location := time.FixedZone("UTC+8", 8*60*60)
+	now := time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC)
+	since, until, ok := parseTimeRange(url.Values{"since": {"2025/03/01 08:00:00"}, "until": {"2025/03/01 20:00:00"}}, now, location)
+	if !ok {
+		t.Fatal("expected a valid range")
+	}
+	if want := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC); !since.Equal(want) {
+		t.Errorf("got since %s, want %s", since, want)
+	}
+	if want := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC); !until.Equal(want) {
+		t.Errorf("got until %s, want %s", until, want)
+	}
+
+	// until 晚于 now 时截断到 now
+	_, until, ok = parseTimeRange(url.Values{"since": {"2025/03/01 08:00:00"}, "until": {"2025/03/05 00:00:00"}}, now, location)
+	if !ok || !until.Equal(now) {
+		t.Errorf("got until %s, want %s", until, now)
+	}
+	if _, _, ok := parseTimeRange(url.Values{"since": {"2025-03-01"}}, now, location); ok {
+		t.Error("expected an invalid range")
+	}
+}
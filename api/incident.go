@@ -0,0 +1,407 @@
+package api
+
+import (
+	"database/sql"
+	"github.com/MeowLynxSea/Uptimeow/config"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// incidentManual 是管理员通过管理接口发布的事件的类型，这类事件可同时影响多台服务器；
+// 自动记录的事件以触发的告警规则名称为类型
+const incidentManual = "manual"
+
+// 事件状态
+const (
+	incidentOpen     = "open"
+	incidentResolved = "resolved"
+)
+
+// 时间线条目的类型：opened 与 resolved 为事件开始与结束，observation 为期间观察到的变化，
+// notification 为推送过的告警消息，update 为管理员发布的进展（Markdown）
+const (
+	updateOpened       = "opened"
+	updateObservation  = "observation"
+	updateNotification = "notification"
+	updateResolved     = "resolved"
+	updateManual       = "update"
+)
+
+// Incident 是一次事件，Duration 为秒数，进行中的事件计算到当前时间
+//
+// 自动记录的事件只属于 Server 一台服务器；管理员发布的事件 Server 为空，受影响的服务器见 Servers
+type Incident struct {
+	ID         int64            `json:"id"`
+	Server     string           `json:"server"`
+	Servers    []string         `json:"servers"`
+	Type       string           `json:"type"`
+	Title      string           `json:"title"`
+	Severity   string           `json:"severity"`
+	Status     string           `json:"status"`
+	StartedAt  time.Time        `json:"started_at"`
+	ResolvedAt *time.Time       `json:"resolved_at"`
+	Duration   int64            `json:"duration"`
+	Updates    []IncidentUpdate `json:"updates,omitempty"`
+}
+
+// IncidentUpdate 是事件时间线上的一条记录
+type IncidentUpdate struct {
+	Time    time.Time `json:"time"`
+	Kind    string    `json:"kind"`
+	Message string    `json:"message"`
+}
+
+// openIncident 是进行中的事件，note 与 value 为最近一次记录的状态（或原因类别）与数值，用于判断是否需要追加观察记录
+type openIncident struct {
+	id    int64
+	note  string
+	value float64
+}
+
+// migrateIncidents 创建 incidents 与 incident_updates 表，并结束上次运行时遗留的进行中事件
+//
+// 重启期间无法得知事件何时恢复，遗留的事件在最后一条时间线记录的时间结束；若状态仍然存在，会重新开始一个事件
+func migrateIncidents(database *sql.DB) error {
+	_, err := database.Exec(`
+	CREATE TABLE IF NOT EXISTS incidents (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		server TEXT NOT NULL,
+		type TEXT NOT NULL,
+		title TEXT NOT NULL,
+		severity TEXT,
+		started_at DATETIME NOT NULL,
+		resolved_at DATETIME
+	);
+	CREATE INDEX IF NOT EXISTS incidents_started ON incidents (started_at);
+	CREATE TABLE IF NOT EXISTS incident_updates (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		incident_id INTEGER NOT NULL,
+		time DATETIME NOT NULL,
+		kind TEXT NOT NULL,
+		message TEXT NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS incident_updates_incident ON incident_updates (incident_id, time);
+	CREATE TABLE IF NOT EXISTS incident_servers (
+		incident_id INTEGER NOT NULL,
+		server TEXT NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS incident_servers_incident ON incident_servers (incident_id);
+	CREATE INDEX IF NOT EXISTS incident_servers_server ON incident_servers (server);
+	`)
+	if err != nil {
+		return err
+	}
+	if err := ensureColumn(database, "incidents", "severity", "TEXT"); err != nil {
+		return err
+	}
+	// 补全旧版本记录的事件的严重程度，当时只有离线为紧急
+	_, err = database.Exec("UPDATE incidents SET severity = CASE type WHEN 'offline' THEN ? ELSE ? END WHERE severity IS NULL",
+		config.SeverityCritical, config.SeverityWarning)
+	if err != nil {
+		return err
+	}
+
+	// 管理员发布的事件由管理员结束，不受重启影响
+	rows, err := database.Query(`SELECT incidents.id, MAX(incident_updates.time) FROM incidents
+		JOIN incident_updates ON incident_updates.incident_id = incidents.id
+		WHERE incidents.resolved_at IS NULL AND incidents.type != ? GROUP BY incidents.id`, incidentManual)
+	if err != nil {
+		return err
+	}
+	stale := map[int64]string{}
+	for rows.Next() {
+		var id int64
+		var last string
+		if err := rows.Scan(&id, &last); err != nil {
+			rows.Close()
+			return err
+		}
+		stale[id] = last
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, last := range stale {
+		if _, err := database.Exec("UPDATE incidents SET resolved_at = ? WHERE id = ?", last, id); err != nil {
+			return err
+		}
+		if err := insertIncidentUpdate(database, id, updateResolved, "Uptimeow 重启，事件在最后一次记录时结束", last); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openIncident 开始一个事件，message 为时间线的第一条记录，note 与 value 见 openIncident 类型；
+// 同类型的事件已在进行时不做任何事
+func (s *serverState) openIncident(kind, title, severity, message, note string, value float64, at time.Time) {
+	if _, ok := s.incidents[kind]; ok {
+		return
+	}
+	result, err := db.Exec("INSERT INTO incidents (server, type, title, severity, started_at) VALUES (?, ?, ?, ?, ?)",
+		s.server.ID, kind, title, severity, at.Format("2006-01-02 15:04:05"))
+	if err != nil {
+		log.Println("[ERROR] ["+s.server.ID+"] Failed to open incident: ", err)
+		return
+	}
+	id, _ := result.LastInsertId()
+	s.incidents[kind] = &openIncident{id: id, note: note, value: value}
+	s.addIncidentUpdate(kind, updateOpened, message, at)
+}
+
+// resolveIncident 结束进行中的事件
+func (s *serverState) resolveIncident(kind, message string, at time.Time) {
+	incident, ok := s.incidents[kind]
+	if !ok {
+		return
+	}
+	s.addIncidentUpdate(kind, updateResolved, message, at)
+	delete(s.incidents, kind)
+	if _, err := db.Exec("UPDATE incidents SET resolved_at = ? WHERE id = ?", at.Format("2006-01-02 15:04:05"), incident.id); err != nil {
+		log.Println("[ERROR] ["+s.server.ID+"] Failed to resolve incident: ", err)
+	}
+}
+
+// addIncidentUpdate 在进行中的事件的时间线上追加一条记录，没有该类型的事件时不做任何事
+func (s *serverState) addIncidentUpdate(kind, updateKind, message string, at time.Time) {
+	incident, ok := s.incidents[kind]
+	if !ok {
+		return
+	}
+	if err := insertIncidentUpdate(db, incident.id, updateKind, message, at.Format("2006-01-02 15:04:05")); err != nil {
+		log.Println("[ERROR] ["+s.server.ID+"] Failed to add incident update: ", err)
+	}
+}
+
+// insertIncidentUpdate 在事件的时间线上追加一条记录，at 为数据库中的时间格式
+func insertIncidentUpdate(database execer, id int64, kind, message, at string) error {
+	_, err := database.Exec("INSERT INTO incident_updates (incident_id, time, kind, message) VALUES (?, ?, ?, ?)", id, at, kind, message)
+	return err
+}
+
+// observeIncidents 把进行中事件期间的变化追加到时间线：status 规则记录状态（degraded 时为原因类别）的变化，
+// 数值规则记录朝告警方向变化超过 10% 的新值
+func observeIncidents(state *serverState, live LiveState, at time.Time) {
+	for _, rule := range state.server.Rules {
+		incident, ok := state.incidents[rule.Name]
+		if !ok {
+			continue
+		}
+		if rule.Metric == "status" {
+			if note, _ := observation(rule.Metric, live); note != incident.note {
+				incident.note = note
+				text, _ := currentValue(rule.Metric, live)
+				state.addIncidentUpdate(rule.Name, updateObservation, text, at)
+			}
+			continue
+		}
+
+		value, ok := alertMetrics[rule.Metric].value(live)
+		if !ok {
+			continue
+		}
+		var worse bool
+		switch rule.Op {
+		case "<", "<=":
+			worse = value < incident.value-math.Abs(incident.value)*0.1
+		case ">", ">=":
+			worse = value > incident.value+math.Abs(incident.value)*0.1
+		}
+		if worse {
+			incident.value = value
+			text, _ := currentValue(rule.Metric, live)
+			state.addIncidentUpdate(rule.Name, updateObservation, text, at)
+		}
+	}
+}
+
+// reasonCategory 返回原因中第一个全角冒号之前的部分，例如 "RCON 认证失败"
+func reasonCategory(reason string) string {
+	return strings.SplitN(reason, "：", 2)[0]
+}
+
+// incidentFilter 是查询事件列表的条件，字段为空或零值时不作限制
+type incidentFilter struct {
+	server, kind, status string
+	since, until         time.Time
+	limit                int
+}
+
+// listIncidents 按开始时间倒序返回与 since 到 until 有重叠的事件，不含时间线
+func listIncidents(database *sql.DB, filter incidentFilter) ([]Incident, error) {
+	query := "SELECT " + incidentColumns + " FROM incidents WHERE 1 = 1"
+	var args []interface{}
+	if filter.server != "" {
+		// 没有指定服务器的管理员事件影响所有服务器
+		query += ` AND (server = ? OR id IN (SELECT incident_id FROM incident_servers WHERE server = ?)
+			OR (type = ? AND id NOT IN (SELECT incident_id FROM incident_servers)))`
+		args = append(args, filter.server, filter.server, incidentManual)
+	}
+	if filter.kind != "" {
+		query += " AND type = ?"
+		args = append(args, filter.kind)
+	}
+	switch filter.status {
+	case incidentOpen:
+		query += " AND resolved_at IS NULL"
+	case incidentResolved:
+		query += " AND resolved_at IS NOT NULL"
+	}
+	if !filter.since.IsZero() {
+		query += " AND (resolved_at IS NULL OR resolved_at >= ?)"
+		args = append(args, filter.since.Format("2006-01-02 15:04:05"))
+	}
+	if !filter.until.IsZero() {
+		query += " AND started_at <= ?"
+		args = append(args, filter.until.Format("2006-01-02 15:04:05"))
+	}
+	query += " ORDER BY started_at DESC, id DESC LIMIT ?"
+	args = append(args, filter.limit)
+
+	rows, err := database.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	incidents := []Incident{}
+	for rows.Next() {
+		incident, err := scanIncident(rows)
+		if err != nil {
+			return nil, err
+		}
+		incidents = append(incidents, incident)
+	}
+	return incidents, rows.Err()
+}
+
+// getIncident 返回事件及其完整的时间线
+func getIncident(database *sql.DB, id int64) (Incident, error) {
+	incident, err := scanIncident(database.QueryRow("SELECT "+incidentColumns+" FROM incidents WHERE id = ?", id))
+	if err != nil {
+		return incident, err
+	}
+
+	rows, err := database.Query("SELECT time, kind, message FROM incident_updates WHERE incident_id = ? ORDER BY time ASC, id ASC", id)
+	if err != nil {
+		return incident, err
+	}
+	defer rows.Close()
+
+	incident.Updates = []IncidentUpdate{}
+	for rows.Next() {
+		var update IncidentUpdate
+		if err := rows.Scan(&update.Time, &update.Kind, &update.Message); err != nil {
+			return incident, err
+		}
+		update.Time = localTime(update.Time)
+		incident.Updates = append(incident.Updates, update)
+	}
+	return incident, rows.Err()
+}
+
+// incidentColumns 是查询事件时读取的列，与 scanIncident 对应
+const incidentColumns = `id, server, type, title, COALESCE(severity, ''), started_at, resolved_at,
+	COALESCE((SELECT group_concat(server) FROM incident_servers WHERE incident_id = incidents.id), '')`
+
+// scanIncident 读取一行事件记录并计算状态与时长
+func scanIncident(row interface{ Scan(...interface{}) error }) (Incident, error) {
+	var incident Incident
+	var resolved sql.NullTime
+	var servers string
+	if err := row.Scan(&incident.ID, &incident.Server, &incident.Type, &incident.Title, &incident.Severity, &incident.StartedAt, &resolved, &servers); err != nil {
+		return incident, err
+	}
+	incident.Servers = []string{}
+	if incident.Server != "" {
+		incident.Servers = append(incident.Servers, incident.Server)
+	}
+	if servers != "" {
+		incident.Servers = append(incident.Servers, strings.Split(servers, ",")...)
+	}
+	incident.StartedAt = localTime(incident.StartedAt)
+	incident.Status = incidentOpen
+	end := time.Now()
+	if resolved.Valid {
+		t := localTime(resolved.Time)
+		incident.ResolvedAt, incident.Status, end = &t, incidentResolved, t
+	}
+	incident.Duration = int64(end.Sub(incident.StartedAt).Seconds())
+	return incident, nil
+}
+
+// handleIncidentRequest 处理 incidents、incident_detail 与 announcements 请求，返回 false 表示不是事件相关的请求
+//
+// announcements 返回进行中以及最近 24 小时内结束的管理员发布的事件，含完整时间线，供状态页展示；
+// incidents 的筛选参数：server、incident_type、status（open 或 resolved）、since 与 until（格式为 2006/01/02 15:04:05）
+// 以及 limit（缺省 50、最大 500）
+func handleIncidentRequest(w http.ResponseWriter, r *http.Request) bool {
+	queryParams := r.URL.Query()
+	switch queryParams.Get("type") {
+	case "incidents":
+		filter := incidentFilter{
+			server: queryParams.Get("server"),
+			kind:   queryParams.Get("incident_type"),
+			status: queryParams.Get("status"),
+		}
+		var ok bool
+		if filter.limit, ok = parseLimit(queryParams.Get("limit"), 50, 500); !ok {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return true
+		}
+		for param, target := range map[string]*time.Time{"since": &filter.since, "until": &filter.until} {
+			if value := queryParams.Get(param); value != "" {
+				t, err := time.ParseInLocation("2006/01/02 15:04:05", value, time.Local)
+				if err != nil {
+					http.Error(w, "Invalid "+param, http.StatusBadRequest)
+					return true
+				}
+				*target = t
+			}
+		}
+		incidents, err := listIncidents(db, filter)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return true
+		}
+		writeResponse(w, incidents)
+	case "incident_detail":
+		id, err := strconv.ParseInt(queryParams.Get("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid id", http.StatusBadRequest)
+			return true
+		}
+		incident, err := getIncident(db, id)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Unknown incident", http.StatusNotFound)
+			return true
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return true
+		}
+		writeResponse(w, incident)
+	case "announcements":
+		incidents, err := listIncidents(db, incidentFilter{kind: incidentManual, since: time.Now().Add(-24 * time.Hour), limit: 20})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return true
+		}
+		for i := range incidents {
+			if incidents[i], err = getIncident(db, incidents[i].ID); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return true
+			}
+		}
+		writeResponse(w, incidents)
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,250 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// leaderboardTTL 是排行榜缓存的有效期，期间相同参数的请求直接返回缓存，不再查询数据库
+const leaderboardTTL = time.Minute
+
+// LeaderboardEntry 是排行榜中的一名玩家，Value 的含义由所在榜单决定：
+// 在线时长与最长会话为秒数，活跃天数与常驻玩家为天数
+type LeaderboardEntry struct {
+	Rank   int    `json:"rank"`
+	Player string `json:"player"`
+	Value  int64  `json:"value"`
+}
+
+// Leaderboards 是一台服务器在统计时段内的各项排行
+//
+// Regulars 统计最近 RegularDays 天中至少有 RegularMinDays 天上线的玩家，与统计时段无关
+type Leaderboards struct {
+	Server         string             `json:"server"`
+	Window         string             `json:"window"`
+	Since          *time.Time         `json:"since"`
+	GeneratedAt    time.Time          `json:"generated_at"`
+	Playtime       []LeaderboardEntry `json:"playtime"`
+	DaysActive     []LeaderboardEntry `json:"days_active"`
+	LongestSession []LeaderboardEntry `json:"longest_session"`
+	RegularDays    int                `json:"regular_days"`
+	RegularMinDays int                `json:"regular_min_days"`
+	Regulars       []LeaderboardEntry `json:"regulars"`
+}
+
+// leaderboardCache 按请求参数缓存排行榜
+var leaderboardCache = struct {
+	mu      sync.Mutex
+	entries map[string]Leaderboards
+}{entries: map[string]Leaderboards{}}
+
+// leaderboardSince 解析统计时段：week 为本周一零点起，month 为本月一日零点起，
+// all 为全部记录（返回零值），其余按 parseRange 解析为最近一段时间；自然日按 location 划分
+func leaderboardSince(window string, now time.Time, location *time.Location) (time.Time, bool) {
+	now = now.In(location)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location)
+	switch window {
+	case "week":
+		return today.AddDate(0, 0, -(int(today.Weekday())+6)%7), true
+	case "month":
+		return today.AddDate(0, 0, 1-today.Day()), true
+	case "all":
+		return time.Time{}, true
+	}
+	duration, ok := parseRange(window, 0)
+	if !ok {
+		return time.Time{}, false
+	}
+	return now.Add(-duration), true
+}
+
+// LeaderboardsHandler 处理 /api/v1/leaderboards 请求
+//
+// 参数 server 指定服务器（缺省为第一台），window 为 week（缺省）、month、all 或形如 72h 的时间范围，
+// limit 为每个榜单的条数（缺省 10、最大 100），days 与 min_days 为常驻玩家的统计天数与最少上线天数（缺省 7 与 4）
+func LeaderboardsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	queryParams := r.URL.Query()
+	state, ok := lookupServer(r)
+	if !ok {
+		http.Error(w, "Unknown server", http.StatusNotFound)
+		return
+	}
+	window := queryParams.Get("window")
+	if window == "" {
+		window = "week"
+	}
+	now := time.Now()
+	since, ok := leaderboardSince(window, now, GlobalConfig.Web.Location)
+	if !ok {
+		http.Error(w, "Invalid window", http.StatusBadRequest)
+		return
+	}
+	limit, ok := parseLimit(queryParams.Get("limit"), 10, 100)
+	if !ok {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+	days, ok := parseLimit(queryParams.Get("days"), 7, 366)
+	if !ok {
+		http.Error(w, "Invalid days", http.StatusBadRequest)
+		return
+	}
+	minDays, ok := parseLimit(queryParams.Get("min_days"), 4, days)
+	if !ok {
+		http.Error(w, "Invalid min_days", http.StatusBadRequest)
+		return
+	}
+
+	key := state.server.ID + "|" + window + "|" + strconv.Itoa(limit) + "|" + strconv.Itoa(days) + "|" + strconv.Itoa(minDays)
+	leaderboardCache.mu.Lock()
+	cached, ok := leaderboardCache.entries[key]
+	leaderboardCache.mu.Unlock()
+	if ok && now.Sub(cached.GeneratedAt) < leaderboardTTL {
+		writeResponse(w, cached)
+		return
+	}
+
+	boards, err := getLeaderboards(db, state.server.ID, since, now, GlobalConfig.Web.Location, limit, days, minDays)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	boards.Window = window
+
+	leaderboardCache.mu.Lock()
+	// 顺带清理过期的缓存，避免参数组合过多时无限增长
+	for k, entry := range leaderboardCache.entries {
+		if now.Sub(entry.GeneratedAt) >= leaderboardTTL {
+			delete(leaderboardCache.entries, k)
+		}
+	}
+	leaderboardCache.entries[key] = boards
+	leaderboardCache.mu.Unlock()
+
+	writeResponse(w, boards)
+}
+
+// getLeaderboards 从 sessions 表统计各项排行，跨越统计时段起点的会话只计算起点之后的部分；
+// 进行中的会话计算到 now。活跃天数与常驻玩家按 location 的自然日统计
+func getLeaderboards(database *sql.DB, server string, since, now time.Time, location *time.Location, limit, days, minDays int) (Leaderboards, error) {
+	boards := Leaderboards{Server: server, GeneratedAt: now, RegularDays: days, RegularMinDays: minDays}
+	if !since.IsZero() {
+		boards.Since = &since
+	}
+
+	now = now.In(location)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location)
+	regularSince := today.AddDate(0, 0, 1-days)
+	from := since
+	if regularSince.Before(from) {
+		from = regularSince
+	}
+
+	rows, err := database.Query(`SELECT player, start_time, end_time FROM sessions
+		WHERE server = ? AND (end_time IS NULL OR end_time > ?)`, server, from.Local().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return boards, err
+	}
+	defer rows.Close()
+
+	playtime := map[string]int64{}
+	longest := map[string]int64{}
+	activeDays := map[string]map[string]bool{}
+	regularDays := map[string]map[string]bool{}
+	for rows.Next() {
+		var player string
+		var start time.Time
+		var end sql.NullTime
+		if err := rows.Scan(&player, &start, &end); err != nil {
+			return boards, err
+		}
+		start = localTime(start).In(location)
+		stop := now
+		if end.Valid {
+			stop = localTime(end.Time).In(location)
+		}
+
+		if stop.After(since) {
+			clipped := start
+			if clipped.Before(since) {
+				clipped = since
+			}
+			duration := int64(stop.Sub(clipped).Seconds())
+			playtime[player] += duration
+			if duration > longest[player] {
+				longest[player] = duration
+			}
+			addDays(activeDays, player, clipped, stop)
+		}
+		if stop.After(regularSince) {
+			clipped := start
+			if clipped.Before(regularSince) {
+				clipped = regularSince
+			}
+			addDays(regularDays, player, clipped, stop)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return boards, err
+	}
+
+	boards.Playtime = rank(playtime, limit)
+	boards.LongestSession = rank(longest, limit)
+	boards.DaysActive = rank(countDays(activeDays, 1), limit)
+	boards.Regulars = rank(countDays(regularDays, minDays), limit)
+	return boards, nil
+}
+
+// addDays 把 start 到 stop 之间经过的每个自然日记为玩家的上线日
+func addDays(days map[string]map[string]bool, player string, start, stop time.Time) {
+	if days[player] == nil {
+		days[player] = map[string]bool{}
+	}
+	day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, start.Location())
+	for ; !day.After(stop); day = day.AddDate(0, 0, 1) {
+		days[player][day.Format("2006-01-02")] = true
+	}
+}
+
+// countDays 返回上线天数不少于 min 的玩家及其上线天数
+func countDays(days map[string]map[string]bool, min int) map[string]int64 {
+	counts := map[string]int64{}
+	for player, set := range days {
+		if len(set) >= min {
+			counts[player] = int64(len(set))
+		}
+	}
+	return counts
+}
+
+// rank 按数值从大到小排出前 limit 名，数值相同的玩家并列同一名次，按名称排序
+func rank(values map[string]int64, limit int) []LeaderboardEntry {
+	entries := make([]LeaderboardEntry, 0, len(values))
+	for player, value := range values {
+		if value > 0 {
+			entries = append(entries, LeaderboardEntry{Player: player, Value: value})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Value != entries[j].Value {
+			return entries[i].Value > entries[j].Value
+		}
+		return entries[i].Player < entries[j].Player
+	})
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	for i := range entries {
+		entries[i].Rank = i + 1
+		if i > 0 && entries[i].Value == entries[i-1].Value {
+			entries[i].Rank = entries[i-1].Rank
+		}
+	}
+	return entries
+}
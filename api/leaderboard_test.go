@@ -0,0 +1,114 @@
+package api
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+// insertSession 写入一段会话，时间与 sessionTracker 一样按本地时间保存，end 为零值表示仍在进行
+func insertSession(t *testing.T, database *sql.DB, player string, start, end time.Time) {
+	t.Helper()
+	var endTime any
+	lastSeen := start
+	if !end.IsZero() {
+		endTime = end.Local().Format("2006-01-02 15:04:05")
+		lastSeen = end
+	}
+	_, err := database.Exec("INSERT INTO sessions (server, player, start_time, end_time, last_seen) VALUES (?, ?, ?, ?, ?)",
+		"test", player, start.Local().Format("2006-01-02 15:04:05"), endTime, lastSeen.Local().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLeaderboardSince(t *testing.T) {
+	setLocal(t, time.FixedZone("UTC-5", -5*60*60))
+	shanghai := time.FixedZone("Asia/Shanghai", 8*60*60)
+	// 本地时间周日 2025-03-02 20:00，上海已是周一 03-03 09:00
+	now := time.Date(2025, 3, 2, 20, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		window string
+		want   time.Time
+		ok     bool
+	}{
+		{"week", time.Date(2025, 3, 3, 0, 0, 0, 0, shanghai), true},
+		{"month", time.Date(2025, 3, 1, 0, 0, 0, 0, shanghai), true},
+		{"all", time.Time{}, true},
+		{"72h", now.Add(-72 * time.Hour), true},
+		{"year", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := leaderboardSince(tt.window, now, shanghai)
+		if ok != tt.ok || !got.Equal(tt.want) {
+			t.Errorf("%s: got %s, %v, want %s, %v", tt.window, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// TestLeaderboardDaysInLocation 中跨过上海午夜、但未跨过本地午夜的会话应计为两个上线日
+func TestLeaderboardDaysInLocation(t *testing.T) {
+	setLocal(t, time.FixedZone("UTC-5", -5*60*60))
+	shanghai := time.FixedZone("Asia/Shanghai", 8*60*60)
+	database := openTestDB(t)
+
+	// 本地时间 03-01 10:00 至 12:00，即上海时间 03-01 23:00 至 03-02 01:00
+	insertSession(t, database, "Steve", time.Date(2025, 3, 1, 10, 0, 0, 0, time.Local), time.Date(2025, 3, 1, 12, 0, 0, 0, time.Local))
+	// 本地时间 03-01 13:00 至 14:00，即上海时间 03-02 02:00 至 03:00
+	insertSession(t, database, "Alex", time.Date(2025, 3, 1, 13, 0, 0, 0, time.Local), time.Date(2025, 3, 1, 14, 0, 0, 0, time.Local))
+	// 仍在进行的会话计算到 now
+	now := time.Date(2025, 3, 1, 20, 0, 0, 0, time.Local)
+	insertSession(t, database, "Herobrine", now.Add(-3*time.Hour), time.Time{})
+
+	since := time.Date(2025, 3, 1, 0, 0, 0, 0, shanghai)
+	boards, err := getLeaderboards(database, "test", since, now, shanghai, 10, 7, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkEntries(t, "playtime", boards.Playtime, []LeaderboardEntry{
+		{Rank: 1, Player: "Herobrine", Value: 3 * 3600},
+		{Rank: 2, Player: "Steve", Value: 2 * 3600},
+		{Rank: 3, Player: "Alex", Value: 3600},
+	})
+	checkEntries(t, "days_active", boards.DaysActive, []LeaderboardEntry{
+		{Rank: 1, Player: "Steve", Value: 2},
+		{Rank: 2, Player: "Alex", Value: 1},
+		{Rank: 2, Player: "Herobrine", Value: 1},
+	})
+	checkEntries(t, "regulars", boards.Regulars, []LeaderboardEntry{
+		{Rank: 1, Player: "Steve", Value: 2},
+	})
+}
+
+// TestLeaderboardClipsSince 中跨越统计时段起点的会话只计算起点之后的部分
+func TestLeaderboardClipsSince(t *testing.T) {
+	database := openTestDB(t)
+	insertSession(t, database, "Steve", at(-2*time.Hour), at(time.Hour))
+	insertSession(t, database, "Alex", at(-3*time.Hour), at(-time.Hour))
+
+	boards, err := getLeaderboards(database, "test", t0, at(2*time.Hour), time.Local, 10, 7, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEntries(t, "playtime", boards.Playtime, []LeaderboardEntry{{Rank: 1, Player: "Steve", Value: 3600}})
+	checkEntries(t, "longest_session", boards.LongestSession, []LeaderboardEntry{{Rank: 1, Player: "Steve", Value: 3600}})
+	if len(boards.Regulars) != 2 {
+		t.Errorf("got regulars %+v, want both players", boards.Regulars)
+	}
+}
+
+func checkEntries(t *testing.T, board string, got, want []LeaderboardEntry) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("%s: got %+v, want %+v", board, got, want)
+		return
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("%s: got %+v, want %+v", board, got, want)
+			return
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"database/sql"
+	"math"
+	"sort"
+	"time"
+)
+
+// Percentiles 是一组数据的中位数、P95、P99 与最大值
+type Percentiles struct {
+	P50 float64 `json:"p50"`
+	P95 float64 `json:"p95"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+// TickStats 是一段时间内 tick 耗时（毫秒）的分布，Avg 基于每次记录的 10 秒平均值，Max 基于 10 秒最大值
+type TickStats struct {
+	Since   time.Time   `json:"since"`
+	Samples int         `json:"samples"`
+	Avg     Percentiles `json:"avg"`
+	Max     Percentiles `json:"max"`
+}
+
+// getTickStats 统计 since 之后记录的 tick 耗时分位数，未采集 MSPT 的记录不参与统计
+func getTickStats(database *sql.DB, server string, since time.Time) (TickStats, error) {
+	stats := TickStats{Since: since}
+	rows, err := database.Query(`SELECT mspt, mspt_max FROM data
+		WHERE server = ? AND time_index > ? AND mspt IS NOT NULL`, server, since.Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return stats, err
+	}
+	defer rows.Close()
+
+	var avgs, maxes []float64
+	for rows.Next() {
+		var avg, max float64
+		if err := rows.Scan(&avg, &max); err != nil {
+			return stats, err
+		}
+		avgs = append(avgs, avg)
+		maxes = append(maxes, max)
+	}
+	if err := rows.Err(); err != nil {
+		return stats, err
+	}
+
+	stats.Samples = len(avgs)
+	stats.Avg = percentiles(avgs)
+	stats.Max = percentiles(maxes)
+	return stats, nil
+}
+
+// percentiles 按最近秩法计算分位数，values 会被排序
+func percentiles(values []float64) Percentiles {
+	if len(values) == 0 {
+		return Percentiles{}
+	}
+	sort.Float64s(values)
+	rank := func(p float64) float64 {
+		i := int(math.Ceil(p*float64(len(values)))) - 1
+		if i < 0 {
+			i = 0
+		}
+		return values[i]
+	}
+	return Percentiles{P50: rank(0.50), P95: rank(0.95), P99: rank(0.99), Max: values[len(values)-1]}
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"github.com/MeowLynxSea/Uptimeow/config"
+	"net/http"
+	"slices"
+)
+
+// 群组服的可用性
+const (
+	networkOperational = "operational"
+	networkPartial     = "partial_outage"
+	networkMajorOutage = "major_outage"
+)
+
+// NetworkInfo 是群组服的汇总状态与各后端服务器的明细
+type NetworkInfo struct {
+	NetworkID   string `json:"network_id"`
+	NetworkName string `json:"network_name"`
+	// Availability 为 operational（全部在线）、partial_outage（代理在线但有后端离线）
+	// 或 major_outage（代理离线）
+	Availability string `json:"availability"`
+	// OnlinePlayer 为代理上的玩家数，代理未上报玩家数时为后端玩家数之和
+	OnlinePlayer int `json:"online_player"`
+	MaxPlayer    int `json:"max_player"`
+	// BackendPlayer 为所有在线后端的玩家数之和
+	BackendPlayer  int             `json:"backend_player"`
+	OnlineBackends int             `json:"online_backends"`
+	TotalBackends  int             `json:"total_backends"`
+	Proxy          ServerSummary   `json:"proxy"`
+	Backends       []ServerSummary `json:"backends"`
+}
+
+func summarize(server config.ServerConfig) ServerSummary {
+	return ServerSummary{
+		ServerID:      server.ID,
+		ServerName:    server.ServerInfo.Name,
+		ServerAddress: server.ServerInfo.Address,
+		LiveState:     states[server.ID].snapshot(),
+	}
+}
+
+// buildNetworkInfo 根据各成员服务器的实时状态汇总群组服状态
+func buildNetworkInfo(network config.NetworkConfig) NetworkInfo {
+	proxy, _ := GlobalConfig.Server(network.Proxy)
+	info := NetworkInfo{
+		NetworkID:     network.ID,
+		NetworkName:   network.Name,
+		Proxy:         summarize(proxy),
+		Backends:      []ServerSummary{},
+		TotalBackends: len(network.Backends),
+	}
+
+	for _, id := range network.Backends {
+		backend, _ := GlobalConfig.Server(id)
+		summary := summarize(backend)
+		if summary.IsOnline {
+			info.OnlineBackends++
+			info.BackendPlayer += summary.OnlinePlayer
+		}
+		info.Backends = append(info.Backends, summary)
+	}
+
+	info.OnlinePlayer, info.MaxPlayer = info.Proxy.OnlinePlayer, info.Proxy.MaxPlayer
+	if info.OnlinePlayer == 0 && info.BackendPlayer > 0 {
+		info.OnlinePlayer = info.BackendPlayer
+	}
+
+	switch {
+	case !info.Proxy.IsOnline:
+		info.Availability = networkMajorOutage
+		info.OnlinePlayer = 0
+	case info.OnlineBackends < info.TotalBackends:
+		info.Availability = networkPartial
+	default:
+		info.Availability = networkOperational
+	}
+	return info
+}
+
+// handleNetworkRequest 处理 network_list 与 network_info 请求，返回 false 表示不是群组服相关的请求
+func handleNetworkRequest(w http.ResponseWriter, r *http.Request) bool {
+	switch r.URL.Query().Get("type") {
+	case "network_list":
+		networks := make([]NetworkInfo, 0, len(GlobalConfig.Networks))
+		for _, network := range GlobalConfig.Networks {
+			networks = append(networks, buildNetworkInfo(network))
+		}
+		writeResponse(w, networks)
+	case "network_info":
+		network, ok := GlobalConfig.Network(r.URL.Query().Get("network"))
+		if !ok {
+			http.Error(w, "Unknown network", http.StatusNotFound)
+			return true
+		}
+		writeResponse(w, buildNetworkInfo(network))
+	default:
+		return false
+	}
+	return true
+}
+
+// isOfflineRule 判断规则是否为服务器离线告警
+func isOfflineRule(rule config.AlertRule) bool {
+	return rule.Metric == "status" && rule.Op == "==" && rule.Value == statusOffline
+}
+
+// networkRule 把群组服成员的离线告警区分为代理离线与子服离线：代理离线时整个群组服不可用，为 critical；
+// 子服离线时其余子服仍可进入，为 warning。其余规则原样返回
+func networkRule(serverID string, rule config.AlertRule) config.AlertRule {
+	if !isOfflineRule(rule) {
+		return rule
+	}
+	for _, network := range GlobalConfig.Networks {
+		if network.Proxy == serverID {
+			rule.Title, rule.Severity = "群组服 "+network.Name+" 代理离线", config.SeverityCritical
+			return rule
+		}
+		if slices.Contains(network.Backends, serverID) {
+			rule.Title, rule.Severity = "群组服 "+network.Name+" 子服离线", config.SeverityWarning
+			return rule
+		}
+	}
+	return rule
+}
+
+// networkSuppression 在子服所属群组服的代理离线告警进行中时返回原因：此时整个群组服不可用，
+// 只推送代理离线，子服的离线告警不单独推送，代理恢复后仍离线的子服照常补推
+func networkSuppression(server config.ServerConfig, rule string) string {
+	index := slices.IndexFunc(server.Rules, func(r config.AlertRule) bool { return r.Name == rule })
+	if index < 0 || !isOfflineRule(server.Rules[index]) {
+		return ""
+	}
+	for _, network := range GlobalConfig.Networks {
+		proxy, ok := states[network.Proxy]
+		if !ok || !slices.Contains(network.Backends, server.ID) {
+			continue
+		}
+		for _, proxyRule := range proxy.server.Rules {
+			if alert, ok := proxy.alerts[proxyRule.Name]; ok && alert.firing && isOfflineRule(proxyRule) {
+				return "群组服 " + network.Name + " 的代理离线中"
+			}
+		}
+	}
+	return ""
+}
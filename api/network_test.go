@@ -0,0 +1,228 @@
+package api
+
+import (
+	"github.com/MeowLynxSea/Uptimeow/config"
+	"slices"
+	"testing"
+	"time"
+)
+
+// useTestDB 在测试期间把 db 换为临时数据库，并建立事件表
+func useTestDB(t *testing.T) {
+	database := openTestDB(t)
+	if err := migrateIncidents(database); err != nil {
+		t.Fatal(err)
+	}
+	db = database
+	t.Cleanup(func() { db = nil })
+}
+
+// setupNetwork 在测试期间使用群组服 MeowNet：代理 proxy，子服 lobby 与 survival，均启用离线告警；
+// 返回的状态按 lobby、survival、proxy 排列，与配置中子服排在代理之前时的检查顺序相同
+func setupNetwork(t *testing.T, rules []config.AlertRule) []*serverState {
+	global, saved := GlobalConfig, states
+	t.Cleanup(func() { GlobalConfig, states = global, saved })
+
+	GlobalConfig.Networks = []config.NetworkConfig{{ID: "meownet", Name: "MeowNet", Proxy: "proxy", Backends: []string{"lobby", "survival"}}}
+	GlobalConfig.Servers = nil
+	states = map[string]*serverState{}
+	var members []*serverState
+	for _, id := range []string{"lobby", "survival", "proxy"} {
+		state := testState(id)
+		state.server.Rules = rules
+		GlobalConfig.Servers = append(GlobalConfig.Servers, state.server)
+		states[id] = state
+		members = append(members, state)
+	}
+	return members
+}
+
+// withStatus 返回指定状态的实时状态
+func withStatus(status string) LiveState {
+	return LiveState{IsOnline: status == statusOnline, Status: status}
+}
+
+// tickNetwork 与 saveCron 一样依次检查各成员的告警并推送分组，statuses 中未列出的成员为 online；
+// 返回推送的消息，见 sentMessages
+func tickNetwork(members []*serverState, queue chan notificationJob, now time.Time, statuses map[string]string) []string {
+	for _, state := range members {
+		status, ok := statuses[state.server.ID]
+		if !ok {
+			status = statusOnline
+		}
+		checkAlerts(state, withStatus(status), now)
+	}
+	flushAlertGroups(now)
+	return sentMessages(queue)
+}
+
+// TestNetworkAlertsGrouped 检查群组服的离线告警与其他告警一样分组推送、升级，代理离线期间子服的离线告警不单独推送
+func TestNetworkAlertsGrouped(t *testing.T) {
+	useTestDB(t)
+	queue := captureNotifications(t)
+	setRoute(t, config.Route{
+		Receivers:      []string{"ops"},
+		GroupBy:        []string{"server"},
+		RepeatInterval: time.Hour,
+		Escalations:    []config.Escalation{{After: 30 * time.Minute, Receivers: []string{"lead"}}},
+	})
+	members := setupNetwork(t, config.WarnTypes{Offline: true}.Rules())
+
+	down := func(ids ...string) map[string]string {
+		statuses := map[string]string{}
+		for _, id := range ids {
+			statuses[id] = statusOffline
+		}
+		return statuses
+	}
+	steps := []struct {
+		at       time.Duration
+		statuses map[string]string
+		want     []string
+	}{
+		{0, nil, nil},
+		{10 * time.Second, down("survival"), []string{"ops 【警告】群组服 MeowNet 子服离线"}},
+		// lobby 先于代理检查，此时代理尚未告警，在推送前移出分组
+		{20 * time.Second, down("survival", "lobby", "proxy"), []string{"ops 【紧急】群组服 MeowNet 代理离线"}},
+		// 代理离线期间子服的告警不升级
+		{30*time.Minute + 10*time.Second, down("survival", "lobby", "proxy"), nil},
+		{30*time.Minute + 20*time.Second, down("survival", "lobby", "proxy"), []string{"lead 【升级】告警已持续 30m0s 未恢复"}},
+		{40 * time.Minute, down("survival", "lobby"), []string{
+			"lead 【升级】告警已持续 30m0s 未恢复",
+			"ops,lead 【恢复】群组服 MeowNet 代理离线已恢复",
+		}},
+		// 代理恢复后仍离线的子服补推
+		{40*time.Minute + 10*time.Second, down("survival", "lobby"), []string{"ops 【警告】群组服 MeowNet 子服离线"}},
+		{41 * time.Minute, down("lobby"), []string{"ops,lead 【恢复】群组服 MeowNet 子服离线已恢复"}},
+		{time.Hour + 10*time.Minute + 10*time.Second, down("lobby"), []string{"lead 【升级】告警已持续 30m0s 未恢复"}},
+		{time.Hour + 40*time.Minute + 10*time.Second, down("lobby"), []string{"ops,lead 【未恢复】群组服 MeowNet 子服离线仍未恢复"}},
+	}
+	for _, step := range steps {
+		got := tickNetwork(members, queue, at(step.at), step.statuses)
+		if !slices.Equal(got, step.want) {
+			t.Errorf("%s: got %q, want %q", step.at, got, step.want)
+		}
+	}
+
+	// 事件标题同样区分代理与子服
+	if _, ok := members[2].incidents["offline"]; ok {
+		t.Error("proxy incident still open")
+	}
+	var title, severity string
+	if err := db.QueryRow("SELECT title, severity FROM incidents WHERE server = 'lobby'").Scan(&title, &severity); err != nil {
+		t.Fatal(err)
+	}
+	if title != "群组服 MeowNet 子服离线" || severity != config.SeverityWarning {
+		t.Errorf("got lobby incident %q (%s)", title, severity)
+	}
+}
+
+// setStatus 设置成员的探测结果：online 与 degraded（响应缓慢）时在线 players 人，
+// offline 为主探测方式失败，unreachable 为尚无探测结果
+func setStatus(state *serverState, status string, players int) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.resetLocked()
+	state.primaryFailedAt, state.primaryReason, state.slowAt = time.Time{}, "", time.Time{}
+	switch status {
+	case statusOnline, statusDegraded:
+		state.isOnline, state.onlinePlayer, state.maxPlayer = true, players, 100
+		if status == statusDegraded {
+			state.slowAt, state.slowReason = time.Now(), "响应缓慢"
+		}
+	case statusOffline:
+		state.primaryFailedAt, state.primaryReason = time.Now(), "connection refused"
+	}
+}
+
+// memberStatus 是一个成员的状态与在线人数
+type memberStatus struct {
+	status  string
+	players int
+}
+
+func TestBuildNetworkInfo(t *testing.T) {
+	online := func(players int) memberStatus { return memberStatus{statusOnline, players} }
+	tests := []struct {
+		name                   string
+		proxy, lobby, survival memberStatus
+		availability           string
+		onlinePlayer, backend  int
+		onlineBackends         int
+	}{
+		{"operational", online(30), online(10), online(20), networkOperational, 30, 30, 2},
+		// 代理上的玩家数可能与子服之和不同（如正在切换子服），以代理为准
+		{"proxy count wins", online(31), online(10), online(20), networkOperational, 31, 30, 2},
+		{"proxy without count", online(0), online(10), online(20), networkOperational, 30, 30, 2},
+		{"degraded backend", online(30), memberStatus{statusDegraded, 10}, online(20), networkOperational, 30, 30, 2},
+		{"backend offline", online(20), memberStatus{statusOffline, 0}, online(20), networkPartial, 20, 20, 1},
+		{"backend unreachable", online(0), memberStatus{statusUnreachable, 0}, online(20), networkPartial, 20, 20, 1},
+		{"proxy offline", memberStatus{statusOffline, 0}, online(10), online(20), networkMajorOutage, 0, 30, 2},
+		{"all offline", memberStatus{statusOffline, 0}, memberStatus{statusOffline, 0}, memberStatus{statusOffline, 0}, networkMajorOutage, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			members := setupNetwork(t, nil)
+			setStatus(members[0], tt.lobby.status, tt.lobby.players)
+			setStatus(members[1], tt.survival.status, tt.survival.players)
+			setStatus(members[2], tt.proxy.status, tt.proxy.players)
+
+			info := buildNetworkInfo(GlobalConfig.Networks[0])
+			if info.Availability != tt.availability || info.OnlinePlayer != tt.onlinePlayer || info.BackendPlayer != tt.backend ||
+				info.OnlineBackends != tt.onlineBackends || info.TotalBackends != 2 {
+				t.Errorf("got %s, %d players (%d on backends), %d/%d backends online, want %s, %d (%d), %d/2",
+					info.Availability, info.OnlinePlayer, info.BackendPlayer, info.OnlineBackends, info.TotalBackends,
+					tt.availability, tt.onlinePlayer, tt.backend, tt.onlineBackends)
+			}
+			if info.Proxy.ServerID != "proxy" || len(info.Backends) != 2 || info.Backends[0].ServerID != "lobby" || info.Backends[1].Status != tt.survival.status {
+				t.Errorf("got proxy %s and backends %+v", info.Proxy.ServerID, info.Backends)
+			}
+		})
+	}
+}
+
+// TestNetworkAlertSplit 检查代理离线与子服离线分别告警，代理离线时子服的离线告警不单独推送；
+// 代理未启用离线告警时子服照常告警
+func TestNetworkAlertSplit(t *testing.T) {
+	offline := config.WarnTypes{Offline: true}.Rules()
+	tests := []struct {
+		name       string
+		proxyRules []config.AlertRule
+		down       []string
+		want       []string
+	}{
+		{"backend", offline, []string{"survival"}, []string{"ops 【警告】群组服 MeowNet 子服离线"}},
+		{"backends", offline, []string{"lobby", "survival"}, []string{"ops 【警告】告警汇总：新增 2 项，未恢复 2 项"}},
+		{"proxy", offline, []string{"proxy"}, []string{"ops 【紧急】群组服 MeowNet 代理离线"}},
+		{"proxy and backend", offline, []string{"proxy", "survival"}, []string{"ops 【紧急】群组服 MeowNet 代理离线"}},
+		{"proxy alert disabled", nil, []string{"proxy", "survival"}, []string{"ops 【警告】群组服 MeowNet 子服离线"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestDB(t)
+			queue := captureNotifications(t)
+			setRoute(t, config.Route{Receivers: []string{"ops"}})
+			members := setupNetwork(t, offline)
+			members[2].server.Rules = tt.proxyRules
+
+			for _, state := range members {
+				status := statusOnline
+				if slices.Contains(tt.down, state.server.ID) {
+					status = statusOffline
+				}
+				setStatus(state, status, 0)
+				checkAlerts(state, state.snapshot(), at(0))
+			}
+			flushAlertGroups(at(0))
+			if got := sentMessages(queue); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			for _, state := range members {
+				_, open := state.incidents["offline"]
+				if want := slices.Contains(tt.down, state.server.ID) && len(state.server.Rules) > 0; open != want {
+					t.Errorf("%s: incident open %v, want %v", state.server.ID, open, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"github.com/MeowLynxSea/Uptimeow/config"
+	"github.com/MeowLynxSea/Uptimeow/internal/notify"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// notificationTimeout 是推送一条消息到一个渠道的最长时间
+	notificationTimeout = 15 * time.Second
+	// notificationQueueSize 是等待推送的消息数上限，队列已满时丢弃新的消息
+	notificationQueueSize = 256
+)
+
+// notificationChannel 是已创建的通知渠道
+type notificationChannel struct {
+	config.NotificationChannel
+	notifier notify.Notifier
+}
+
+// notificationChannels 为配置中的通知渠道，按配置顺序排列
+var notificationChannels []notificationChannel
+
+// notificationJob 是等待推送的一条消息，done 在推送后以推送成功的渠道调用（没有成功的渠道时不调用），可以为空
+type notificationJob struct {
+	receivers []string
+	msg       notify.Message
+	done      func(delivered []string)
+}
+
+// notificationQueue 中的消息由 runNotificationQueue 按入队顺序逐条推送，
+// 使保存数据的定时任务不必等待网络请求
+var notificationQueue = make(chan notificationJob, notificationQueueSize)
+
+// Notification 是通知日志中的一条记录，Error 为推送失败的原因
+type Notification struct {
+	ID       int64     `json:"id"`
+	Time     time.Time `json:"time"`
+	Channel  string    `json:"channel"`
+	Kind     string    `json:"kind"`
+	Severity string    `json:"severity"`
+	Servers  []string  `json:"servers"`
+	Title    string    `json:"title"`
+	Success  bool      `json:"success"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// setupNotificationChannels 按配置创建通知渠道，渠道类型未知或缺少必要字段时返回错误
+func setupNotificationChannels(channels []config.NotificationChannel) error {
+	for _, channel := range channels {
+		notifier, err := notify.New(channel)
+		if err != nil {
+			return err
+		}
+		notificationChannels = append(notificationChannels, notificationChannel{channel, notifier})
+	}
+	return nil
+}
+
+// migrateNotifications 创建 notifications 表，记录每个渠道每条消息的推送结果
+func migrateNotifications(database *sql.DB) error {
+	_, err := database.Exec(`
+	CREATE TABLE IF NOT EXISTS notifications (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		time DATETIME NOT NULL,
+		channel TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		severity TEXT NOT NULL,
+		servers TEXT NOT NULL,
+		title TEXT NOT NULL,
+		success BOOLEAN NOT NULL,
+		error TEXT
+	);
+	CREATE INDEX IF NOT EXISTS notifications_time ON notifications (time);
+	`)
+	return err
+}
+
+// matchedRoute 是告警匹配到的路由节点，id 为节点在路由树中的路径，用于区分告警分组
+type matchedRoute struct {
+	id    string
+	route *config.Route
+}
+
+// matchRoutes 在路由树中查找匹配的节点，见 config.Route
+func matchRoutes(route *config.Route, id string, servers []string, rule, severity string) []matchedRoute {
+	if !route.Match.Matches(servers, rule, severity) {
+		return nil
+	}
+	var matched []matchedRoute
+	for i := range route.Routes {
+		child := &route.Routes[i]
+		result := matchRoutes(child, id+"."+strconv.Itoa(i), servers, rule, severity)
+		matched = append(matched, result...)
+		if len(result) > 0 && !child.Continue {
+			break
+		}
+	}
+	if len(matched) == 0 {
+		return []matchedRoute{{id, route}}
+	}
+	return matched
+}
+
+// sendNotification 把不参与分组的消息（如监控上线、事件公告、抖动通知）放入推送队列，按路由树选择渠道，
+// rule 为消息对应的告警规则，没有时为空；done 见 notificationJob
+func sendNotification(msg notify.Message, rule string, done func(delivered []string)) {
+	var receivers []string
+	for _, matched := range matchRoutes(&GlobalConfig.Warn.Route, "root", msg.Servers, rule, msg.Severity) {
+		receivers = append(receivers, matched.route.Receivers...)
+	}
+	enqueueNotification(receivers, msg, done)
+}
+
+// enqueueNotification 把消息放入推送队列，不等待推送完成
+func enqueueNotification(receivers []string, msg notify.Message, done func(delivered []string)) {
+	if msg.Time.IsZero() {
+		msg.Time = time.Now()
+	}
+	select {
+	case notificationQueue <- notificationJob{receivers, msg, done}:
+	default:
+		log.Println("[ERROR] 通知队列已满，丢弃消息[" + msg.Title + "]")
+	}
+}
+
+// runNotificationQueue 逐条推送队列中的消息，在 Start 中启动
+func runNotificationQueue() {
+	for job := range notificationQueue {
+		delivered := deliverAll(job.receivers, job.msg)
+		if job.done != nil && len(delivered) > 0 {
+			job.done(delivered)
+		}
+	}
+}
+
+// deliverAll 把消息并行推送到 receivers 中按严重程度与服务器接受该消息的渠道，重复的渠道只推送一次，
+// 返回推送成功的渠道名称
+func deliverAll(receivers []string, msg notify.Message) []string {
+	if msg.Time.IsZero() {
+		msg.Time = time.Now()
+	}
+	var matched []notificationChannel
+	for _, channel := range notificationChannels {
+		if slices.Contains(receivers, channel.Name) && channel.Accepts(msg.Severity, msg.Servers) {
+			matched = append(matched, channel)
+		}
+	}
+
+	results := make([]error, len(matched))
+	var wg sync.WaitGroup
+	for i, channel := range matched {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = deliver(channel, msg)
+		}()
+	}
+	wg.Wait()
+
+	var delivered []string
+	for i, channel := range matched {
+		if results[i] == nil {
+			delivered = append(delivered, channel.Name)
+		}
+	}
+	return delivered
+}
+
+// deliveredNote 是推送成功后记录在事件时间线上的说明
+func deliveredNote(channels []string, title string) string {
+	return "已推送通知（" + strings.Join(channels, "、") + "）：" + title
+}
+
+// deliver 推送消息到一个渠道，并把结果写入日志与通知日志
+func deliver(channel notificationChannel, msg notify.Message) error {
+	ctx, cancel := context.WithTimeout(context.Background(), notificationTimeout)
+	defer cancel()
+	err := channel.notifier.Send(ctx, msg)
+
+	var errText interface{}
+	if err != nil {
+		errText = err.Error()
+		log.Println("[ERROR] 通知渠道 " + channel.Name + " 推送失败[" + msg.Title + "]，原因: " + err.Error())
+	} else {
+		log.Println("[INFO] 通知渠道 " + channel.Name + " 推送[" + msg.Title + "]成功")
+	}
+	_, dbErr := db.Exec("INSERT INTO notifications (time, channel, kind, severity, servers, title, success, error) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		time.Now().Format("2006-01-02 15:04:05"), channel.Name, msg.Kind, msg.Severity, strings.Join(msg.Servers, ","), msg.Title, err == nil, errText)
+	if dbErr != nil {
+		log.Println("[ERROR] 写入通知日志失败:", dbErr)
+	}
+	return err
+}
+
+// notificationFilter 是查询通知日志的条件，零值表示不限
+type notificationFilter struct {
+	channel string
+	// failed 为 nil 时不限推送结果
+	failed *bool
+	since  time.Time
+	limit  int
+}
+
+// listNotifications 按时间倒序返回通知日志
+func listNotifications(database *sql.DB, filter notificationFilter) ([]Notification, error) {
+	query := "SELECT id, time, channel, kind, severity, servers, title, success, COALESCE(error, '') FROM notifications WHERE 1 = 1"
+	var args []interface{}
+	if filter.channel != "" {
+		query += " AND channel = ?"
+		args = append(args, filter.channel)
+	}
+	if filter.failed != nil {
+		query += " AND success = ?"
+		args = append(args, !*filter.failed)
+	}
+	if !filter.since.IsZero() {
+		query += " AND time >= ?"
+		args = append(args, filter.since.Format("2006-01-02 15:04:05"))
+	}
+	query += " ORDER BY time DESC, id DESC LIMIT ?"
+	args = append(args, filter.limit)
+
+	rows, err := database.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	notifications := []Notification{}
+	for rows.Next() {
+		var n Notification
+		var servers string
+		if err := rows.Scan(&n.ID, &n.Time, &n.Channel, &n.Kind, &n.Severity, &servers, &n.Title, &n.Success, &n.Error); err != nil {
+			return nil, err
+		}
+		n.Time = localTime(n.Time)
+		n.Servers = []string{}
+		if servers != "" {
+			n.Servers = strings.Split(servers, ",")
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
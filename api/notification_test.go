@@ -0,0 +1,62 @@
+package api
+
+import (
+	"context"
+	"github.com/MeowLynxSea/Uptimeow/config"
+	"github.com/MeowLynxSea/Uptimeow/internal/notify"
+	"testing"
+	"time"
+)
+
+// blockingNotifier 在 release 关闭前不返回，用于模拟响应缓慢的渠道
+type blockingNotifier struct {
+	release chan struct{}
+	sent    chan string
+}
+
+func (n blockingNotifier) Send(ctx context.Context, msg notify.Message) error {
+	<-n.release
+	n.sent <- msg.Title
+	return nil
+}
+
+// TestNotificationQueue 检查入队不等待推送完成，消息按入队顺序推送，推送成功后调用 done
+func TestNotificationQueue(t *testing.T) {
+	database := openTestDB(t)
+	if err := migrateNotifications(database); err != nil {
+		t.Fatal(err)
+	}
+	db = database
+	t.Cleanup(func() { db = nil })
+
+	notifier := blockingNotifier{release: make(chan struct{}), sent: make(chan string, 2)}
+	notificationChannels = []notificationChannel{{config.NotificationChannel{Name: "slow", Type: "webhook"}, notifier}}
+	t.Cleanup(func() { notificationChannels = nil })
+	// 测试结束时关闭队列，让 runNotificationQueue 退出，不影响之后的测试
+	queue := captureNotifications(t)
+	t.Cleanup(func() { close(queue) })
+	go runNotificationQueue()
+
+	done := make(chan []string, 1)
+	start := time.Now()
+	enqueueNotification([]string{"slow"}, notify.Message{Title: "first"}, nil)
+	enqueueNotification([]string{"slow"}, notify.Message{Title: "second"}, func(delivered []string) { done <- delivered })
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("enqueue blocked for %s", elapsed)
+	}
+
+	close(notifier.release)
+	for _, want := range []string{"first", "second"} {
+		if got := <-notifier.sent; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+	select {
+	case delivered := <-done:
+		if len(delivered) != 1 || delivered[0] != "slow" {
+			t.Errorf("got delivered %v", delivered)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("done was not called")
+	}
+}
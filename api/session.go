@@ -0,0 +1,337 @@
+package api
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sessionGapTimeout 是允许的最长监控中断时间，中断更久后无法确认玩家是否一直在线，
+// 恢复时会先结束所有进行中的会话，再为仍在线的玩家开始新的会话
+const sessionGapTimeout = 5 * time.Minute
+
+// 会话结束的原因
+const (
+	sessionLeft          = "left"
+	sessionServerOffline = "server_offline"
+	sessionGap           = "monitoring_gap"
+)
+
+// Session 是玩家的一次在线记录，Duration 为秒数，进行中的会话 End 为空、Duration 计算到当前时间
+type Session struct {
+	Player    string     `json:"player"`
+	Server    string     `json:"server"`
+	Start     time.Time  `json:"start"`
+	End       *time.Time `json:"end"`
+	Duration  int64      `json:"duration"`
+	Online    bool       `json:"online"`
+	EndReason string     `json:"end_reason,omitempty"`
+}
+
+// Playtime 是玩家在一段时间内的累计在线时长（秒）
+type Playtime struct {
+	Player   string `json:"player"`
+	Server   string `json:"server"`
+	Total    int64  `json:"total"`
+	Sessions int    `json:"sessions"`
+	Online   bool   `json:"online"`
+	// Current 为当前会话已持续的秒数，不在线时为 0
+	Current int64 `json:"current"`
+}
+
+// openSession 是进行中的会话，lastSeen 为最近一次确认玩家在线的时间
+type openSession struct {
+	id       int64
+	start    time.Time
+	lastSeen time.Time
+}
+
+// sessionTracker 比较相邻两次完整的玩家列表得出上下线事件，并维护 sessions 表
+//
+// 开始时间为首次看到玩家的时间，结束时间为最后一次看到玩家的时间，因此时长只会偏短：
+// 玩家离开、服务器离线或监控中断过久时，会话都在最后一次确认在线的时间结束
+type sessionTracker struct {
+	mu     sync.Mutex
+	server string
+	open   map[string]*openSession
+	// lastSeen 为最近一次得到完整玩家列表的时间
+	lastSeen time.Time
+	// quiet 表示正在回放历史数据，不输出上下线日志
+	quiet bool
+}
+
+// execer 是 *sql.DB 与 *sql.Tx 共有的写入方法，回放历史数据时会话在事务中写入
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// sessionTrackers 按服务器 ID 保存会话状态，在 Start 中创建后不再增删
+var sessionTrackers = map[string]*sessionTracker{}
+
+// migrateSessions 创建 sessions 表，end_time 为空表示会话仍在进行
+//
+// 首次创建时会按时间顺序回放 data 表中记录的玩家列表，为此前的历史补全会话
+func migrateSessions(database *sql.DB) error {
+	var exists int
+	err := database.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'sessions'").Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Exec(`
+	CREATE TABLE IF NOT EXISTS sessions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		server TEXT NOT NULL,
+		player TEXT NOT NULL,
+		start_time DATETIME NOT NULL,
+		end_time DATETIME,
+		last_seen DATETIME NOT NULL,
+		duration INTEGER,
+		end_reason TEXT
+	);
+	CREATE INDEX IF NOT EXISTS sessions_player ON sessions (server, player, start_time);
+	CREATE INDEX IF NOT EXISTS sessions_open ON sessions (server, end_time);
+	`)
+	if err != nil || exists > 0 {
+		return err
+	}
+	return backfillSessions(database)
+}
+
+// backfillSessions 用 data 表中的历史记录回放出会话，记录间隔超过 sessionGapTimeout 时按监控中断处理
+func backfillSessions(database *sql.DB) error {
+	// 读取与写入在同一事务（同一连接）中进行，避免读游标阻塞提交
+	tx, err := database.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT server, time_index, online, online_player, COALESCE(player_list, ''), ` + statusColumn + `
+		FROM data ORDER BY server, time_index`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	trackers := map[string]*sessionTracker{}
+	for rows.Next() {
+		var server, playerList string
+		var t time.Time
+		var live LiveState
+		if err := rows.Scan(&server, &t, &live.IsOnline, &live.OnlinePlayer, &playerList, &live.Status); err != nil {
+			return err
+		}
+		live.PlayerList = []string{}
+		if playerList != "" {
+			live.PlayerList = strings.Split(playerList, ",")
+		}
+
+		tracker, ok := trackers[server]
+		if !ok {
+			tracker = &sessionTracker{server: server, open: map[string]*openSession{}, quiet: true}
+			trackers[server] = tracker
+		}
+		tracker.update(tx, live, localTime(t))
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+	return tx.Commit()
+}
+
+// loadSessionTracker 从数据库恢复进行中的会话，用于 Uptimeow 重启后继续跟踪
+func loadSessionTracker(database *sql.DB, server string) (*sessionTracker, error) {
+	tracker := &sessionTracker{server: server, open: map[string]*openSession{}}
+	rows, err := database.Query(`SELECT id, player, start_time, last_seen FROM sessions
+		WHERE server = ? AND end_time IS NULL`, server)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var player string
+		session := &openSession{}
+		if err := rows.Scan(&session.id, &player, &session.start, &session.lastSeen); err != nil {
+			return nil, err
+		}
+		session.start, session.lastSeen = localTime(session.start), localTime(session.lastSeen)
+		tracker.open[player] = session
+		if session.lastSeen.After(tracker.lastSeen) {
+			tracker.lastSeen = session.lastSeen
+		}
+	}
+	return tracker, rows.Err()
+}
+
+// update 根据当前状态推进会话，由保存数据的定时任务调用
+//
+// 只有玩家列表完整（名单数与在线人数一致）时才比较名单；服务器确认离线时结束所有会话；
+// 其余情况（unreachable、只有部分名单）视为监控中断，保持会话不变
+func (t *sessionTracker) update(database execer, live LiveState, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if live.Status == statusOffline {
+		t.closeAllLocked(database, sessionServerOffline)
+		return
+	}
+	if !live.IsOnline || len(live.PlayerList) != live.OnlinePlayer {
+		return
+	}
+	if !t.lastSeen.IsZero() && now.Sub(t.lastSeen) > sessionGapTimeout {
+		t.closeAllLocked(database, sessionGap)
+	}
+
+	present := map[string]bool{}
+	for _, player := range live.PlayerList {
+		present[player] = true
+	}
+	for player, session := range t.open {
+		if !present[player] {
+			if !t.quiet {
+				log.Println("[INFO] [" + t.server + "] Player " + player + " left")
+			}
+			t.closeLocked(database, player, session, sessionLeft)
+		}
+	}
+	for player := range present {
+		if _, ok := t.open[player]; ok {
+			continue
+		}
+		if !t.quiet {
+			log.Println("[INFO] [" + t.server + "] Player " + player + " joined")
+		}
+		result, err := database.Exec("INSERT INTO sessions (server, player, start_time, last_seen) VALUES (?, ?, ?, ?)",
+			t.server, player, now.Format("2006-01-02 15:04:05"), now.Format("2006-01-02 15:04:05"))
+		if err != nil {
+			log.Println("[ERROR] ["+t.server+"] Failed to start session: ", err)
+			continue
+		}
+		id, _ := result.LastInsertId()
+		t.open[player] = &openSession{id: id, start: now}
+	}
+
+	for _, session := range t.open {
+		session.lastSeen = now
+	}
+	if len(t.open) > 0 {
+		_, err := database.Exec("UPDATE sessions SET last_seen = ? WHERE server = ? AND end_time IS NULL", now.Format("2006-01-02 15:04:05"), t.server)
+		if err != nil {
+			log.Println("[ERROR] ["+t.server+"] Failed to update sessions: ", err)
+		}
+	}
+	t.lastSeen = now
+}
+
+// closeAllLocked 在各自最后一次确认在线的时间结束所有进行中的会话，调用方需持有 t.mu
+func (t *sessionTracker) closeAllLocked(database execer, reason string) {
+	for player, session := range t.open {
+		t.closeLocked(database, player, session, reason)
+	}
+}
+
+// closeLocked 在最后一次确认在线的时间结束会话，调用方需持有 t.mu
+func (t *sessionTracker) closeLocked(database execer, player string, session *openSession, reason string) {
+	delete(t.open, player)
+	end := session.lastSeen
+	if end.Before(session.start) {
+		end = session.start
+	}
+	_, err := database.Exec("UPDATE sessions SET end_time = ?, last_seen = ?, duration = ?, end_reason = ? WHERE id = ?",
+		end.Format("2006-01-02 15:04:05"), end.Format("2006-01-02 15:04:05"), int64(end.Sub(session.start).Seconds()), reason, session.id)
+	if err != nil {
+		log.Println("[ERROR] ["+t.server+"] Failed to close session: ", err)
+	}
+}
+
+// onlineSessions 返回进行中的会话，时长计算到 now
+func (t *sessionTracker) onlineSessions(now time.Time) []Session {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sessions := make([]Session, 0, len(t.open))
+	for player, session := range t.open {
+		sessions = append(sessions, Session{
+			Player:   player,
+			Server:   t.server,
+			Start:    session.start,
+			Duration: int64(now.Sub(session.start).Seconds()),
+			Online:   true,
+		})
+	}
+	return sessions
+}
+
+// getSessions 按开始时间倒序返回玩家最近的 limit 次会话
+func getSessions(database *sql.DB, server, player string, limit int) ([]Session, error) {
+	rows, err := database.Query(`SELECT start_time, end_time, COALESCE(duration, 0), COALESCE(end_reason, '') FROM sessions
+		WHERE server = ? AND player = ? ORDER BY start_time DESC LIMIT ?`, server, player, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	sessions := []Session{}
+	for rows.Next() {
+		session := Session{Player: player, Server: server}
+		var end sql.NullTime
+		if err := rows.Scan(&session.Start, &end, &session.Duration, &session.EndReason); err != nil {
+			return nil, err
+		}
+		session.Start = localTime(session.Start)
+		if end.Valid {
+			t := localTime(end.Time)
+			session.End = &t
+		} else {
+			session.Online = true
+			session.Duration = int64(now.Sub(session.Start).Seconds())
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// getPlaytime 统计玩家在 since 之后的累计在线时长，跨越 since 的会话只计算 since 之后的部分，
+// since 为零值时统计全部记录
+func getPlaytime(database *sql.DB, server, player string, since time.Time) (Playtime, error) {
+	playtime := Playtime{Player: player, Server: server}
+	rows, err := database.Query(`SELECT start_time, end_time FROM sessions
+		WHERE server = ? AND player = ? AND (end_time IS NULL OR end_time > ?)`, server, player, since.Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return playtime, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	for rows.Next() {
+		var start time.Time
+		var end sql.NullTime
+		if err := rows.Scan(&start, &end); err != nil {
+			return playtime, err
+		}
+		start = localTime(start)
+		stop := now
+		if end.Valid {
+			stop = localTime(end.Time)
+		} else {
+			playtime.Online = true
+			playtime.Current = int64(now.Sub(start).Seconds())
+		}
+		if start.Before(since) {
+			start = since
+		}
+		playtime.Total += int64(stop.Sub(start).Seconds())
+		playtime.Sessions++
+	}
+	return playtime, rows.Err()
+}
+
+// localTime 把数据库中按本地时间记录、读出时被当作 UTC 的时间还原为本地时间
+func localTime(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.Local)
+}
@@ -0,0 +1,217 @@
+package api
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// openTestDB 在临时目录中创建数据库，并建立 data 与 sessions 表
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	database, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if err := migrateData(database, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrateSessions(database); err != nil {
+		t.Fatal(err)
+	}
+	return database
+}
+
+func online(players ...string) LiveState {
+	return LiveState{IsOnline: true, Status: statusOnline, OnlinePlayer: len(players), PlayerList: players}
+}
+
+// sessionRow 是 sessions 表中的一行，进行中的会话 end 为零值
+type sessionRow struct {
+	player   string
+	start    time.Time
+	end      time.Time
+	duration int64
+	reason   string
+}
+
+func readSessions(t *testing.T, database *sql.DB) []sessionRow {
+	t.Helper()
+	rows, err := database.Query("SELECT player, start_time, end_time, COALESCE(duration, 0), COALESCE(end_reason, '') FROM sessions ORDER BY start_time, player")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var result []sessionRow
+	for rows.Next() {
+		var row sessionRow
+		var end sql.NullTime
+		if err := rows.Scan(&row.player, &row.start, &end, &row.duration, &row.reason); err != nil {
+			t.Fatal(err)
+		}
+		row.start = localTime(row.start)
+		if end.Valid {
+			row.end = localTime(end.Time)
+		}
+		result = append(result, row)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func checkSessions(t *testing.T, got, want []sessionRow) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d sessions %+v, want %d", len(got), got, len(want))
+	}
+	for i := range want {
+		if got[i].player != want[i].player || !got[i].start.Equal(want[i].start) || !got[i].end.Equal(want[i].end) ||
+			got[i].duration != want[i].duration || got[i].reason != want[i].reason {
+			t.Errorf("session %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+var t0 = time.Date(2025, 3, 1, 12, 0, 0, 0, time.Local)
+
+func at(offset time.Duration) time.Time {
+	return t0.Add(offset)
+}
+
+func TestSessionJoinLeave(t *testing.T) {
+	database := openTestDB(t)
+	tracker := &sessionTracker{server: "test", open: map[string]*openSession{}, quiet: true}
+	tracker.update(database, online("Steve"), at(0))
+	tracker.update(database, online("Steve", "Alex"), at(10*time.Second))
+	tracker.update(database, online("Alex"), at(20*time.Second))
+
+	checkSessions(t, readSessions(t, database), []sessionRow{
+		{"Steve", at(0), at(10 * time.Second), 10, sessionLeft},
+		{"Alex", at(10 * time.Second), time.Time{}, 0, ""},
+	})
+}
+
+func TestSessionGapTimeout(t *testing.T) {
+	database := openTestDB(t)
+	tracker := &sessionTracker{server: "test", open: map[string]*openSession{}, quiet: true}
+	tracker.update(database, online("Steve"), at(0))
+	tracker.update(database, online("Steve"), at(10*time.Second))
+	// 恰好 5 分钟的中断不拆分会话
+	tracker.update(database, online("Steve"), at(10*time.Second+sessionGapTimeout))
+	checkSessions(t, readSessions(t, database), []sessionRow{
+		{"Steve", at(0), time.Time{}, 0, ""},
+	})
+
+	// 超过 5 分钟后结束在最后一次确认在线的时间，并开始新的会话
+	resumed := at(20*time.Second + 2*sessionGapTimeout)
+	tracker.update(database, online("Steve"), resumed)
+	checkSessions(t, readSessions(t, database), []sessionRow{
+		{"Steve", at(0), at(10*time.Second + sessionGapTimeout), int64((10*time.Second + sessionGapTimeout).Seconds()), sessionGap},
+		{"Steve", resumed, time.Time{}, 0, ""},
+	})
+}
+
+func TestSessionServerOffline(t *testing.T) {
+	database := openTestDB(t)
+	tracker := &sessionTracker{server: "test", open: map[string]*openSession{}, quiet: true}
+	tracker.update(database, online("Steve", "Alex"), at(0))
+	tracker.update(database, online("Steve", "Alex"), at(10*time.Second))
+	// unreachable 与只有部分名单时保持会话不变
+	tracker.update(database, LiveState{Status: statusUnreachable, PlayerList: []string{}}, at(20*time.Second))
+	tracker.update(database, LiveState{IsOnline: true, Status: statusOnline, OnlinePlayer: 2, PlayerList: []string{"Steve"}}, at(30*time.Second))
+	tracker.update(database, LiveState{Status: statusOffline, PlayerList: []string{}}, at(40*time.Second))
+
+	checkSessions(t, readSessions(t, database), []sessionRow{
+		{"Alex", at(0), at(10 * time.Second), 10, sessionServerOffline},
+		{"Steve", at(0), at(10 * time.Second), 10, sessionServerOffline},
+	})
+	if len(tracker.open) != 0 {
+		t.Errorf("open sessions left: %v", tracker.open)
+	}
+}
+
+// TestSessionReload 模拟 Uptimeow 重启：新的 tracker 从数据库恢复进行中的会话，继续计时而不重复开始
+func TestSessionReload(t *testing.T) {
+	database := openTestDB(t)
+	tracker := &sessionTracker{server: "test", open: map[string]*openSession{}}
+	tracker.update(database, online("Steve"), at(0))
+	tracker.update(database, online("Steve"), at(10*time.Second))
+
+	reloaded, err := loadSessionTracker(database, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reloaded.lastSeen.Equal(at(10 * time.Second)) {
+		t.Errorf("got lastSeen %s, want %s", reloaded.lastSeen, at(10*time.Second))
+	}
+	reloaded.update(database, online("Steve"), at(40*time.Second))
+	checkSessions(t, readSessions(t, database), []sessionRow{
+		{"Steve", at(0), time.Time{}, 0, ""},
+	})
+
+	reloaded.update(database, online(), at(50*time.Second))
+	checkSessions(t, readSessions(t, database), []sessionRow{
+		{"Steve", at(0), at(40 * time.Second), 40, sessionLeft},
+	})
+	playtime, err := getPlaytime(database, "test", "Steve", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if playtime.Total != 40 || playtime.Sessions != 1 || playtime.Online {
+		t.Errorf("got %+v", playtime)
+	}
+
+	// 停机超过 5 分钟后重启，恢复的会话在停机前最后一次确认在线的时间结束
+	reloaded.update(database, online("Alex"), at(time.Minute))
+	again, err := loadSessionTracker(database, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again.update(database, online("Alex"), at(time.Minute+time.Hour))
+	checkSessions(t, readSessions(t, database), []sessionRow{
+		{"Steve", at(0), at(40 * time.Second), 40, sessionLeft},
+		{"Alex", at(time.Minute), at(time.Minute), 0, sessionGap},
+		{"Alex", at(time.Minute + time.Hour), time.Time{}, 0, ""},
+	})
+}
+
+// TestSessionBackfillHole 回放的 data 表中有超过 5 分钟的空洞时，会话保守地在空洞前结束
+func TestSessionBackfillHole(t *testing.T) {
+	database := openTestDB(t)
+	records := []struct {
+		offset  time.Duration
+		players []string
+	}{
+		{0, []string{"Steve"}},
+		{10 * time.Second, []string{"Steve", "Alex"}},
+		{20 * time.Second, []string{"Steve", "Alex"}},
+		// 监控停止了 20 分钟
+		{20*time.Second + 20*time.Minute, []string{"Steve"}},
+		{30*time.Second + 20*time.Minute, []string{}},
+	}
+	for _, record := range records {
+		_, err := database.Exec("INSERT INTO data (server, time_index, online, online_player, player_list, status) VALUES (?, ?, ?, ?, ?, ?)",
+			"test", at(record.offset).Format("2006-01-02 15:04:05"), true, len(record.players), strings.Join(record.players, ","), statusOnline)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := database.Exec("DROP TABLE sessions"); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrateSessions(database); err != nil {
+		t.Fatal(err)
+	}
+
+	hole := at(20*time.Second + 20*time.Minute)
+	checkSessions(t, readSessions(t, database), []sessionRow{
+		{"Steve", at(0), at(20 * time.Second), 20, sessionGap},
+		{"Alex", at(10 * time.Second), at(20 * time.Second), 10, sessionGap},
+		{"Steve", hole, hole, 0, sessionLeft},
+	})
+}
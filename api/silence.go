@@ -0,0 +1,158 @@
+package api
+
+import (
+	"database/sql"
+	"github.com/MeowLynxSea/Uptimeow/config"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Silence 是管理员创建的告警静默，StartsAt 到 EndsAt 之间匹配的告警不推送消息，但仍记录事件
+//
+// Servers、Rules、Severities 的含义与告警路由的 match 相同，各项为空时不限，但至少需要设置一项
+type Silence struct {
+	ID         int64     `json:"id"`
+	Servers    []string  `json:"servers"`
+	Rules      []string  `json:"rules"`
+	Severities []string  `json:"severities"`
+	Comment    string    `json:"comment"`
+	CreatedAt  time.Time `json:"created_at"`
+	StartsAt   time.Time `json:"starts_at"`
+	EndsAt     time.Time `json:"ends_at"`
+}
+
+var (
+	silencesMu sync.RWMutex
+	// silences 为尚未结束的静默，与 silences 表同步，供告警检查时匹配
+	silences []Silence
+)
+
+// migrateSilences 创建 silences 表，并读取尚未结束的静默
+func migrateSilences(database *sql.DB) error {
+	_, err := database.Exec(`
+	CREATE TABLE IF NOT EXISTS silences (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		servers TEXT NOT NULL,
+		rules TEXT NOT NULL,
+		severities TEXT NOT NULL,
+		comment TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		starts_at DATETIME NOT NULL,
+		ends_at DATETIME NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS silences_ends ON silences (ends_at);
+	`)
+	if err != nil {
+		return err
+	}
+	return loadSilences(database)
+}
+
+// loadSilences 从数据库重新读取尚未结束的静默，在静默变化后调用
+func loadSilences(database *sql.DB) error {
+	active, err := listSilences(database, false)
+	if err != nil {
+		return err
+	}
+	silencesMu.Lock()
+	silences = active
+	silencesMu.Unlock()
+	return nil
+}
+
+// listSilences 按开始时间倒序返回静默，all 为 false 时只返回尚未结束的静默（包括尚未开始的）
+func listSilences(database *sql.DB, all bool) ([]Silence, error) {
+	query := "SELECT id, servers, rules, severities, comment, created_at, starts_at, ends_at FROM silences"
+	var args []interface{}
+	if !all {
+		query += " WHERE ends_at > ?"
+		args = append(args, time.Now().Format("2006-01-02 15:04:05"))
+	}
+	rows, err := database.Query(query+" ORDER BY starts_at DESC, id DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := []Silence{}
+	for rows.Next() {
+		silence, err := scanSilence(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, silence)
+	}
+	return result, rows.Err()
+}
+
+// getSilence 按 ID 读取静默，不存在时返回 sql.ErrNoRows
+func getSilence(database *sql.DB, id int64) (Silence, error) {
+	return scanSilence(database.QueryRow("SELECT id, servers, rules, severities, comment, created_at, starts_at, ends_at FROM silences WHERE id = ?", id))
+}
+
+func scanSilence(row interface{ Scan(...interface{}) error }) (Silence, error) {
+	var s Silence
+	var servers, rules, severities string
+	if err := row.Scan(&s.ID, &servers, &rules, &severities, &s.Comment, &s.CreatedAt, &s.StartsAt, &s.EndsAt); err != nil {
+		return s, err
+	}
+	s.Servers, s.Rules, s.Severities = splitList(servers), splitList(rules), splitList(severities)
+	s.CreatedAt, s.StartsAt, s.EndsAt = localTime(s.CreatedAt), localTime(s.StartsAt), localTime(s.EndsAt)
+	return s, nil
+}
+
+// splitList 拆分以 , 分隔保存的列表，空字符串为空列表
+func splitList(text string) []string {
+	if text == "" {
+		return []string{}
+	}
+	return strings.Split(text, ",")
+}
+
+// insertSilence 保存新的静默并返回其 ID
+func insertSilence(database *sql.DB, s Silence) (int64, error) {
+	result, err := database.Exec("INSERT INTO silences (servers, rules, severities, comment, created_at, starts_at, ends_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		strings.Join(s.Servers, ","), strings.Join(s.Rules, ","), strings.Join(s.Severities, ","), s.Comment,
+		s.CreatedAt.Format("2006-01-02 15:04:05"), s.StartsAt.Format("2006-01-02 15:04:05"), s.EndsAt.Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// matches 判断静默在 at 时是否生效且匹配告警
+func (s Silence) matches(server, rule, severity string, at time.Time) bool {
+	if at.Before(s.StartsAt) || !at.Before(s.EndsAt) {
+		return false
+	}
+	match := config.RouteMatch{Servers: s.Servers, Rules: s.Rules, Severities: s.Severities}
+	return match.Matches([]string{server}, rule, severity)
+}
+
+// suppression 返回服务器的告警在 at 时不推送的原因：服务器处于计划维护中或告警匹配了生效的静默，
+// 均不是时返回空字符串；rule 为空表示不属于告警规则的消息
+func suppression(server config.ServerConfig, rule, severity string, at time.Time) string {
+	if window, ok := server.ActiveMaintenance(at); ok {
+		text := "计划维护中"
+		if window.Reason != "" {
+			text += "（" + window.Reason + "）"
+		}
+		return text + "，预计 " + window.End.Local().Format("2006-01-02 15:04:05") + " 结束"
+	}
+	if reason := networkSuppression(server, rule); reason != "" {
+		return reason
+	}
+	silencesMu.RLock()
+	defer silencesMu.RUnlock()
+	for _, silence := range silences {
+		if silence.matches(server.ID, rule, severity, at) {
+			text := "静默 #" + strconv.FormatInt(silence.ID, 10) + " 生效中"
+			if silence.Comment != "" {
+				text += "（" + silence.Comment + "）"
+			}
+			return text + "，至 " + silence.EndsAt.Format("2006-01-02 15:04:05")
+		}
+	}
+	return ""
+}
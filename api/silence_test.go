@@ -0,0 +1,104 @@
+package api
+
+import (
+	"github.com/MeowLynxSea/Uptimeow/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSilenceMatches(t *testing.T) {
+	window := Silence{StartsAt: at(0), EndsAt: at(time.Hour)}
+	with := func(servers, rules, severities []string) Silence {
+		s := window
+		s.Servers, s.Rules, s.Severities = servers, rules, severities
+		return s
+	}
+	tests := []struct {
+		name     string
+		silence  Silence
+		server   string
+		rule     string
+		severity string
+		at       time.Duration
+		want     bool
+	}{
+		{"server", with([]string{"survival"}, nil, nil), "survival", "offline", config.SeverityCritical, 0, true},
+		{"other server", with([]string{"survival"}, nil, nil), "creative", "offline", config.SeverityCritical, 0, false},
+		{"rule", with(nil, []string{"low_tps"}, nil), "creative", "low_tps", config.SeverityWarning, 0, true},
+		{"other rule", with(nil, []string{"low_tps"}, nil), "creative", "offline", config.SeverityWarning, 0, false},
+		// 不属于告警规则的消息只能匹配不限规则的静默
+		{"not a rule", with(nil, []string{"low_tps"}, nil), "creative", "", config.SeverityWarning, 0, false},
+		{"severity", with(nil, nil, []string{config.SeverityInfo, config.SeverityWarning}), "creative", "low_tps", config.SeverityWarning, 0, true},
+		{"other severity", with(nil, nil, []string{config.SeverityInfo}), "creative", "offline", config.SeverityCritical, 0, false},
+		{"all conditions", with([]string{"survival"}, []string{"offline"}, []string{config.SeverityCritical}), "survival", "offline", config.SeverityCritical, 0, true},
+		{"one condition fails", with([]string{"survival"}, []string{"offline"}, []string{config.SeverityWarning}), "survival", "offline", config.SeverityCritical, 0, false},
+		// 生效时段包含开始时间，不包含结束时间
+		{"before start", with([]string{"survival"}, nil, nil), "survival", "offline", config.SeverityCritical, -time.Second, false},
+		{"before end", with([]string{"survival"}, nil, nil), "survival", "offline", config.SeverityCritical, time.Hour - time.Second, true},
+		{"at end", with([]string{"survival"}, nil, nil), "survival", "offline", config.SeverityCritical, time.Hour, false},
+	}
+	for _, tt := range tests {
+		if got := tt.silence.matches(tt.server, tt.rule, tt.severity, at(tt.at)); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestSuppression 检查维护优先于静默作为不推送的原因，静默结束后照常推送
+func TestSuppression(t *testing.T) {
+	saved := silences
+	silences = []Silence{{ID: 7, Servers: []string{"survival"}, Comment: "迁移存档", StartsAt: at(0), EndsAt: at(time.Hour)}}
+	t.Cleanup(func() { silences = saved })
+
+	survival := config.ServerConfig{ID: "survival", Maintenance: []config.MaintenanceWindow{{Start: at(30 * time.Minute), End: at(40 * time.Minute), Reason: "升级"}}}
+	tests := []struct {
+		server config.ServerConfig
+		at     time.Duration
+		want   string
+	}{
+		{survival, 10 * time.Minute, "静默 #7 生效中（迁移存档）"},
+		{survival, 35 * time.Minute, "计划维护中（升级）"},
+		{survival, 2 * time.Hour, ""},
+		{config.ServerConfig{ID: "creative"}, 10 * time.Minute, ""},
+	}
+	for _, tt := range tests {
+		got := suppression(tt.server, "offline", config.SeverityCritical, at(tt.at))
+		if !strings.HasPrefix(got, tt.want) || (tt.want == "") != (got == "") {
+			t.Errorf("%s at %s: got %q, want %q", tt.server.ID, tt.at, got, tt.want)
+		}
+	}
+}
+
+// TestSilencedAlert 检查静默期间的告警只记录事件，静默结束后仍在告警时补推，静默期间恢复的告警不推送恢复
+func TestSilencedAlert(t *testing.T) {
+	useTestDB(t)
+	queue := captureNotifications(t)
+	setRoute(t, config.Route{Receivers: []string{"ops"}})
+	saved := silences
+	silences = []Silence{{ID: 1, Rules: []string{"offline"}, StartsAt: at(0), EndsAt: at(time.Hour)}}
+	t.Cleanup(func() { silences = saved })
+
+	state := testState("survival")
+	state.server.Rules = config.WarnTypes{Offline: true}.Rules()
+	steps := []alertStep{
+		{0, statusOffline, nil},
+		{10 * time.Minute, statusOnline, nil},
+		{20 * time.Minute, statusOffline, nil},
+		{time.Hour, statusOffline, []string{"ops 【紧急】服务器离线"}},
+		{time.Hour + time.Minute, statusOnline, []string{"ops 【恢复】服务器离线已恢复"}},
+	}
+	for _, step := range steps {
+		if got := tickAlerts(state, queue, at(step.at), withStatus(step.status)); strings.Join(got, "\n") != strings.Join(step.want, "\n") {
+			t.Errorf("%s: got %q, want %q", step.at, got, step.want)
+		}
+	}
+
+	var updates int
+	if err := db.QueryRow("SELECT COUNT(*) FROM incident_updates WHERE message LIKE '不推送通知：静默 #1%'").Scan(&updates); err != nil {
+		t.Fatal(err)
+	}
+	if updates != 2 {
+		t.Errorf("got %d silenced updates, want 2", updates)
+	}
+}
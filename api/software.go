@@ -0,0 +1,55 @@
+package api
+
+import (
+	"database/sql"
+	"github.com/MeowLynxSea/Uptimeow/internal/software"
+	"time"
+)
+
+// SoftwareInfo 是识别出的服务端类型与版本
+type SoftwareInfo struct {
+	Family  string `json:"family"`
+	Version string `json:"version"`
+	Build   string `json:"build"`
+	// Collectors 为当前运行的采集器，仅在 server_info 中返回
+	Collectors []string `json:"collectors,omitempty"`
+	// Unsupported 为不支持 TPS 采集的原因，仅在 server_info 中返回
+	Unsupported string    `json:"unsupported,omitempty"`
+	DetectedAt  time.Time `json:"detected_at"`
+}
+
+// recordSoftware 在服务端类型、版本或构建号与上次记录不同时写入一行
+func recordSoftware(database *sql.DB, server string, info software.Info, t time.Time) error {
+	var family, version, build string
+	err := database.QueryRow(`SELECT family, COALESCE(version, ''), COALESCE(build, '') FROM software
+		WHERE server = ? ORDER BY time_index DESC LIMIT 1`, server).Scan(&family, &version, &build)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if err == nil && family == info.Family && version == info.Version && build == info.Build {
+		return nil
+	}
+	_, err = database.Exec("INSERT OR REPLACE INTO software (server, time_index, family, version, build) VALUES (?, ?, ?, ?, ?)",
+		server, t.Format("2006-01-02 15:04:05"), info.Family, info.Version, info.Build)
+	return err
+}
+
+// getSoftwareHistory 按时间顺序返回服务端类型与版本的变化记录，DetectedAt 为首次识别出该版本的时间
+func getSoftwareHistory(database *sql.DB, server string) ([]SoftwareInfo, error) {
+	rows, err := database.Query(`SELECT time_index, family, COALESCE(version, ''), COALESCE(build, '') FROM software
+		WHERE server = ? ORDER BY time_index ASC`, server)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []SoftwareInfo{}
+	for rows.Next() {
+		var info SoftwareInfo
+		if err := rows.Scan(&info.DetectedAt, &info.Family, &info.Version, &info.Build); err != nil {
+			return nil, err
+		}
+		history = append(history, info)
+	}
+	return history, rows.Err()
+}
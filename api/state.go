@@ -0,0 +1,313 @@
+package api
+
+import (
+	"github.com/MeowLynxSea/Uptimeow/config"
+	"github.com/MeowLynxSea/Uptimeow/internal/bedrock"
+	"github.com/MeowLynxSea/Uptimeow/internal/collector"
+	"github.com/MeowLynxSea/Uptimeow/internal/event"
+	"github.com/MeowLynxSea/Uptimeow/internal/query"
+	"github.com/MeowLynxSea/Uptimeow/internal/slp"
+	"github.com/MeowLynxSea/Uptimeow/internal/software"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// serverState 是单台服务器的实时状态，由事件更新、由定时任务和 API 读取
+type serverState struct {
+	mu     sync.Mutex
+	server config.ServerConfig
+
+	// isOnline 表示主探测方式当前正常，对外的状态见 statusLocked
+	isOnline                bool
+	tps, tps5, tps15        float64
+	tpsEstimated            bool
+	onlinePlayer, maxPlayer int
+	playerList              []string
+	latency                 time.Duration
+	mspt                    *collector.MSPTSample
+	dimensions              []collector.DimensionTPS
+	memory                  *collector.MemorySample
+	slpStatus               *PingStatus
+	bedrockStatus           *BedrockStatus
+	queryStatus             *QueryStatus
+	software                *SoftwareInfo
+	// collectors 为当前 RCON 连接运行的采集器，尚未确定时为空
+	collectors []string
+	// unsupported 为当前服务端不支持 TPS 采集的原因
+	unsupported string
+
+	// listFailed 表示 RCON list 输出当前无法识别，此时改用 Query 提供的玩家数据
+	listFailed bool
+
+	// primaryReason 为主探测方式失败的原因，primaryFailedAt 为开始失败的时间，主探测方式正常时均为零值
+	primaryReason   string
+	primaryFailedAt time.Time
+	authFailed      bool
+	// parseFailure 与 slowReason 为最近一次采集器输出无法识别、响应缓慢的原因，在 degradedHold 内有效
+	parseFailure  string
+	parseFailedAt time.Time
+	slowReason    string
+	slowAt        time.Time
+	// crossCheck 为最近一次交叉验证的结果，crossChecking 表示正在进行按需的交叉验证
+	crossCheck        crossCheckResult
+	crossChecking     bool
+	crossCheckStarted time.Time
+
+	// alerts 为各告警规则的状态，键为规则名称；alerts 与 incidents 只由保存数据的定时任务读写
+	alerts map[string]*alertState
+	// incidents 为进行中的事件，键为事件类型（即规则名称）
+	incidents map[string]*openIncident
+}
+
+// LiveState 是某一时刻服务器状态的快照
+type LiveState struct {
+	// IsOnline 表示服务器可以访问，即状态为 online 或 degraded
+	IsOnline bool `json:"is_online"`
+	// Status 为 online、degraded、unreachable 或 offline，Reason 为非 online 时的原因
+	Status string  `json:"status"`
+	Reason string  `json:"reason,omitempty"`
+	Tps    float64 `json:"tps"`
+	// TpsEstimated 表示服务端没有 TPS 命令，Tps 由原版机制推算得到
+	TpsEstimated bool     `json:"tps_estimated"`
+	OnlinePlayer int      `json:"online_player"`
+	MaxPlayer    int      `json:"max_player"`
+	PlayerList   []string `json:"player_list"`
+	Latency      int64    `json:"latency"`
+	// Mspt 为最近 10 秒的 tick 耗时（毫秒），未启用 mspt 采集器时为空
+	Mspt *collector.TickTimes `json:"mspt,omitempty"`
+	// Dimensions 为各维度的 TPS，仅 Forge/NeoForge 服务端提供
+	Dimensions []collector.DimensionTPS `json:"dimensions,omitempty"`
+	// Memory 为内存占用（MB），未启用 memory 采集器时为空
+	Memory *collector.MemorySample `json:"memory,omitempty"`
+	// Maintenance 为正在进行的计划维护，不在维护中时为空
+	Maintenance *config.MaintenanceWindow `json:"maintenance,omitempty"`
+
+	// awaitingTPS 表示 RCON 已连接但运行了 TPS 采集器却还没有收到数据，此时不记录历史
+	awaitingTPS bool
+}
+
+// states 按服务器 ID 保存实时状态，在 Start 中创建后不再增删
+var states = map[string]*serverState{}
+
+func newServerState(server config.ServerConfig) *serverState {
+	return &serverState{server: server, playerList: []string{}, alerts: map[string]*alertState{}, incidents: map[string]*openIncident{}}
+}
+
+func (s *serverState) snapshot() LiveState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	status, reason := s.statusLocked(now)
+	live := LiveState{
+		IsOnline:     status == statusOnline || status == statusDegraded,
+		Status:       status,
+		Reason:       reason,
+		Tps:          s.tps,
+		TpsEstimated: s.tpsEstimated,
+		OnlinePlayer: s.onlinePlayer,
+		MaxPlayer:    s.maxPlayer,
+		PlayerList:   s.playerList,
+		Latency:      s.latency.Milliseconds(),
+		Dimensions:   s.dimensions,
+		Memory:       s.memory,
+		awaitingTPS:  s.isOnline && s.server.PrimaryProbe() == "rcon" && s.tps == 0 && s.expectsTPS(),
+	}
+	if s.mspt != nil {
+		live.Mspt = &s.mspt.L10s
+	}
+	if window, ok := s.server.ActiveMaintenance(now); ok {
+		live.Maintenance = &window
+	}
+	// 主探测方式不可用但服务器仍可访问时，以 Server List Ping 的玩家数代替
+	if live.IsOnline && !s.isOnline && s.slpStatus != nil {
+		live.OnlinePlayer, live.MaxPlayer, live.PlayerList = s.slpStatus.OnlinePlayer, s.slpStatus.MaxPlayer, s.slpStatus.PlayerSample
+	}
+	return live
+}
+
+// resetLocked 清空离线服务器的数据，调用方需持有 s.mu
+func (s *serverState) resetLocked() {
+	s.isOnline = false
+	s.tps, s.tps5, s.tps15, s.onlinePlayer, s.maxPlayer, s.playerList = 0, 0, 0, 0, 0, []string{}
+	s.tpsEstimated = false
+	s.mspt, s.dimensions, s.memory = nil, nil, nil
+}
+
+// tpsCollectors 是提供整体 TPS 的采集器
+var tpsCollectors = map[string]bool{"tps": true, "forge_tps": true, "neoforge_tps": true, "spark_tps": true, "vanilla_tps": true, "gametime_tps": true}
+
+// isCoreCollector 判断采集器是否决定在线状态，其余采集器（如 mspt）输出无法识别时不影响在线状态
+func isCoreCollector(name string) bool {
+	return name == "list" || tpsCollectors[name]
+}
+
+// expectsTPS 判断当前连接是否会提供 TPS，采集器尚未确定时视为会提供
+func (s *serverState) expectsTPS() bool {
+	if s.collectors == nil {
+		return true
+	}
+	for _, name := range s.collectors {
+		if tpsCollectors[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// consumeEvents 根据各服务器发布的事件更新对应的实时状态
+func consumeEvents(events <-chan event.Event) {
+	for ev := range events {
+		state, ok := states[ev.Server]
+		if !ok {
+			log.Println("[ERROR] Received event from unknown server " + ev.Server)
+			continue
+		}
+		state.handle(ev.Payload)
+	}
+}
+
+func (s *serverState) handle(payload interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := s.server.ID
+	primary := s.server.PrimaryProbe()
+	switch payload := payload.(type) {
+	case event.ConnectionStateChanged:
+		if payload.Connected {
+			s.markOnlineLocked()
+			log.Println("[INFO] [" + id + "] RCON connection success")
+		} else {
+			s.markFailedLocked(payload.Reason, payload.AuthFailed)
+			log.Println("[ERROR] [" + id + "] RCON connection error: " + payload.Reason)
+		}
+		s.collectors, s.unsupported = nil, ""
+	case event.CollectorsSelected:
+		s.collectors, s.unsupported = payload.Collectors, payload.Unsupported
+	case software.Info:
+		s.software = &SoftwareInfo{Family: payload.Family, Version: payload.Version, Build: payload.Build, DetectedAt: time.Now()}
+		if err := recordSoftware(db, id, payload, s.software.DetectedAt); err != nil {
+			log.Println("[ERROR] ["+id+"] Failed to record server software: ", err)
+		}
+	case event.CollectorFailed:
+		log.Println("[ERROR] [" + id + "] RCON execution error (" + payload.Collector + "): " + payload.Reason)
+		// list 输出无法识别时，如果启用了 Query 则由其提供玩家数据，不影响状态
+		if payload.ParseError && payload.Collector == "list" && s.server.HasProbe("query") {
+			s.listFailed = true
+			break
+		}
+		// 输出无法识别时连接仍然可用，只把核心采集器的问题视为 degraded
+		if payload.ParseError {
+			if isCoreCollector(payload.Collector) {
+				s.parseFailure, s.parseFailedAt = payload.Collector+"："+payload.Reason, time.Now()
+			}
+			break
+		}
+		s.markFailedLocked(payload.Reason, false)
+	case event.CollectorSlow:
+		s.slowReason, s.slowAt = "RCON 响应缓慢（"+payload.Collector+" 耗时 "+payload.Duration.Round(time.Millisecond).String()+"）", time.Now()
+	case crossCheckResult:
+		s.crossChecking = false
+		s.crossCheck = payload
+	case collector.TPSSample:
+		log.Println("[DEBUG] [" + id + "] TPS: " + strconv.FormatFloat(payload.L1m, 'f', -1, 64))
+		s.tps, s.tps5, s.tps15 = payload.L1m, payload.L5m, payload.L15m
+		s.tpsEstimated = payload.Estimated
+		// 解析失败不会断开 RCON 连接，因此收到新的数据即视为恢复在线
+		s.markOnlineLocked()
+	case collector.MSPTSample:
+		sample := payload
+		s.mspt = &sample
+	case collector.DimensionSample:
+		s.dimensions = payload.Dimensions
+	case collector.MemorySample:
+		sample := payload
+		s.memory = &sample
+	case collector.PlayerListSample:
+		log.Println("[DEBUG] [" + id + "] Player online: " + strconv.Itoa(payload.OnlinePlayer) + "/" + strconv.Itoa(payload.MaxPlayer))
+		s.onlinePlayer = payload.OnlinePlayer
+		s.maxPlayer = payload.MaxPlayer
+		s.playerList = payload.PlayerList
+		s.listFailed = false
+		s.markOnlineLocked()
+	case query.FullStat:
+		s.queryStatus = &QueryStatus{
+			Motd:         payload.Motd,
+			Version:      payload.Version,
+			Software:     payload.Software,
+			Plugins:      payload.Plugins,
+			Map:          payload.Map,
+			OnlinePlayer: payload.OnlinePlayer,
+			MaxPlayer:    payload.MaxPlayer,
+			PlayerList:   payload.PlayerList,
+			Latency:      payload.Latency.Milliseconds(),
+		}
+		if primary == "query" {
+			s.markOnlineLocked()
+		}
+		// 未采集 list 或其输出无法识别时，以 Query 的完整玩家列表代替
+		if primary == "query" || (primary == "rcon" && s.isOnline && (s.listFailed || !s.server.HasCollector("list"))) {
+			s.onlinePlayer, s.maxPlayer, s.playerList = payload.OnlinePlayer, payload.MaxPlayer, payload.PlayerList
+		}
+	case slp.Status:
+		s.slpStatus = &PingStatus{
+			Version:      payload.Version,
+			Protocol:     payload.Protocol,
+			Motd:         payload.Motd,
+			OnlinePlayer: payload.OnlinePlayer,
+			MaxPlayer:    payload.MaxPlayer,
+			PlayerSample: payload.PlayerSample,
+			Latency:      payload.Latency.Milliseconds(),
+		}
+		s.latency = payload.Latency
+		s.crossCheck = crossCheckResult{reachable: true, at: time.Now()}
+		// SLP 只能拿到部分玩家名
+		if primary == "slp" {
+			s.markOnlineLocked()
+			s.onlinePlayer, s.maxPlayer, s.playerList = payload.OnlinePlayer, payload.MaxPlayer, payload.PlayerSample
+		}
+	case bedrock.Status:
+		s.bedrockStatus = &BedrockStatus{
+			Edition:      payload.Edition,
+			Motd:         payload.Motd,
+			SubMotd:      payload.SubMotd,
+			Protocol:     payload.Protocol,
+			Version:      payload.Version,
+			OnlinePlayer: payload.OnlinePlayer,
+			MaxPlayer:    payload.MaxPlayer,
+			ServerGUID:   payload.ServerGUID,
+			GameMode:     payload.GameMode,
+			PortV4:       payload.PortV4,
+			PortV6:       payload.PortV6,
+			Latency:      payload.Latency.Milliseconds(),
+		}
+		// 基岩版 ping 不返回玩家名
+		if !s.server.HasProbe("slp") {
+			s.latency = payload.Latency
+		}
+		if primary == "bedrock" {
+			s.markOnlineLocked()
+			s.onlinePlayer, s.maxPlayer, s.playerList = payload.OnlinePlayer, payload.MaxPlayer, []string{}
+		}
+	case event.ProbeFailed:
+		log.Println("[ERROR] [" + id + "] Probe " + payload.Probe + " failed: " + payload.Reason)
+		switch payload.Probe {
+		case "query":
+			s.queryStatus = nil
+		case "slp":
+			s.slpStatus = nil
+			s.latency = 0
+			s.crossCheck = crossCheckResult{reachable: false, reason: payload.Reason, at: time.Now()}
+		case "bedrock":
+			s.bedrockStatus = nil
+			if !s.server.HasProbe("slp") {
+				s.latency = 0
+			}
+		}
+		if primary == payload.Probe {
+			s.markFailedLocked(payload.Reason, false)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"github.com/MeowLynxSea/Uptimeow/internal/slp"
+	"time"
+)
+
+// 服务器状态
+//
+// online 表示一切正常；degraded 表示服务器可以访问但监控受限，例如 RCON 认证失败、
+// 采集器输出无法识别、命令响应缓慢，或 RCON 不可用而 Server List Ping 正常；
+// unreachable 表示主探测方式失败、尚未确认服务器是否离线；offline 表示已确认离线
+const (
+	statusOnline      = "online"
+	statusDegraded    = "degraded"
+	statusUnreachable = "unreachable"
+	statusOffline     = "offline"
+)
+
+// statusColumn 是查询 data 表 status 列的表达式，旧版本记录的数据没有 status，按 online 列推断
+const statusColumn = `COALESCE(status, CASE WHEN online THEN 'online' ELSE 'offline' END)`
+
+// degradedHold 是采集器输出无法识别或响应缓慢后保持 degraded 的时长，期间没有再次出现则恢复 online
+const degradedHold = 30 * time.Second
+
+// crossCheckInterval 是主探测方式失败期间按需发起 Server List Ping 交叉验证的最小间隔
+const crossCheckInterval = 10 * time.Second
+
+// crossCheckResult 是一次 Server List Ping 交叉验证的结果，slp 探测的结果也记录为交叉验证
+type crossCheckResult struct {
+	reachable bool
+	reason    string
+	at        time.Time
+}
+
+// markOnlineLocked 记录主探测方式恢复正常，调用方需持有 s.mu
+func (s *serverState) markOnlineLocked() {
+	s.isOnline = true
+	s.primaryReason, s.primaryFailedAt, s.authFailed = "", time.Time{}, false
+}
+
+// markFailedLocked 记录主探测方式失败并清空数据，必要时发起交叉验证，调用方需持有 s.mu
+func (s *serverState) markFailedLocked(reason string, authFailed bool) {
+	if s.isOnline || s.primaryFailedAt.IsZero() {
+		s.primaryFailedAt = time.Now()
+	}
+	s.resetLocked()
+	s.primaryReason, s.authFailed = reason, authFailed
+	s.maybeCrossCheckLocked()
+}
+
+// crossCheckable 判断主探测方式失败时能否用 Server List Ping 确认服务器是否离线，
+// 仅适用于 Java 版且主探测方式不是 Server List Ping 本身的情况
+func (s *serverState) crossCheckable() bool {
+	primary := s.server.PrimaryProbe()
+	return (primary == "rcon" || primary == "query") && s.server.SLP.Address != ""
+}
+
+// maybeCrossCheckLocked 在未启用 slp 探测时按需发起一次交叉验证，结果通过 handle 写回，调用方需持有 s.mu
+func (s *serverState) maybeCrossCheckLocked() {
+	if s.isOnline || s.authFailed || !s.crossCheckable() || s.server.HasProbe("slp") {
+		return
+	}
+	if s.crossChecking || time.Since(s.crossCheckStarted) < crossCheckInterval {
+		return
+	}
+	s.crossChecking, s.crossCheckStarted = true, time.Now()
+
+	address, timeout := s.server.SLP.Address, s.server.SLP.Timeout
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		result := crossCheckResult{reachable: true}
+		if _, err := slp.Ping(ctx, address); err != nil {
+			result = crossCheckResult{reachable: false, reason: err.Error()}
+		}
+		result.at = time.Now()
+		s.handle(result)
+	}()
+}
+
+// statusLocked 根据各探测方式的结果得出服务器状态及原因，调用方需持有 s.mu
+func (s *serverState) statusLocked(now time.Time) (string, string) {
+	if s.isOnline {
+		if now.Sub(s.parseFailedAt) < degradedHold {
+			return statusDegraded, "采集器输出无法识别：" + s.parseFailure
+		}
+		if now.Sub(s.slowAt) < degradedHold {
+			return statusDegraded, s.slowReason
+		}
+		return statusOnline, ""
+	}
+
+	if s.primaryFailedAt.IsZero() {
+		return statusUnreachable, "尚未获得探测结果"
+	}
+	if s.authFailed {
+		return statusDegraded, "RCON 认证失败：" + s.primaryReason
+	}
+	if !s.crossCheckable() {
+		return statusOffline, s.primaryReason
+	}
+	// 只采信主探测方式失败之后的交叉验证结果
+	if s.crossCheck.at.Before(s.primaryFailedAt) {
+		return statusUnreachable, s.primaryReason + "；等待 Server List Ping 确认"
+	}
+	if s.crossCheck.reachable {
+		return statusDegraded, s.primaryReason + "；Server List Ping 正常"
+	}
+	return statusOffline, s.primaryReason + "；Server List Ping 失败：" + s.crossCheck.reason
+}
@@ -0,0 +1,309 @@
+package api
+
+import (
+	"database/sql"
+	"github.com/MeowLynxSea/Uptimeow/config"
+	"math"
+	"time"
+)
+
+// uptimeSampleSpan 是一条记录最多代表的时长：每 10 秒记录一次，相邻记录间隔超出该时长的部分
+// （例如 Uptimeow 未运行时）视为状态未知，既不算可用也不算故障
+const uptimeSampleSpan = 30 * time.Second
+
+// uptimePeriods 是可用率接口缺省返回的统计时段
+var uptimePeriods = []struct {
+	name     string
+	duration time.Duration
+}{
+	{"24h", 24 * time.Hour},
+	{"7d", 7 * 24 * time.Hour},
+	{"30d", 30 * 24 * time.Hour},
+	{"90d", 90 * 24 * time.Hour},
+}
+
+// 可用率统计中的状态：online 与 degraded 均视为可用，offline 为故障，
+// unreachable 尚未确认是否离线，与缺少记录一样视为未知
+const (
+	uptimeUp          = "up"
+	uptimeDown        = "down"
+	uptimeUnknown     = "unknown"
+	uptimeMaintenance = "maintenance"
+)
+
+// uptimeSegment 是状态不变的一段时间，Reason 为故障时第一条记录的原因
+type uptimeSegment struct {
+	start, end time.Time
+	state      string
+	reason     string
+}
+
+// Uptime 是一段时间内的可用率，各项时长均为秒数
+//
+// Percentage 为可用时长占已知状态时长（可用 + 故障）的百分比，没有已知状态时为空；
+// Coverage 为已知状态时长占统计时长（不含排除的维护时段）的百分比
+type Uptime struct {
+	Since       time.Time `json:"since"`
+	Until       time.Time `json:"until"`
+	Percentage  *float64  `json:"percentage"`
+	Coverage    float64   `json:"coverage"`
+	Up          int64     `json:"up"`
+	Down        int64     `json:"down"`
+	Unknown     int64     `json:"unknown"`
+	Maintenance int64     `json:"maintenance"`
+	OutageCount int       `json:"outage_count"`
+}
+
+// Outage 是一次故障，Duration 为秒数
+type Outage struct {
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Duration int64     `json:"duration"`
+	Reason   string    `json:"reason"`
+}
+
+// SLAReport 是一台服务器一个自然月的可用率报告
+type SLAReport struct {
+	Server   string `json:"server"`
+	Month    string `json:"month"`
+	Timezone string `json:"timezone"`
+	Uptime
+	Outages            []Outage                   `json:"outages"`
+	MaintenanceWindows []config.MaintenanceWindow `json:"maintenance_windows"`
+	ExcludeMaintenance bool                       `json:"exclude_maintenance"`
+}
+
+// getUptimeSegments 读取 since 到 until 之间的记录，合并为状态不变的时间段，缺少记录的时间不包含在内
+//
+// since 与 until 可以位于任意时区（例如 web.timezone），查询前先换算为记录所用的本地时间
+func getUptimeSegments(database *sql.DB, server string, since, until time.Time) ([]uptimeSegment, error) {
+	// 多读取 since 之前的记录，用于覆盖 since 到第一条记录之间的时间
+	rows, err := database.Query(`SELECT time_index, `+statusColumn+`, COALESCE(reason, '') FROM data
+		WHERE server = ? AND time_index >= ? AND time_index <= ? ORDER BY time_index ASC`,
+		server, since.Add(-uptimeSampleSpan).Local().Format("2006-01-02 15:04:05"), until.Local().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var segments []uptimeSegment
+	var last *uptimeSegment
+	var lastTime time.Time
+	var lastState, lastReason string
+	// flush 把上一条记录代表的时间段并入结果，next 为下一条记录的时间
+	flush := func(next time.Time) {
+		if lastTime.IsZero() {
+			return
+		}
+		start, end := lastTime, lastTime.Add(uptimeSampleSpan)
+		if next.Before(end) {
+			end = next
+		}
+		if start.Before(since) {
+			start = since
+		}
+		if end.After(until) {
+			end = until
+		}
+		if !end.After(start) || lastState == uptimeUnknown {
+			return
+		}
+		if last != nil && last.state == lastState && !last.end.Before(start) {
+			last.end = end
+			return
+		}
+		segments = append(segments, uptimeSegment{start: start, end: end, state: lastState, reason: lastReason})
+		last = &segments[len(segments)-1]
+	}
+
+	for rows.Next() {
+		var t time.Time
+		var status, reason string
+		if err := rows.Scan(&t, &status, &reason); err != nil {
+			return nil, err
+		}
+		t = localTime(t)
+		flush(t)
+
+		lastTime, lastReason = t, reason
+		switch status {
+		case statusOnline, statusDegraded:
+			lastState = uptimeUp
+		case statusOffline:
+			lastState = uptimeDown
+		default:
+			lastState = uptimeUnknown
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	flush(until)
+	return segments, nil
+}
+
+// excludeMaintenance 把与维护时段重叠的部分标记为维护，segments 与 windows 均需按开始时间排序，维护时段可以重叠
+func excludeMaintenance(segments []uptimeSegment, windows []config.MaintenanceWindow) []uptimeSegment {
+	var result []uptimeSegment
+	first := 0
+	for _, segment := range segments {
+		// 时间段按顺序排列，在此之前已经结束的维护不会再与之后的时间段重叠
+		for first < len(windows) && !windows[first].End.After(segment.start) {
+			first++
+		}
+		start := segment.start
+		for _, window := range windows[first:] {
+			if !window.Start.Before(segment.end) {
+				break
+			}
+			if !window.End.After(start) {
+				continue
+			}
+			if window.Start.After(start) {
+				before := segment
+				before.start, before.end = start, window.Start
+				result = append(result, before)
+				start = window.Start
+			}
+			overlap := uptimeSegment{start: start, end: segment.end, state: uptimeMaintenance}
+			if overlap.end.After(window.End) {
+				overlap.end = window.End
+			}
+			result = append(result, overlap)
+			start = overlap.end
+		}
+		if segment.end.After(start) {
+			after := segment
+			after.start = start
+			result = append(result, after)
+		}
+	}
+	return result
+}
+
+// summarizeUptime 统计 since 到 until 之间的可用率，segments 中超出该范围的部分会被截去
+func summarizeUptime(segments []uptimeSegment, since, until time.Time) Uptime {
+	uptime := Uptime{Since: since, Until: until}
+	var up, down, maintenance time.Duration
+	for _, segment := range clipSegments(segments, since, until) {
+		duration := segment.end.Sub(segment.start)
+		switch segment.state {
+		case uptimeUp:
+			up += duration
+		case uptimeDown:
+			down += duration
+			uptime.OutageCount++
+		case uptimeMaintenance:
+			maintenance += duration
+		}
+	}
+	total := until.Sub(since) - maintenance
+	uptime.Up, uptime.Down, uptime.Maintenance = int64(up.Seconds()), int64(down.Seconds()), int64(maintenance.Seconds())
+	uptime.Unknown = int64((total - up - down).Seconds())
+	if up+down > 0 {
+		percentage := roundPercentage(float64(up) / float64(up+down))
+		uptime.Percentage = &percentage
+	}
+	if total > 0 {
+		uptime.Coverage = roundPercentage(float64(up+down) / float64(total))
+	}
+	return uptime
+}
+
+// outages 返回 since 到 until 之间的故障，中间只隔着维护时段的故障不会合并
+func outages(segments []uptimeSegment, since, until time.Time) []Outage {
+	result := []Outage{}
+	for _, segment := range clipSegments(segments, since, until) {
+		if segment.state != uptimeDown {
+			continue
+		}
+		result = append(result, Outage{
+			Start:    segment.start,
+			End:      segment.end,
+			Duration: int64(segment.end.Sub(segment.start).Seconds()),
+			Reason:   segment.reason,
+		})
+	}
+	return result
+}
+
+// clipSegments 截取 since 到 until 之间的部分
+func clipSegments(segments []uptimeSegment, since, until time.Time) []uptimeSegment {
+	var result []uptimeSegment
+	for _, segment := range segments {
+		if !segment.end.After(since) || !segment.start.Before(until) {
+			continue
+		}
+		if segment.start.Before(since) {
+			segment.start = since
+		}
+		if segment.end.After(until) {
+			segment.end = until
+		}
+		result = append(result, segment)
+	}
+	return result
+}
+
+// roundPercentage 把比例换算为保留三位小数的百分比
+func roundPercentage(ratio float64) float64 {
+	return math.Round(ratio*100*1000) / 1000
+}
+
+// getUptime 返回缺省各时段的可用率，键为时段名称
+func getUptime(database *sql.DB, server config.ServerConfig, now time.Time, exclude bool) (map[string]Uptime, error) {
+	longest := uptimePeriods[len(uptimePeriods)-1].duration
+	segments, err := getUptimeSegments(database, server.ID, now.Add(-longest), now)
+	if err != nil {
+		return nil, err
+	}
+	if exclude {
+		segments = excludeMaintenance(segments, server.MaintenanceBetween(now.Add(-longest), now))
+	}
+	result := map[string]Uptime{}
+	for _, period := range uptimePeriods {
+		result[period.name] = summarizeUptime(segments, now.Add(-period.duration), now)
+	}
+	return result, nil
+}
+
+// getUptimeRange 返回 since 到 until 之间的可用率
+func getUptimeRange(database *sql.DB, server config.ServerConfig, since, until time.Time, exclude bool) (Uptime, error) {
+	segments, err := getUptimeSegments(database, server.ID, since, until)
+	if err != nil {
+		return Uptime{}, err
+	}
+	if exclude {
+		segments = excludeMaintenance(segments, server.MaintenanceBetween(since, until))
+	}
+	return summarizeUptime(segments, since, until), nil
+}
+
+// getSLAReport 生成从 start 开始的自然月（按 start 所在时区划分）的 SLA 报告，当月只统计到 now
+func getSLAReport(database *sql.DB, server config.ServerConfig, start, now time.Time, exclude bool) (SLAReport, error) {
+	location := start.Location()
+	report := SLAReport{Server: server.ID, Month: start.Format("2006-01"), Timezone: location.String(), ExcludeMaintenance: exclude}
+	end := start.AddDate(0, 1, 0)
+	if end.After(now) {
+		end = now
+	}
+
+	segments, err := getUptimeSegments(database, server.ID, start, end)
+	if err != nil {
+		return report, err
+	}
+	// 周期性的维护展开为当月的各次维护
+	report.MaintenanceWindows = server.MaintenanceBetween(start, end)
+	if exclude {
+		segments = excludeMaintenance(segments, report.MaintenanceWindows)
+	}
+
+	report.Uptime = summarizeUptime(segments, start, end)
+	report.Since, report.Until = report.Since.In(location), report.Until.In(location)
+	report.Outages = outages(segments, start, end)
+	for i := range report.Outages {
+		report.Outages[i].Start = report.Outages[i].Start.In(location)
+		report.Outages[i].End = report.Outages[i].End.In(location)
+	}
+	return report, nil
+}
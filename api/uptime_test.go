@@ -0,0 +1,196 @@
+package api
+
+import (
+	"database/sql"
+	"github.com/MeowLynxSea/Uptimeow/config"
+	"testing"
+	"time"
+)
+
+// insertSamples 每 10 秒写入一条记录，时间与 saveData 一样按本地时间保存
+func insertSamples(t *testing.T, database *sql.DB, server string, from, to time.Time, status string) {
+	t.Helper()
+	tx, err := database.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Commit()
+	for at := from; at.Before(to); at = at.Add(10 * time.Second) {
+		_, err := tx.Exec("INSERT INTO data (server, time_index, online, status) VALUES (?, ?, ?, ?)",
+			server, at.Local().Format("2006-01-02 15:04:05"), status != statusOffline, status)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// setLocal 在测试期间替换进程的本地时区
+func setLocal(t *testing.T, location *time.Location) {
+	local := time.Local
+	time.Local = location
+	t.Cleanup(func() { time.Local = local })
+}
+
+// TestSLAReportTimezone 中 web.timezone 与进程的本地时区不同，月份的边界应按 web.timezone 划分后再换算为本地时间查询
+func TestSLAReportTimezone(t *testing.T) {
+	setLocal(t, time.FixedZone("UTC-5", -5*60*60))
+	shanghai := time.FixedZone("Asia/Shanghai", 8*60*60)
+	database := openTestDB(t)
+
+	// 本地时间 2025-02-28 20:00 至 03-01 04:00 在线，即上海时间 03-01 09:00 至 17:00，全部属于上海时间的 3 月
+	from := time.Date(2025, 2, 28, 20, 0, 0, 0, time.Local)
+	insertSamples(t, database, "test", from, from.Add(8*time.Hour), statusOnline)
+
+	start, err := time.ParseInLocation("2006-01", "2025-03", shanghai)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := getSLAReport(database, config.ServerConfig{ID: "test"}, start, from.Add(10*time.Hour), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Up != int64((8*time.Hour - 10*time.Second + uptimeSampleSpan).Seconds()) {
+		t.Errorf("got %d seconds up, want about 8h", report.Up)
+	}
+	if report.Down != 0 || report.Percentage == nil || *report.Percentage != 100 {
+		t.Errorf("got %+v", report.Uptime)
+	}
+	if report.Timezone != "Asia/Shanghai" || !report.Since.Equal(start) || report.Since.Location() != shanghai {
+		t.Errorf("got since %s in %s", report.Since, report.Timezone)
+	}
+}
+
+func TestSLAReportOutages(t *testing.T) {
+	database := openTestDB(t)
+	from := time.Date(2025, 3, 1, 0, 0, 0, 0, time.Local)
+	insertSamples(t, database, "test", from, from.Add(time.Hour), statusOnline)
+	insertSamples(t, database, "test", from.Add(time.Hour), from.Add(time.Hour+5*time.Minute), statusOffline)
+	insertSamples(t, database, "test", from.Add(time.Hour+5*time.Minute), from.Add(2*time.Hour), statusOnline)
+
+	report, err := getSLAReport(database, config.ServerConfig{ID: "test"}, from, from.Add(2*time.Hour), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Down != 300 || report.OutageCount != 1 || len(report.Outages) != 1 {
+		t.Fatalf("got %+v, outages %+v", report.Uptime, report.Outages)
+	}
+	if outage := report.Outages[0]; !outage.Start.Equal(from.Add(time.Hour)) || outage.Duration != 300 {
+		t.Errorf("got outage %+v", outage)
+	}
+}
+
+// TestUptimeExcludeMaintenance 检查排除维护时，维护期间的故障不计入可用率与故障列表，维护时长从统计时长中扣除
+func TestUptimeExcludeMaintenance(t *testing.T) {
+	database := openTestDB(t)
+	from := time.Date(2025, 3, 1, 0, 0, 0, 0, time.Local)
+	insertSamples(t, database, "test", from, from.Add(time.Hour), statusOnline)
+	insertSamples(t, database, "test", from.Add(time.Hour), from.Add(time.Hour+20*time.Minute), statusOffline)
+	insertSamples(t, database, "test", from.Add(time.Hour+20*time.Minute), from.Add(2*time.Hour), statusOnline)
+	server := config.ServerConfig{ID: "test", Maintenance: []config.MaintenanceWindow{
+		{Start: from.Add(time.Hour - 10*time.Minute), End: from.Add(time.Hour + 10*time.Minute), Reason: "升级"},
+		// 与上一次维护重叠
+		{Start: from.Add(time.Hour), End: from.Add(time.Hour + 15*time.Minute)},
+	}}
+	until := from.Add(2 * time.Hour)
+
+	tests := []struct {
+		exclude     bool
+		down        int64
+		maintenance int64
+		outages     int
+		percentage  float64
+	}{
+		{false, 1200, 0, 1, 83.333},
+		{true, 300, 1500, 1, 94.737},
+	}
+	for _, tt := range tests {
+		uptime, err := getUptimeRange(database, server, from, until, tt.exclude)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if uptime.Down != tt.down || uptime.Maintenance != tt.maintenance || uptime.Percentage == nil || *uptime.Percentage != tt.percentage {
+			t.Errorf("exclude %v: got %+v, percentage %v", tt.exclude, uptime, *uptime.Percentage)
+		}
+		if uptime.Up+uptime.Down+uptime.Unknown+uptime.Maintenance != int64(until.Sub(from).Seconds()) {
+			t.Errorf("exclude %v: durations do not add up: %+v", tt.exclude, uptime)
+		}
+
+		report, err := getSLAReport(database, server, from, until, tt.exclude)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Outages) != tt.outages || len(report.MaintenanceWindows) != 2 {
+			t.Fatalf("exclude %v: got outages %+v, windows %+v", tt.exclude, report.Outages, report.MaintenanceWindows)
+		}
+		// 维护结束后仍离线的部分才算故障
+		if outage := report.Outages[0]; tt.exclude && (!outage.Start.Equal(from.Add(time.Hour+15*time.Minute)) || outage.Duration != 300) {
+			t.Errorf("got outage %+v", outage)
+		}
+	}
+}
+
+func TestExcludeMaintenance(t *testing.T) {
+	segment := func(from, to time.Duration, state string) uptimeSegment {
+		return uptimeSegment{start: at(from), end: at(to), state: state}
+	}
+	window := func(from, to time.Duration) config.MaintenanceWindow {
+		return config.MaintenanceWindow{Start: at(from), End: at(to)}
+	}
+	tests := []struct {
+		name     string
+		segments []uptimeSegment
+		windows  []config.MaintenanceWindow
+		want     []uptimeSegment
+	}{
+		{
+			name:     "no overlap",
+			segments: []uptimeSegment{segment(0, time.Hour, uptimeUp)},
+			windows:  []config.MaintenanceWindow{window(2*time.Hour, 3*time.Hour)},
+			want:     []uptimeSegment{segment(0, time.Hour, uptimeUp)},
+		},
+		{
+			name:     "inside",
+			segments: []uptimeSegment{segment(0, time.Hour, uptimeDown)},
+			windows:  []config.MaintenanceWindow{window(10*time.Minute, 20*time.Minute)},
+			want: []uptimeSegment{
+				segment(0, 10*time.Minute, uptimeDown), segment(10*time.Minute, 20*time.Minute, uptimeMaintenance), segment(20*time.Minute, time.Hour, uptimeDown),
+			},
+		},
+		{
+			name:     "across segments",
+			segments: []uptimeSegment{segment(0, time.Hour, uptimeUp), segment(time.Hour, 2*time.Hour, uptimeDown)},
+			windows:  []config.MaintenanceWindow{window(50*time.Minute, 70*time.Minute)},
+			want: []uptimeSegment{
+				segment(0, 50*time.Minute, uptimeUp), segment(50*time.Minute, time.Hour, uptimeMaintenance),
+				segment(time.Hour, 70*time.Minute, uptimeMaintenance), segment(70*time.Minute, 2*time.Hour, uptimeDown),
+			},
+		},
+		{
+			name:     "overlapping windows",
+			segments: []uptimeSegment{segment(0, time.Hour, uptimeDown)},
+			windows:  []config.MaintenanceWindow{window(0, 30*time.Minute), window(20*time.Minute, 40*time.Minute)},
+			want: []uptimeSegment{
+				segment(0, 30*time.Minute, uptimeMaintenance), segment(30*time.Minute, 40*time.Minute, uptimeMaintenance), segment(40*time.Minute, time.Hour, uptimeDown),
+			},
+		},
+		{
+			name:     "covers everything",
+			segments: []uptimeSegment{segment(10*time.Minute, 20*time.Minute, uptimeDown)},
+			windows:  []config.MaintenanceWindow{window(0, time.Hour)},
+			want:     []uptimeSegment{segment(10*time.Minute, 20*time.Minute, uptimeMaintenance)},
+		},
+	}
+	for _, tt := range tests {
+		got := excludeMaintenance(tt.segments, tt.windows)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if !got[i].start.Equal(tt.want[i].start) || !got[i].end.Equal(tt.want[i].end) || got[i].state != tt.want[i].state {
+				t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
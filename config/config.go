@@ -1,29 +1,36 @@
 package config
 
 import (
+	"fmt"
 	"gopkg.in/yaml.v3"
 	"log"
 	"os"
 	"sync"
+	"time"
 )
 
 type ConfigData struct {
 	Web struct {
 		Host string `yaml:"host"`
 		Port int    `yaml:"port"`
+		// Timezone 为统计在线人数分布等按日、按小时汇总时使用的时区，例如 Asia/Shanghai，缺省为本机时区
+		Timezone string `yaml:"timezone"`
+		// Location 为 Timezone 对应的时区，加载配置时解析
+		Location *time.Location `yaml:"-"`
 	} `yaml:"web"`
-	Rcon struct {
-		Host     string `yaml:"host"`
-		Port     int    `yaml:"port"`
-		Password string `yaml:"password"`
-	} `yaml:"rcon"`
-	ServerInfo struct {
-		Name        string `yaml:"name"`
-		Address     string `yaml:"address"`
-		Website     string `yaml:"website"`
-		Description string `yaml:"description"`
-	} `yaml:"server_info"`
-	Warn struct {
+	// Admin 为管理接口的配置，Token 为空时不开放管理接口
+	Admin struct {
+		// Token 为访问管理接口时 Authorization: Bearer 头中携带的令牌
+		Token string `yaml:"token"`
+	} `yaml:"admin"`
+	// Servers 为需要监控的服务器列表
+	Servers []ServerConfig `yaml:"servers"`
+	// Networks 把代理服务器（BungeeCord/Velocity）和其后端服务器组织为群组服
+	Networks []NetworkConfig `yaml:"networks"`
+	// Legacy 为旧版写在顶层的单服务器配置（rcon、probes、server_info 等），
+	// 未配置 servers 时作为 id 为 default 的唯一服务器
+	Legacy ServerConfig `yaml:",inline"`
+	Warn   struct {
 		Enabled     bool `yaml:"enabled"`
 		DingTalkBot struct {
 			Enabled     bool   `yaml:"enabled"`
@@ -31,16 +38,342 @@ type ConfigData struct {
 			Secret      string `yaml:"secret"`
 			AtMobile    string `yaml:"atMobile"`
 		} `yaml:"dingtalkBot"`
-		EnabledType struct {
-			LowTps struct {
-				Enabled bool    `yaml:"enabled"`
-				Threold float64 `yaml:"threshold"`
-			} `yaml:"lowTps"`
-			Offline bool `yaml:"offline"`
-		} `yaml:"enabledType"`
+		// EnabledType 为缺省的内置告警规则，可在各服务器的 alerts 中覆盖
+		EnabledType WarnTypes `yaml:"enabledType"`
+		// Rules 为自定义告警规则，与内置规则同名时取代内置规则
+		Rules []AlertRule `yaml:"rules"`
+		// Flapping 为未单独配置抖动检测的规则（包括内置规则）使用的抖动检测
+		Flapping FlapDetection `yaml:"flapping"`
+		// Channels 为通知渠道，dingtalkBot 启用时会作为名为 dingtalk 的渠道加入
+		Channels []NotificationChannel `yaml:"channels"`
+		// Route 为告警路由树的根节点，决定告警推送到哪些渠道以及如何分组、重复提醒和升级
+		Route Route `yaml:"route"`
 	}
 }
 
+// ServerConfig 是单台服务器的连接、探测、展示和告警配置
+type ServerConfig struct {
+	// ID 用于 API 和数据库中区分服务器，只能包含字母、数字、- 和 _
+	ID   string     `yaml:"id"`
+	Rcon RconConfig `yaml:"rcon"`
+	// 启用的探测方式，可选 rcon、query、slp、bedrock，缺省为仅 rcon
+	Probes []string `yaml:"probes"`
+	// SLP 的地址缺省为 server_info.address
+	SLP PingProbe `yaml:"slp"`
+	// Query 需要服务端开启 enable-query，地址缺省为 server_info.address，端口缺省为 25565
+	Query PingProbe `yaml:"query"`
+	// Bedrock 的地址缺省为 server_info.address，端口缺省为 19132
+	Bedrock    PingProbe        `yaml:"bedrock"`
+	ServerInfo ServerInfoConfig `yaml:"server_info"`
+	// Alerts 为该服务器的内置告警规则，缺省使用全局 warn.enabledType
+	Alerts *WarnTypes `yaml:"alerts"`
+	// Rules 为适用于该服务器的全部告警规则，由 Alerts 与 warn.rules 合并得出
+	Rules []AlertRule `yaml:"-"`
+	// Maintenance 为计划维护时段，维护期间不推送告警，计算可用率时可以排除
+	Maintenance []MaintenanceWindow `yaml:"maintenance"`
+}
+
+// NetworkConfig 是一个群组服，Proxy 与 Backends 均为 servers 中的服务器 ID
+type NetworkConfig struct {
+	ID       string   `yaml:"id"`
+	Name     string   `yaml:"name"`
+	Proxy    string   `yaml:"proxy"`
+	Backends []string `yaml:"backends"`
+}
+
+type RconConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Password string `yaml:"password"`
+	// 启用的采集器名称，见 internal/collector；auto 表示按识别出的服务端类型选择
+	Collectors []string `yaml:"collectors"`
+}
+
+type ServerInfoConfig struct {
+	Name        string `yaml:"name"`
+	Address     string `yaml:"address"`
+	Website     string `yaml:"website"`
+	Description string `yaml:"description"`
+}
+
+type WarnTypes struct {
+	// LowTps 在 TPS 低于 Threshold 时告警，RecoverThreshold 不为 0 时需回升到不低于该值才恢复；
+	// For 与 Samples 见 AlertCondition
+	LowTps struct {
+		Enabled          bool          `yaml:"enabled"`
+		Threold          float64       `yaml:"threshold"`
+		RecoverThreshold float64       `yaml:"recoverThreshold"`
+		For              time.Duration `yaml:"for"`
+		Samples          int           `yaml:"samples"`
+	} `yaml:"lowTps"`
+	// HighMspt 在最近 10 秒的最大 tick 耗时持续 For 时长高于 Threshold（毫秒）时告警，需启用 mspt 采集器；
+	// RecoverThreshold 不为 0 时需回落到不高于该值才恢复
+	HighMspt struct {
+		Enabled          bool          `yaml:"enabled"`
+		Threshold        float64       `yaml:"threshold"`
+		RecoverThreshold float64       `yaml:"recoverThreshold"`
+		For              time.Duration `yaml:"for"`
+		Samples          int           `yaml:"samples"`
+	} `yaml:"highMspt"`
+	Offline bool `yaml:"offline"`
+	// Degraded 在服务器可以访问但监控受限（如 RCON 认证失败、输出无法识别）时告警
+	Degraded bool `yaml:"degraded"`
+}
+
+// 告警规则的严重程度
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// AlertCondition 是告警规则中对指标的判断：数值指标与 Threshold 比较，status 指标与 Value 比较，
+// 条件持续满足 For 时长、且连续 Samples 次检查（每 10 秒一次）均满足后成立
+type AlertCondition struct {
+	// Op 为 <、<=、>、>=、==、!=，status 指标只能使用 == 与 !=
+	Op        string        `yaml:"op"`
+	Threshold float64       `yaml:"threshold"`
+	Value     string        `yaml:"value"`
+	For       time.Duration `yaml:"for"`
+	Samples   int           `yaml:"samples"`
+}
+
+// FlapDetection 是抖动检测：告警在 Window 内告警与恢复的次数超过 Changes 时视为抖动，
+// 暂停推送该告警并只推送一条抖动通知，Window 内不再变化后结束抖动；Changes 为 0 时不检测
+type FlapDetection struct {
+	Changes int           `yaml:"changes"`
+	Window  time.Duration `yaml:"window"`
+}
+
+// AlertRule 是一条告警规则：条件成立时告警，Recover 成立时恢复；
+// 未配置 Recover 时，告警条件不再满足即恢复。指标暂时无法获得（如服务器离线时的 TPS）时保持当前状态
+type AlertRule struct {
+	// Name 用于区分规则，也是事件的类型
+	Name string `yaml:"name"`
+	// Title 为告警消息与事件的标题，缺省为 Name
+	Title string `yaml:"title"`
+	// Metric 为 status、tps、mspt、mspt_max、players、latency、memory_used、memory_percent 之一
+	Metric         string `yaml:"metric"`
+	AlertCondition `yaml:",inline"`
+	// Severity 为 info、warning（缺省）或 critical
+	Severity string          `yaml:"severity"`
+	Recover  *AlertCondition `yaml:"recover"`
+	// Flapping 为该规则的抖动检测，缺省使用 warn.flapping
+	Flapping *FlapDetection `yaml:"flapping"`
+	// Servers 为规则适用的服务器 ID，为空时适用于所有服务器
+	Servers []string `yaml:"servers"`
+}
+
+// AppliesTo 判断规则是否适用于指定的服务器
+func (r AlertRule) AppliesTo(serverID string) bool {
+	if len(r.Servers) == 0 {
+		return true
+	}
+	for _, server := range r.Servers {
+		if server == serverID {
+			return true
+		}
+	}
+	return false
+}
+
+// validate 检查规则的名称、比较方式与严重程度，指标名称由使用方检查
+func (r AlertRule) validate() error {
+	if !validID(r.Name) {
+		return fmt.Errorf("invalid alert rule name %q", r.Name)
+	}
+	conditions := []AlertCondition{r.AlertCondition}
+	if r.Recover != nil {
+		conditions = append(conditions, *r.Recover)
+	}
+	for _, condition := range conditions {
+		if condition.For < 0 || condition.Samples < 0 {
+			return fmt.Errorf("alert rule %q: for and samples must not be negative", r.Name)
+		}
+		switch condition.Op {
+		case "==", "!=":
+		case "<", "<=", ">", ">=":
+			if r.Metric == "status" {
+				return fmt.Errorf("alert rule %q: operator %q is not supported by status", r.Name, condition.Op)
+			}
+		default:
+			return fmt.Errorf("alert rule %q: invalid operator %q", r.Name, condition.Op)
+		}
+	}
+	switch r.Severity {
+	case SeverityInfo, SeverityWarning, SeverityCritical:
+	default:
+		return fmt.Errorf("alert rule %q: invalid severity %q", r.Name, r.Severity)
+	}
+	if r.Flapping != nil {
+		if err := r.Flapping.validate(); err != nil {
+			return fmt.Errorf("alert rule %q: %w", r.Name, err)
+		}
+	}
+	return nil
+}
+
+// validate 检查抖动检测的次数与时间窗口
+func (f FlapDetection) validate() error {
+	if f.Changes < 0 || (f.Changes > 0 && f.Window <= 0) {
+		return fmt.Errorf("invalid flapping detection (changes %d, window %s)", f.Changes, f.Window)
+	}
+	return nil
+}
+
+// Rules 把内置告警规则转换为等价的告警规则
+func (w WarnTypes) Rules() []AlertRule {
+	var rules []AlertRule
+	if w.Offline {
+		rules = append(rules, AlertRule{
+			Name: "offline", Title: "服务器离线", Metric: "status", Severity: SeverityCritical,
+			AlertCondition: AlertCondition{Op: "==", Value: "offline"},
+		})
+	}
+	if w.LowTps.Enabled {
+		rule := AlertRule{
+			Name: "low_tps", Title: "TPS过低", Metric: "tps", Severity: SeverityWarning,
+			AlertCondition: AlertCondition{Op: "<", Threshold: w.LowTps.Threold, For: w.LowTps.For, Samples: w.LowTps.Samples},
+		}
+		if w.LowTps.RecoverThreshold != 0 {
+			rule.Recover = &AlertCondition{Op: ">=", Threshold: w.LowTps.RecoverThreshold}
+		}
+		rules = append(rules, rule)
+	}
+	if w.HighMspt.Enabled {
+		rule := AlertRule{
+			Name: "high_mspt", Title: "MSPT过高", Metric: "mspt_max", Severity: SeverityWarning,
+			AlertCondition: AlertCondition{Op: ">", Threshold: w.HighMspt.Threshold, For: w.HighMspt.For, Samples: w.HighMspt.Samples},
+		}
+		if w.HighMspt.RecoverThreshold != 0 {
+			rule.Recover = &AlertCondition{Op: "<=", Threshold: w.HighMspt.RecoverThreshold}
+		}
+		rules = append(rules, rule)
+	}
+	if w.Degraded {
+		// 离线时由离线告警接管，只有恢复 online 才算监控恢复正常
+		rules = append(rules, AlertRule{
+			Name: "degraded", Title: "服务器监控异常", Metric: "status", Severity: SeverityWarning,
+			AlertCondition: AlertCondition{Op: "==", Value: "degraded"},
+			Recover:        &AlertCondition{Op: "==", Value: "online"},
+		})
+	}
+	return rules
+}
+
+// HasProbe 判断是否启用了指定的探测方式
+func (c ServerConfig) HasProbe(name string) bool {
+	for _, probe := range c.Probes {
+		if probe == name {
+			return true
+		}
+	}
+	return false
+}
+
+// PingProbe 是无需认证、定期发起一次查询的探测方式的配置
+type PingProbe struct {
+	Address  string        `yaml:"address"`
+	Interval time.Duration `yaml:"interval"`
+	Timeout  time.Duration `yaml:"timeout"`
+}
+
+// setDefaults 填充缺省的地址、周期和超时
+func (p *PingProbe) setDefaults(address string) {
+	if p.Address == "" {
+		p.Address = address
+	}
+	if p.Interval <= 0 {
+		p.Interval = 10 * time.Second
+	}
+	if p.Timeout <= 0 {
+		p.Timeout = 5 * time.Second
+	}
+}
+
+// HasCollector 判断是否启用了指定的 RCON 采集器
+func (c ServerConfig) HasCollector(name string) bool {
+	for _, collector := range c.Rcon.Collectors {
+		if collector == name {
+			return true
+		}
+	}
+	return false
+}
+
+// probePriority 是决定在线状态时各探测方式的优先级
+var probePriority = []string{"rcon", "query", "slp", "bedrock"}
+
+// PrimaryProbe 返回决定服务器在线状态和玩家数的探测方式，其余探测只作为补充信息
+func (c ServerConfig) PrimaryProbe() string {
+	for _, probe := range probePriority {
+		if c.HasProbe(probe) {
+			return probe
+		}
+	}
+	return ""
+}
+
+// setDefaults 填充单台服务器的缺省值，warn 与 rules 为全局的内置告警规则与自定义告警规则
+func (c *ServerConfig) setDefaults(warn WarnTypes, rules []AlertRule, flapping FlapDetection) {
+	if len(c.Rcon.Collectors) == 0 {
+		c.Rcon.Collectors = []string{"list", "auto"} // 默认采集器
+	}
+	if len(c.Probes) == 0 {
+		c.Probes = []string{"rcon"}
+	}
+	c.SLP.setDefaults(c.ServerInfo.Address)
+	c.Query.setDefaults(c.ServerInfo.Address)
+	c.Bedrock.setDefaults(c.ServerInfo.Address)
+	if c.ServerInfo.Name == "" {
+		c.ServerInfo.Name = c.ID
+	}
+	if c.Alerts == nil {
+		c.Alerts = &warn
+	}
+
+	custom := map[string]bool{}
+	for _, rule := range rules {
+		custom[rule.Name] = true
+	}
+	c.Rules = nil
+	for _, rule := range c.Alerts.Rules() {
+		if !custom[rule.Name] {
+			c.Rules = append(c.Rules, rule)
+		}
+	}
+	for _, rule := range rules {
+		if rule.AppliesTo(c.ID) {
+			c.Rules = append(c.Rules, rule)
+		}
+	}
+	for i := range c.Rules {
+		if c.Rules[i].Flapping == nil {
+			c.Rules[i].Flapping = &flapping
+		}
+	}
+}
+
+// Server 按 ID 查找服务器配置
+func (c ConfigData) Server(id string) (ServerConfig, bool) {
+	for _, server := range c.Servers {
+		if server.ID == id {
+			return server, true
+		}
+	}
+	return ServerConfig{}, false
+}
+
+// Network 按 ID 查找群组服配置
+func (c ConfigData) Network(id string) (NetworkConfig, bool) {
+	for _, network := range c.Networks {
+		if network.ID == id {
+			return network, true
+		}
+	}
+	return NetworkConfig{}, false
+}
+
 var config ConfigData
 var once sync.Once
 
@@ -69,7 +402,106 @@ func Load() ConfigData {
 			log.Println("Host not defined in config, using 0.0.0.0 as default...")
 			config.Web.Host = "0.0.0.0" // 默认主机
 		}
+		config.Web.Location = time.Local
+		if config.Web.Timezone != "" {
+			location, err := time.LoadLocation(config.Web.Timezone)
+			if err != nil {
+				log.Fatalf("Invalid timezone %q in config: %v", config.Web.Timezone, err)
+			}
+			config.Web.Location = location
+		}
+
+		if len(config.Servers) == 0 {
+			log.Println("Servers not defined in config, using top-level server config as \"default\"...")
+			config.Legacy.ID = "default"
+			config.Servers = []ServerConfig{config.Legacy}
+		}
+		if err := config.Warn.Flapping.validate(); err != nil {
+			log.Fatalln("Invalid warn config:", err)
+		}
+		seen := map[string]bool{}
+		for i := range config.Warn.Rules {
+			rule := &config.Warn.Rules[i]
+			if rule.Title == "" {
+				rule.Title = rule.Name
+			}
+			if rule.Severity == "" {
+				rule.Severity = SeverityWarning
+			}
+			if err := rule.validate(); err != nil {
+				log.Fatalln("Invalid alert rule in config:", err)
+			}
+			if seen[rule.Name] {
+				log.Fatalf("Duplicate alert rule %q in config", rule.Name)
+			}
+			seen[rule.Name] = true
+		}
+
+		seen = map[string]bool{}
+		for i := range config.Servers {
+			server := &config.Servers[i]
+			if !validID(server.ID) {
+				log.Fatalf("Invalid server id %q in config", server.ID)
+			}
+			if seen[server.ID] {
+				log.Fatalf("Duplicate server id %q in config", server.ID)
+			}
+			seen[server.ID] = true
+			for j := range server.Maintenance {
+				if err := server.Maintenance[j].setup(config.Web.Location); err != nil {
+					log.Fatalf("Invalid maintenance window of server %q: %v", server.ID, err)
+				}
+			}
+			server.setDefaults(config.Warn.EnabledType, config.Warn.Rules, config.Warn.Flapping)
+		}
+
+		seen = map[string]bool{}
+		for i := range config.Networks {
+			network := &config.Networks[i]
+			if !validID(network.ID) {
+				log.Fatalf("Invalid network id %q in config", network.ID)
+			}
+			if seen[network.ID] {
+				log.Fatalf("Duplicate network id %q in config", network.ID)
+			}
+			seen[network.ID] = true
+			for _, member := range append([]string{network.Proxy}, network.Backends...) {
+				if _, ok := config.Server(member); !ok {
+					log.Fatalf("Network %q refers to unknown server %q", network.ID, member)
+				}
+			}
+			if network.Name == "" {
+				network.Name = network.ID
+			}
+		}
+
+		for _, rule := range config.Warn.Rules {
+			for _, server := range rule.Servers {
+				if _, ok := config.Server(server); !ok {
+					log.Fatalf("Alert rule %q refers to unknown server %q", rule.Name, server)
+				}
+			}
+		}
+
+		if err := config.setupChannels(); err != nil {
+			log.Fatalln("Invalid notification config:", err)
+		}
 	})
 
 	return config
 }
+
+// validID 判断服务器 ID 是否非空且只包含字母、数字、- 和 _
+func validID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+// TestServerRules 检查内置告警规则与 warn.rules 的合并：同名的自定义规则覆盖内置规则，
+// servers 限定规则适用的服务器，未配置抖动检测的规则使用 warn.flapping
+func TestServerRules(t *testing.T) {
+	var warn WarnTypes
+	warn.Offline = true
+	warn.LowTps.Enabled, warn.LowTps.Threold, warn.LowTps.RecoverThreshold = true, 18, 19.5
+	flapping := FlapDetection{Changes: 4, Window: 10 * time.Minute}
+	own := &FlapDetection{Changes: 2, Window: time.Minute}
+	rules := []AlertRule{
+		{Name: "low_tps", Metric: "tps", AlertCondition: AlertCondition{Op: "<", Threshold: 15}, Severity: SeverityCritical},
+		{Name: "crowded", Metric: "players", AlertCondition: AlertCondition{Op: ">", Threshold: 50}, Severity: SeverityInfo, Servers: []string{"creative"}},
+		{Name: "slow", Metric: "latency", AlertCondition: AlertCondition{Op: ">", Threshold: 300}, Severity: SeverityWarning, Flapping: own},
+	}
+	degradedOnly := WarnTypes{Degraded: true}
+
+	tests := []struct {
+		server ServerConfig
+		want   []string
+	}{
+		{ServerConfig{ID: "survival"}, []string{"offline", "low_tps", "slow"}},
+		// alerts 覆盖全局的内置告警规则
+		{ServerConfig{ID: "creative", Alerts: &degradedOnly}, []string{"degraded", "low_tps", "crowded", "slow"}},
+	}
+	for _, tt := range tests {
+		server := tt.server
+		server.setDefaults(warn, rules, flapping)
+
+		var got []string
+		for _, rule := range server.Rules {
+			got = append(got, rule.Name)
+			switch {
+			case rule.Name == "slow" && rule.Flapping != own:
+				t.Errorf("%s: rule slow lost its own flapping detection", server.ID)
+			case rule.Name != "slow" && (rule.Flapping == nil || *rule.Flapping != flapping):
+				t.Errorf("%s: rule %s got flapping %+v, want %+v", server.ID, rule.Name, rule.Flapping, flapping)
+			}
+			if rule.Name == "low_tps" && (rule.Threshold != 15 || rule.Recover != nil || rule.Severity != SeverityCritical) {
+				t.Errorf("%s: built-in low_tps was not replaced: %+v", server.ID, rule)
+			}
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got rules %v, want %v", server.ID, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: got rules %v, want %v", server.ID, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestWarnTypesRules(t *testing.T) {
+	var warn WarnTypes
+	warn.LowTps.Enabled, warn.LowTps.Threold, warn.LowTps.For, warn.LowTps.Samples = true, 18, 30*time.Second, 2
+	warn.HighMspt.Enabled, warn.HighMspt.Threshold, warn.HighMspt.RecoverThreshold = true, 100, 60
+
+	rules := warn.Rules()
+	if len(rules) != 2 {
+		t.Fatalf("got %d rules, want 2", len(rules))
+	}
+	lowTps, highMspt := rules[0], rules[1]
+	if lowTps.Op != "<" || lowTps.Threshold != 18 || lowTps.For != 30*time.Second || lowTps.Samples != 2 || lowTps.Recover != nil {
+		t.Errorf("got low_tps %+v", lowTps)
+	}
+	if highMspt.Metric != "mspt_max" || highMspt.Recover == nil || highMspt.Recover.Op != "<=" || highMspt.Recover.Threshold != 60 {
+		t.Errorf("got high_mspt %+v", highMspt)
+	}
+	for _, rule := range rules {
+		if err := rule.validate(); err != nil {
+			t.Error(err)
+		}
+	}
+}
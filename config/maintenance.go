@@ -0,0 +1,108 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"github.com/robfig/cron/v3"
+	"slices"
+	"strings"
+	"time"
+)
+
+// maxOccurrences 是一个周期性维护在一次查询中最多展开的次数，足以覆盖每分钟一次的维护在可用率接口最长的 90 天内的各次维护
+const maxOccurrences = 90 * 24 * 60
+
+// MaintenanceWindow 是计划维护的时段：一次性的维护使用 Start 与 End，时间格式为 RFC 3339，例如 2025-03-01T02:00:00+08:00；
+// 周期性的维护使用 Schedule 与 Duration
+type MaintenanceWindow struct {
+	Start  time.Time `yaml:"start" json:"start"`
+	End    time.Time `yaml:"end" json:"end"`
+	Reason string    `yaml:"reason" json:"reason"`
+	// Schedule 为每次维护开始的时间，使用标准的 5 位 cron 表达式（也支持 @daily 等），缺省按 web.timezone 解释，
+	// 例如 "0 4 * * 1" 表示每周一 4:00
+	Schedule string `yaml:"schedule" json:"schedule,omitempty"`
+	// Duration 为周期性维护每次持续的时长
+	Duration time.Duration `yaml:"duration" json:"-"`
+
+	// schedule 为解析后的 Schedule，一次性的维护为空
+	schedule cron.Schedule
+}
+
+// setup 检查维护时段并解析 Schedule，location 为未在表达式中指定 CRON_TZ 时使用的时区
+func (w *MaintenanceWindow) setup(location *time.Location) error {
+	if w.Schedule == "" {
+		if w.Duration != 0 {
+			return errors.New("duration requires schedule")
+		}
+		if !w.End.After(w.Start) {
+			return errors.New("window ends before it starts")
+		}
+		return nil
+	}
+
+	if !w.Start.IsZero() || !w.End.IsZero() {
+		return errors.New("recurring window must not set start or end")
+	}
+	if w.Duration <= 0 {
+		return errors.New("recurring window requires a positive duration")
+	}
+	spec := w.Schedule
+	if !strings.HasPrefix(spec, "CRON_TZ=") && !strings.HasPrefix(spec, "TZ=") {
+		spec = "CRON_TZ=" + location.String() + " " + spec
+	}
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return fmt.Errorf("invalid schedule %q: %w", w.Schedule, err)
+	}
+	// @every 按调用时间推算，不能表示固定的维护时间
+	if _, ok := schedule.(*cron.SpecSchedule); !ok {
+		return fmt.Errorf("invalid schedule %q: @every is not supported", w.Schedule)
+	}
+	w.schedule = schedule
+	return nil
+}
+
+// Occurrences 返回与 since 到 until 重叠的各次维护，周期性的维护展开为一次性的时段
+func (w MaintenanceWindow) Occurrences(since, until time.Time) []MaintenanceWindow {
+	if w.schedule == nil {
+		if w.Start.Before(until) && w.End.After(since) {
+			return []MaintenanceWindow{w}
+		}
+		return nil
+	}
+
+	var result []MaintenanceWindow
+	// 从 since 之前一个 Duration 开始查找，以包含在 since 之前开始、仍在进行的维护
+	next := since.Add(-w.Duration)
+	for len(result) < maxOccurrences {
+		start := w.schedule.Next(next)
+		if start.IsZero() || !start.Before(until) {
+			break
+		}
+		result = append(result, MaintenanceWindow{Start: start, End: start.Add(w.Duration), Reason: w.Reason, Schedule: w.Schedule})
+		next = start
+	}
+	return result
+}
+
+// MaintenanceBetween 返回服务器与 since 到 until 重叠的各次维护，按开始时间排序
+func (s ServerConfig) MaintenanceBetween(since, until time.Time) []MaintenanceWindow {
+	windows := []MaintenanceWindow{}
+	for _, window := range s.Maintenance {
+		windows = append(windows, window.Occurrences(since, until)...)
+	}
+	slices.SortStableFunc(windows, func(a, b MaintenanceWindow) int { return a.Start.Compare(b.Start) })
+	return windows
+}
+
+// ActiveMaintenance 返回服务器在 at 时正在进行的维护，有多个时返回最晚结束的一个
+func (s ServerConfig) ActiveMaintenance(at time.Time) (MaintenanceWindow, bool) {
+	var active MaintenanceWindow
+	found := false
+	for _, window := range s.MaintenanceBetween(at, at.Add(time.Nanosecond)) {
+		if !found || window.End.After(active.End) {
+			active, found = window, true
+		}
+	}
+	return active, found
+}
@@ -0,0 +1,140 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location
+}
+
+// TestOccurrences 检查周期性维护按表达式中的 CRON_TZ 或 web.timezone 展开，并包含在 since 之前开始、仍在进行的一次
+func TestOccurrences(t *testing.T) {
+	shanghai := mustLoadLocation(t, "Asia/Shanghai")
+	newYork := mustLoadLocation(t, "America/New_York")
+	// 2025-03-03 为周一
+	since := time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		schedule string
+		location *time.Location
+		since    time.Time
+		until    time.Time
+		want     []time.Time
+	}{
+		{
+			name:     "web.timezone",
+			schedule: "0 4 * * 1",
+			location: shanghai,
+			since:    since.Add(-24 * time.Hour),
+			until:    since.AddDate(0, 0, 13),
+			want:     []time.Time{time.Date(2025, 3, 3, 4, 0, 0, 0, shanghai), time.Date(2025, 3, 10, 4, 0, 0, 0, shanghai)},
+		},
+		{
+			name:     "CRON_TZ overrides web.timezone",
+			schedule: "CRON_TZ=America/New_York 0 4 * * 1",
+			location: shanghai,
+			since:    since,
+			until:    since.AddDate(0, 0, 8),
+			want:     []time.Time{time.Date(2025, 3, 3, 4, 0, 0, 0, newYork), time.Date(2025, 3, 10, 4, 0, 0, 0, newYork)},
+		},
+		{
+			// 2025-03-09 纽约进入夏令时，维护仍在当地 4:00 开始
+			name:     "daylight saving",
+			schedule: "CRON_TZ=America/New_York 0 4 * * *",
+			location: time.UTC,
+			since:    time.Date(2025, 3, 8, 12, 0, 0, 0, time.UTC),
+			until:    time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC),
+			want:     []time.Time{time.Date(2025, 3, 9, 4, 0, 0, 0, newYork)},
+		},
+		{
+			// since 落在上海时间 04:00 开始的维护中
+			name:     "ongoing",
+			schedule: "0 4 * * *",
+			location: shanghai,
+			since:    time.Date(2025, 3, 3, 5, 0, 0, 0, shanghai),
+			until:    time.Date(2025, 3, 3, 6, 0, 0, 0, shanghai),
+			want:     []time.Time{time.Date(2025, 3, 3, 4, 0, 0, 0, shanghai)},
+		},
+		{
+			name:     "ended before since",
+			schedule: "0 4 * * *",
+			location: shanghai,
+			since:    time.Date(2025, 3, 3, 6, 0, 0, 0, shanghai),
+			until:    time.Date(2025, 3, 3, 7, 0, 0, 0, shanghai),
+			want:     nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			window := MaintenanceWindow{Schedule: tt.schedule, Duration: 2 * time.Hour, Reason: "备份"}
+			if err := window.setup(tt.location); err != nil {
+				t.Fatal(err)
+			}
+			got := window.Occurrences(tt.since, tt.until)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d occurrences %v, want %v", len(got), got, tt.want)
+			}
+			for i, want := range tt.want {
+				if !got[i].Start.Equal(want) || !got[i].End.Equal(want.Add(2*time.Hour)) || got[i].Reason != "备份" {
+					t.Errorf("occurrence %d: got %s to %s, want %s", i, got[i].Start, got[i].End, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMaintenanceSetup(t *testing.T) {
+	start := time.Date(2025, 3, 1, 2, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		window MaintenanceWindow
+		err    string
+	}{
+		{"one-off", MaintenanceWindow{Start: start, End: start.Add(time.Hour)}, ""},
+		{"ends before start", MaintenanceWindow{Start: start, End: start}, "ends before it starts"},
+		{"duration without schedule", MaintenanceWindow{Start: start, End: start.Add(time.Hour), Duration: time.Hour}, "duration requires schedule"},
+		{"recurring with start", MaintenanceWindow{Schedule: "@daily", Start: start, Duration: time.Hour}, "must not set start or end"},
+		{"recurring without duration", MaintenanceWindow{Schedule: "@daily"}, "positive duration"},
+		{"invalid schedule", MaintenanceWindow{Schedule: "0 25 * * *", Duration: time.Hour}, "invalid schedule"},
+		{"every", MaintenanceWindow{Schedule: "@every 1h", Duration: time.Minute}, "@every is not supported"},
+	}
+	for _, tt := range tests {
+		err := tt.window.setup(time.UTC)
+		if (err == nil) != (tt.err == "") || (err != nil && !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+// TestActiveMaintenance 检查重叠的维护中返回最晚结束的一个
+func TestActiveMaintenance(t *testing.T) {
+	start := time.Date(2025, 3, 1, 2, 0, 0, 0, time.UTC)
+	daily := MaintenanceWindow{Schedule: "0 2 * * *", Duration: 30 * time.Minute, Reason: "重启"}
+	if err := daily.setup(time.UTC); err != nil {
+		t.Fatal(err)
+	}
+	server := ServerConfig{Maintenance: []MaintenanceWindow{
+		daily,
+		{Start: start.Add(-time.Hour), End: start.Add(time.Hour), Reason: "迁移"},
+	}}
+
+	if window, ok := server.ActiveMaintenance(start.Add(10 * time.Minute)); !ok || window.Reason != "迁移" {
+		t.Errorf("got %+v, %v, want the later-ending window", window, ok)
+	}
+	if window, ok := server.ActiveMaintenance(start.Add(time.Hour)); ok {
+		t.Errorf("got %+v after both windows ended", window)
+	}
+	windows := server.MaintenanceBetween(start.Add(-2*time.Hour), start.Add(25*time.Hour))
+	if len(windows) != 3 || windows[0].Reason != "迁移" || !windows[2].Start.Equal(start.AddDate(0, 0, 1)) {
+		t.Errorf("got %+v", windows)
+	}
+}
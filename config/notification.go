@@ -0,0 +1,234 @@
+package config
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// NotificationChannel 是一个通知渠道，Type 决定使用哪些连接字段，各类型的用法见 config.yml 中的说明
+type NotificationChannel struct {
+	// Name 用于区分渠道，记录在通知日志中
+	Name string `yaml:"name"`
+	// Type 为 webhook、dingtalk、discord、slack、telegram、feishu、wecom、ntfy、gotify、bark、smtp 之一
+	Type string `yaml:"type"`
+	// URL 为 Webhook 地址，telegram、ntfy、gotify、bark 为服务地址，其中 telegram、ntfy、bark 缺省为官方服务
+	URL string `yaml:"url"`
+	// Token 为 dingtalk 的 access_token、telegram 的机器人令牌、ntfy 的访问令牌、gotify 的应用令牌或 bark 的设备 key
+	Token string `yaml:"token"`
+	// Secret 为 dingtalk、feishu 的签名密钥，未开启签名校验时留空
+	Secret string `yaml:"secret"`
+	// ChatID 为 telegram 接收消息的会话
+	ChatID string `yaml:"chat_id"`
+	// Topic 为 ntfy 的主题
+	Topic string `yaml:"topic"`
+	// AtMobile 为 dingtalk 消息中 @ 的手机号，* 表示 @ 所有人
+	AtMobile string `yaml:"at_mobile"`
+	// Headers 为 webhook 请求附带的 HTTP 头，例如认证信息
+	Headers map[string]string `yaml:"headers"`
+	SMTP    SMTPConfig        `yaml:"smtp"`
+
+	// Severities 为推送的严重程度，为空时推送所有消息
+	Severities []string `yaml:"severities"`
+	// Servers 为推送的服务器 ID，为空时推送所有服务器的消息；不属于特定服务器的消息（如监控上线）总会推送
+	Servers []string `yaml:"servers"`
+}
+
+// SMTPConfig 是 smtp 渠道的发信配置，端口为 465 时使用 TLS 连接，其余端口在服务器支持时使用 STARTTLS
+type SMTPConfig struct {
+	Host     string   `yaml:"host"`
+	Port     int      `yaml:"port"`
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+}
+
+// Route 是告警路由树的一个节点：告警按深度优先依次匹配子节点，使用最深一层匹配的节点，
+// 子节点均不匹配时使用自身；Continue 为 true 的节点匹配后继续匹配后面的兄弟节点
+//
+// Receivers、GroupBy、GroupWait、RepeatInterval 未配置时继承上级，根节点的 Receivers 缺省为全部渠道
+type Route struct {
+	Match     RouteMatch `yaml:"match"`
+	Receivers []string   `yaml:"receivers"`
+	// GroupBy 为分组依据，可选 server、rule、severity；为空时同一节点的告警合并为一组
+	GroupBy []string `yaml:"group_by"`
+	// GroupWait 为组内出现新告警或恢复后等待多久再推送，期间的变化合并为一条消息；为 0 时在本轮检查结束时推送
+	GroupWait time.Duration `yaml:"group_wait"`
+	// RepeatInterval 为仍有告警未恢复时重复提醒的间隔，为 0 时不重复
+	RepeatInterval time.Duration `yaml:"repeat_interval"`
+	// Escalations 为告警持续未恢复时的升级策略，按 After 排序后依次触发，不继承
+	Escalations []Escalation `yaml:"escalations"`
+	Continue    bool         `yaml:"continue"`
+	Routes      []Route      `yaml:"routes"`
+}
+
+// RouteMatch 是路由节点的匹配条件，各项为空时不限，同一项中满足任一值即可
+type RouteMatch struct {
+	Servers    []string `yaml:"servers"`
+	Rules      []string `yaml:"rules"`
+	Severities []string `yaml:"severities"`
+}
+
+// Escalation 在组内最早的告警持续 After 仍未恢复时，额外推送到 Receivers，AtMobile 覆盖 dingtalk 渠道 @ 的手机号
+type Escalation struct {
+	After     time.Duration `yaml:"after"`
+	Receivers []string      `yaml:"receivers"`
+	AtMobile  string        `yaml:"at_mobile"`
+}
+
+// Matches 判断告警是否满足匹配条件，servers 中任一服务器满足即可；rule 为空表示不是告警规则产生的消息，
+// 只有不限规则的节点能够匹配
+func (m RouteMatch) Matches(servers []string, rule, severity string) bool {
+	if len(m.Severities) > 0 && !slices.Contains(m.Severities, severity) {
+		return false
+	}
+	if len(m.Rules) > 0 && !slices.Contains(m.Rules, rule) {
+		return false
+	}
+	if len(m.Servers) == 0 {
+		return true
+	}
+	for _, server := range servers {
+		if slices.Contains(m.Servers, server) {
+			return true
+		}
+	}
+	return false
+}
+
+// Accepts 判断渠道是否推送指定严重程度、涉及指定服务器的消息，servers 为空表示消息不属于特定服务器
+func (c NotificationChannel) Accepts(severity string, servers []string) bool {
+	if len(c.Severities) > 0 && !slices.Contains(c.Severities, severity) {
+		return false
+	}
+	if len(c.Servers) == 0 || len(servers) == 0 {
+		return true
+	}
+	for _, server := range servers {
+		if slices.Contains(c.Servers, server) {
+			return true
+		}
+	}
+	return false
+}
+
+// setupChannels 把旧版的 dingtalkBot 配置加入通知渠道，并检查各渠道的名称、严重程度与服务器，
+// 渠道类型与连接字段由使用方检查
+func (c *ConfigData) setupChannels() error {
+	bot := c.Warn.DingTalkBot
+	if bot.Enabled {
+		c.Warn.Channels = append([]NotificationChannel{{
+			Name:     "dingtalk",
+			Type:     "dingtalk",
+			Token:    bot.AccessToken,
+			Secret:   bot.Secret,
+			AtMobile: bot.AtMobile,
+		}}, c.Warn.Channels...)
+	}
+
+	seen := map[string]bool{}
+	for _, channel := range c.Warn.Channels {
+		if !validID(channel.Name) {
+			return fmt.Errorf("invalid channel name %q", channel.Name)
+		}
+		if seen[channel.Name] {
+			return fmt.Errorf("duplicate channel %q", channel.Name)
+		}
+		seen[channel.Name] = true
+		for _, severity := range channel.Severities {
+			switch severity {
+			case SeverityInfo, SeverityWarning, SeverityCritical:
+			default:
+				return fmt.Errorf("channel %q: invalid severity %q", channel.Name, severity)
+			}
+		}
+		for _, server := range channel.Servers {
+			if _, ok := c.Server(server); !ok {
+				return fmt.Errorf("channel %q refers to unknown server %q", channel.Name, server)
+			}
+		}
+	}
+
+	if len(c.Warn.Route.Receivers) == 0 {
+		for _, channel := range c.Warn.Channels {
+			c.Warn.Route.Receivers = append(c.Warn.Route.Receivers, channel.Name)
+		}
+	}
+	rules := map[string]bool{}
+	for _, server := range c.Servers {
+		for _, rule := range server.Rules {
+			rules[rule.Name] = true
+		}
+	}
+	return c.setupRoute(&c.Warn.Route, nil, seen, rules)
+}
+
+// setupRoute 让路由节点继承上级的设置，并检查其中引用的渠道、服务器、规则与严重程度
+func (c *ConfigData) setupRoute(route, parent *Route, channels, rules map[string]bool) error {
+	if parent != nil {
+		if len(route.Receivers) == 0 {
+			route.Receivers = parent.Receivers
+		}
+		if len(route.GroupBy) == 0 {
+			route.GroupBy = parent.GroupBy
+		}
+		if route.GroupWait == 0 {
+			route.GroupWait = parent.GroupWait
+		}
+		if route.RepeatInterval == 0 {
+			route.RepeatInterval = parent.RepeatInterval
+		}
+	}
+
+	// 升级按 After 从早到晚依次触发
+	slices.SortFunc(route.Escalations, func(a, b Escalation) int { return cmp.Compare(a.After, b.After) })
+	receivers := route.Receivers
+	for i, escalation := range route.Escalations {
+		if escalation.After <= 0 {
+			return fmt.Errorf("route escalation after %s: after must be positive", escalation.After)
+		}
+		if i > 0 && escalation.After == route.Escalations[i-1].After {
+			return fmt.Errorf("route has duplicate escalations after %s", escalation.After)
+		}
+		if len(escalation.Receivers) == 0 {
+			return fmt.Errorf("route escalation after %s has no receivers", escalation.After)
+		}
+		receivers = append(slices.Clone(receivers), escalation.Receivers...)
+	}
+	for _, receiver := range receivers {
+		if !channels[receiver] {
+			return fmt.Errorf("route refers to unknown channel %q", receiver)
+		}
+	}
+	for _, label := range route.GroupBy {
+		if label != "server" && label != "rule" && label != "severity" {
+			return fmt.Errorf("route: invalid group_by label %q", label)
+		}
+	}
+	for _, server := range route.Match.Servers {
+		if _, ok := c.Server(server); !ok {
+			return fmt.Errorf("route refers to unknown server %q", server)
+		}
+	}
+	for _, rule := range route.Match.Rules {
+		if !rules[rule] {
+			return fmt.Errorf("route refers to unknown alert rule %q", rule)
+		}
+	}
+	for _, severity := range route.Match.Severities {
+		switch severity {
+		case SeverityInfo, SeverityWarning, SeverityCritical:
+		default:
+			return fmt.Errorf("route: invalid severity %q", severity)
+		}
+	}
+
+	for i := range route.Routes {
+		if err := c.setupRoute(&route.Routes[i], route, channels, rules); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetupRouteEscalations(t *testing.T) {
+	tests := []struct {
+		name        string
+		escalations []Escalation
+		want        []time.Duration
+		err         string
+	}{
+		{
+			name:        "sorted by after",
+			escalations: []Escalation{{After: 30 * time.Minute, Receivers: []string{"boss"}}, {After: 10 * time.Minute, Receivers: []string{"lead"}}},
+			want:        []time.Duration{10 * time.Minute, 30 * time.Minute},
+		},
+		{
+			name:        "zero after",
+			escalations: []Escalation{{Receivers: []string{"lead"}}},
+			err:         "after must be positive",
+		},
+		{
+			name:        "negative after",
+			escalations: []Escalation{{After: -time.Minute, Receivers: []string{"lead"}}},
+			err:         "after must be positive",
+		},
+		{
+			name:        "duplicate after",
+			escalations: []Escalation{{After: time.Minute, Receivers: []string{"lead"}}, {After: time.Minute, Receivers: []string{"boss"}}},
+			err:         "duplicate escalations",
+		},
+		{
+			name:        "no receivers",
+			escalations: []Escalation{{After: time.Minute}},
+			err:         "no receivers",
+		},
+		{
+			name:        "unknown receiver",
+			escalations: []Escalation{{After: time.Minute, Receivers: []string{"nobody"}}},
+			err:         `unknown channel "nobody"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c ConfigData
+			for _, name := range []string{"ops", "lead", "boss"} {
+				c.Warn.Channels = append(c.Warn.Channels, NotificationChannel{Name: name, Type: "webhook"})
+			}
+			// 升级策略不继承，子节点的升级同样需要检查
+			c.Warn.Route.Routes = []Route{{Escalations: tt.escalations}}
+
+			err := c.setupChannels()
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			route := c.Warn.Route.Routes[0]
+			if len(route.Receivers) != 3 {
+				t.Errorf("got receivers %v, want inherited from root", route.Receivers)
+			}
+			for i, after := range tt.want {
+				if route.Escalations[i].After != after {
+					t.Errorf("escalation %d: got after %s, want %s", i, route.Escalations[i].After, after)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package bedrock
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/MeowLynxSea/Uptimeow/config"
+	"github.com/MeowLynxSea/Uptimeow/internal/event"
+	"log"
+	"math/rand"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Status 是 RakNet Unconnected Pong 中携带的服务器信息
+type Status struct {
+	Edition      string
+	Motd         string
+	SubMotd      string
+	Protocol     int
+	Version      string
+	OnlinePlayer int
+	MaxPlayer    int
+	ServerGUID   string
+	GameMode     string
+	PortV4       int
+	PortV6       int
+	Latency      time.Duration
+}
+
+const (
+	idUnconnectedPing = 0x01
+	idUnconnectedPong = 0x1c
+
+	defaultPort = 19132
+
+	// retryInterval 是未收到回应时重发 ping 的间隔，UDP 包可能丢失
+	retryInterval = time.Second
+)
+
+// offlineMessageID 是 RakNet 离线消息中固定的魔数
+var offlineMessageID = []byte{
+	0x00, 0xff, 0xff, 0x00, 0xfe, 0xfe, 0xfe, 0xfe,
+	0xfd, 0xfd, 0xfd, 0xfd, 0x12, 0x34, 0x56, 0x78,
+}
+
+// colorCodeRegexp 匹配 MOTD 中的 § 格式代码
+var colorCodeRegexp = regexp.MustCompile(`§.`)
+
+// InitBedrock 按 server 配置的周期对基岩版服务器发送 Unconnected Ping，结果发布到 bus
+//
+// 成功时发布 Status，失败时发布 event.ProbeFailed
+func InitBedrock(server config.ServerConfig, bus *event.Bus) {
+	probe := server.Bedrock
+	addr := probe.Address
+	log.Println("[INFO] [" + server.ID + "] Starting Bedrock ping probe for " + addr + "...")
+
+	ticker := time.NewTicker(probe.Interval)
+	defer ticker.Stop()
+	for ; ; <-ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), probe.Timeout)
+		status, err := Ping(ctx, addr)
+		cancel()
+		if err != nil {
+			bus.Publish(server.ID, event.ProbeFailed{Probe: "bedrock", Reason: err.Error()})
+			continue
+		}
+		bus.Publish(server.ID, status)
+	}
+}
+
+// Ping 向 addr 发送 RakNet Unconnected Ping 并解析回应，addr 未指定端口时使用 19132
+//
+// 在 ctx 结束前每隔一秒重发一次，直到收到匹配的 Pong
+func Ping(ctx context.Context, addr string) (Status, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, strconv.Itoa(defaultPort))
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return Status{}, err
+	}
+	defer conn.Close()
+
+	clientGUID := rand.Int63()
+	buf := make([]byte, 1500)
+	for {
+		if err := ctx.Err(); err != nil {
+			return Status{}, err
+		}
+
+		startTime := time.Now()
+		sendTime := startTime.UnixMilli()
+		if _, err := conn.Write(marshalPing(sendTime, clientGUID)); err != nil {
+			return Status{}, err
+		}
+
+		deadline := startTime.Add(retryInterval)
+		if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+			deadline = ctxDeadline
+		}
+		conn.SetReadDeadline(deadline)
+
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					break
+				}
+				return Status{}, err
+			}
+
+			pongTime, status, err := parsePong(buf[:n])
+			if err != nil || pongTime != sendTime {
+				// 忽略无关或过期的包，继续等待本次 ping 的回应
+				continue
+			}
+			status.Latency = time.Since(startTime)
+			return status, nil
+		}
+	}
+}
+
+func marshalPing(sendTime, clientGUID int64) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(idUnconnectedPing)
+	binary.Write(&buf, binary.BigEndian, sendTime)
+	buf.Write(offlineMessageID)
+	binary.Write(&buf, binary.BigEndian, clientGUID)
+	return buf.Bytes()
+}
+
+// parsePong 解析 Unconnected Pong，返回其中回显的发送时间和服务器信息
+func parsePong(b []byte) (int64, Status, error) {
+	const headerSize = 1 + 8 + 8 + 16 + 2
+	if len(b) < headerSize || b[0] != idUnconnectedPong {
+		return 0, Status{}, errors.New("bedrock: not an unconnected pong")
+	}
+	if !bytes.Equal(b[17:33], offlineMessageID) {
+		return 0, Status{}, errors.New("bedrock: bad offline message id")
+	}
+
+	sendTime := int64(binary.BigEndian.Uint64(b[1:9]))
+	length := int(binary.BigEndian.Uint16(b[33:35]))
+	if len(b) < headerSize+length {
+		return 0, Status{}, errors.New("bedrock: truncated server id string")
+	}
+
+	status, err := parseServerID(string(b[headerSize : headerSize+length]))
+	return sendTime, status, err
+}
+
+// parseServerID 解析以分号分隔的服务器信息，例如
+// "MCPE;Dedicated Server;527;1.19.1;0;10;13253860892328930865;Bedrock level;Survival;1;19132;19133;"
+//
+// 较旧的服务端只返回前六项，缺失的字段保持零值
+func parseServerID(s string) (Status, error) {
+	fields := strings.Split(s, ";")
+	if len(fields) < 6 {
+		return Status{}, fmt.Errorf("bedrock: expected at least 6 fields in %q", s)
+	}
+	for len(fields) < 12 {
+		fields = append(fields, "")
+	}
+
+	status := Status{
+		Edition:    fields[0],
+		Motd:       colorCodeRegexp.ReplaceAllString(fields[1], ""),
+		Version:    fields[3],
+		ServerGUID: fields[6],
+		SubMotd:    colorCodeRegexp.ReplaceAllString(fields[7], ""),
+		GameMode:   fields[8],
+	}
+	var err error
+	if status.Protocol, err = strconv.Atoi(fields[2]); err != nil {
+		return Status{}, fmt.Errorf("bedrock: bad protocol %q", fields[2])
+	}
+	if status.OnlinePlayer, err = strconv.Atoi(fields[4]); err != nil {
+		return Status{}, fmt.Errorf("bedrock: bad player count %q", fields[4])
+	}
+	if status.MaxPlayer, err = strconv.Atoi(fields[5]); err != nil {
+		return Status{}, fmt.Errorf("bedrock: bad max player count %q", fields[5])
+	}
+	status.PortV4, _ = strconv.Atoi(fields[10])
+	status.PortV6, _ = strconv.Atoi(fields[11])
+	return status, nil
+}
@@ -0,0 +1,159 @@
+package bedrock
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeServer 在本地监听 UDP，对每个 Unconnected Ping 依次回应 replies 返回的各个服务器信息，
+// replies 的参数为收到的第几个 ping（从 0 开始），返回的每一项为一个 Pong
+func fakeServer(t *testing.T, replies func(n int, sendTime []byte) [][]byte) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 1500)
+		for n := 0; ; n++ {
+			size, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if size != 1+8+16+8 || buf[0] != idUnconnectedPing || !bytes.Equal(buf[9:25], offlineMessageID) {
+				t.Errorf("bad ping % x", buf[:size])
+				continue
+			}
+			for _, reply := range replies(n, append([]byte(nil), buf[1:9]...)) {
+				conn.WriteTo(reply, addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+// pong 构造 Unconnected Pong，length 为包中声明的服务器信息长度
+func pong(sendTime []byte, serverID string, length int) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(idUnconnectedPong)
+	buf.Write(sendTime)
+	binary.Write(&buf, binary.BigEndian, int64(0x1234))
+	buf.Write(offlineMessageID)
+	binary.Write(&buf, binary.BigEndian, uint16(length))
+	buf.WriteString(serverID)
+	return buf.Bytes()
+}
+
+func validPong(sendTime []byte, serverID string) []byte {
+	return pong(sendTime, serverID, len(serverID))
+}
+
+const bdsServerID = "MCPE;§aDedicated §lServer;766;1.21.50;3;10;13253860892328930865;§7Bedrock level;Survival;1;19132;19133;"
+
+func pingAddr(t *testing.T, addr string, timeout time.Duration) (Status, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return Ping(ctx, addr)
+}
+
+func TestPing(t *testing.T) {
+	addr := fakeServer(t, func(n int, sendTime []byte) [][]byte {
+		return [][]byte{validPong(sendTime, bdsServerID)}
+	})
+	status, err := pingAddr(t, addr, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status.Latency = 0
+	want := Status{
+		Edition:      "MCPE",
+		Motd:         "Dedicated Server",
+		SubMotd:      "Bedrock level",
+		Protocol:     766,
+		Version:      "1.21.50",
+		OnlinePlayer: 3,
+		MaxPlayer:    10,
+		ServerGUID:   "13253860892328930865",
+		GameMode:     "Survival",
+		PortV4:       19132,
+		PortV6:       19133,
+	}
+	if status != want {
+		t.Errorf("got %+v, want %+v", status, want)
+	}
+}
+
+// TestPingFewerFields 中较旧的服务端（以及部分代理）只返回前六项
+func TestPingFewerFields(t *testing.T) {
+	addr := fakeServer(t, func(n int, sendTime []byte) [][]byte {
+		return [][]byte{validPong(sendTime, "MCPE;Old Server;137;1.2.0;0;20")}
+	})
+	status, err := pingAddr(t, addr, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status.Latency = 0
+	want := Status{Edition: "MCPE", Motd: "Old Server", Protocol: 137, Version: "1.2.0", MaxPlayer: 20}
+	if status != want {
+		t.Errorf("got %+v, want %+v", status, want)
+	}
+}
+
+// TestPingTruncated 中第一个 Pong 的服务器信息短于声明的长度，应被忽略并在重发后使用完整的回应
+func TestPingTruncated(t *testing.T) {
+	addr := fakeServer(t, func(n int, sendTime []byte) [][]byte {
+		if n == 0 {
+			return [][]byte{pong(sendTime, bdsServerID[:20], len(bdsServerID))}
+		}
+		return [][]byte{validPong(sendTime, bdsServerID)}
+	})
+	status, err := pingAddr(t, addr, 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Motd != "Dedicated Server" || status.PortV6 != 19133 {
+		t.Errorf("got %+v", status)
+	}
+}
+
+func TestPingIgnoresStalePong(t *testing.T) {
+	addr := fakeServer(t, func(n int, sendTime []byte) [][]byte {
+		stale := make([]byte, 8)
+		binary.BigEndian.PutUint64(stale, 1)
+		return [][]byte{
+			validPong(stale, "MCPE;Stale;766;1.21.50;0;10"),
+			[]byte("garbage"),
+			validPong(sendTime, bdsServerID),
+		}
+	})
+	status, err := pingAddr(t, addr, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Motd != "Dedicated Server" {
+		t.Errorf("got %+v", status)
+	}
+}
+
+func TestPingTimeout(t *testing.T) {
+	addr := fakeServer(t, func(n int, sendTime []byte) [][]byte {
+		return [][]byte{pong(sendTime, "MCPE;Truncated", 100)}
+	})
+	if _, err := pingAddr(t, addr, 200*time.Millisecond); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestParseServerIDInvalid(t *testing.T) {
+	for _, serverID := range []string{"MCPE;Too;Few", "MCPE;Server;abc;1.21.50;0;10", "MCPE;Server;766;1.21.50;x;10"} {
+		if _, err := parseServerID(serverID); err == nil {
+			t.Errorf("%q: expected an error", serverID)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package collector
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Sample 是采集器解析出的一条数据，具体类型见本包中的 *Sample 结构体
+type Sample interface{}
+
+// Collector 描述一项通过 RCON 采集的指标
+//
+// 调度方每隔 Interval 依次执行 Commands 中的命令，再把各命令的输出按相同顺序交给 Parse
+type Collector interface {
+	// Name 是采集器的唯一名称，用于在配置文件中启用
+	Name() string
+	// Commands 返回一次采集需要执行的命令
+	Commands() []string
+	// Interval 返回采集周期
+	Interval() time.Duration
+	// Parse 解析命令输出，无法识别时返回错误
+	Parse(outputs []string) ([]Sample, error)
+}
+
+// Detector 是需要按服务端类型选择具体实现的采集器，例如不同服务端查询 TPS 的命令各不相同
+//
+// 调度方在每次建立连接后调用 Detect，并用其返回的采集器代替自身
+type Detector interface {
+	Collector
+	// Detect 借助 execute 执行试探命令，返回适用于当前服务端的采集器；
+	// 无法判断时返回自身，仅在命令执行失败时返回错误
+	Detect(execute func(command string) (string, error)) (Collector, error)
+}
+
+// Detect 对实现了 Detector 的采集器进行探测，其余采集器原样返回
+func Detect(c Collector, execute func(command string) (string, error)) (Collector, error) {
+	if d, ok := c.(Detector); ok {
+		return d.Detect(execute)
+	}
+	return c, nil
+}
+
+// detectFirst 依次尝试 candidates，返回第一个输出能被识别的采集器，都无法识别时返回 self
+//
+// 除 self 以外的候选若实现了 Detector，会先经过探测再尝试
+func detectFirst(self Collector, candidates []string, execute func(command string) (string, error)) (Collector, error) {
+	for _, name := range candidates {
+		candidate, ok := Get(name)
+		if !ok {
+			continue
+		}
+		if name != self.Name() {
+			var err error
+			if candidate, err = Detect(candidate, execute); err != nil {
+				return nil, err
+			}
+		}
+
+		outputs := make([]string, 0, len(candidate.Commands()))
+		for _, command := range candidate.Commands() {
+			output, err := execute(command)
+			if err != nil {
+				return nil, err
+			}
+			outputs = append(outputs, output)
+		}
+		if _, err := candidate.Parse(outputs); err == nil {
+			return candidate, nil
+		}
+	}
+	return self, nil
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Collector{}
+)
+
+// Register 注册一个采集器，名称重复时 panic
+func Register(c Collector) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[c.Name()]; ok {
+		panic("collector: Register called twice for " + c.Name())
+	}
+	registry[c.Name()] = c
+}
+
+// Get 按名称查找已注册的采集器
+func Get(name string) (Collector, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	c, ok := registry[name]
+	return c, ok
+}
+
+// Names 返回所有已注册采集器的名称（按字母序）
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Lookup 按顺序查找一组采集器，遇到未注册的名称时返回错误
+func Lookup(names []string) ([]Collector, error) {
+	collectors := make([]Collector, 0, len(names))
+	for _, name := range names {
+		c, ok := Get(name)
+		if !ok {
+			return nil, fmt.Errorf("collector: unknown collector %q (available: %v)", name, Names())
+		}
+		collectors = append(collectors, c)
+	}
+	return collectors, nil
+}
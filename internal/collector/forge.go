@@ -0,0 +1,95 @@
+package collector
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// DimensionTPS 是单个维度（世界）的 TPS 与平均 tick 耗时（毫秒）
+type DimensionTPS struct {
+	Name string  `json:"name"`
+	TPS  float64 `json:"tps"`
+	MSPT float64 `json:"mspt"`
+}
+
+// DimensionSample 是各维度分别统计的 TPS，由 Forge/NeoForge 的 TPS 命令给出
+type DimensionSample struct {
+	Dimensions []DimensionTPS `json:"dimensions"`
+}
+
+var (
+	// forgeTPSRegexp 匹配 Forge 与旧版 NeoForge 的输出，例如
+	// "Dim minecraft:overworld (minecraft:overworld): Mean tick time: 0.523 ms. Mean TPS: 20.000"（括号中为维度类型）、
+	// 1.12 的 "Dim  0 : Mean tick time: ..." 以及 "Overall: Mean tick time: ..."
+	forgeTPSRegexp = regexp.MustCompile(`(?:Dim\s+(\S+?)\s*(?:\(([^)]*)\))?|(Overall))\s*:\s*Mean tick time:\s*(\d+(?:\.\d+)?)\s*ms\.?\s*Mean TPS:\s*(\d+(?:\.\d+)?)`)
+	// neoForgeTPSRegexp 匹配新版 NeoForge 的输出，例如
+	// "minecraft:overworld: 20.000 TPS (0.523 ms/tick)"、"Overworld (minecraft:overworld): 20.000 TPS (0.523 ms/tick)"
+	// 以及 "Overall: 20.000 TPS (1.234 ms/tick)"
+	neoForgeTPSRegexp = regexp.MustCompile(`(?:(Overall)|(\S+?)\s*(?:\(([^)]*)\))?)\s*:\s*(\d+(?:\.\d+)?)\s*TPS\s*\((\d+(?:\.\d+)?)\s*ms/tick\)`)
+)
+
+// forgeCollector 适用于 Forge 的 forge tps 与 NeoForge 的 neoforge tps 命令，两者输出格式相同或相近
+type forgeCollector struct {
+	name    string
+	command string
+}
+
+func init() {
+	Register(forgeCollector{name: "forge_tps", command: "forge tps"})
+	Register(forgeCollector{name: "neoforge_tps", command: "neoforge tps"})
+}
+
+func (c forgeCollector) Name() string          { return c.name }
+func (c forgeCollector) Commands() []string    { return []string{c.command} }
+func (forgeCollector) Interval() time.Duration { return 5 * time.Second }
+
+// Parse 解析每个维度一行的输出，Overall 一行作为整体 TPS。
+// Forge 只统计最近 100 tick，因此整体 TPS 只记录在 TPSSample.L1m 中
+func (forgeCollector) Parse(outputs []string) ([]Sample, error) {
+	// 通过 RCON 执行时多条消息会被直接拼接，因此不能按行匹配
+	response := colorCodeRegexp.ReplaceAllString(outputs[0], "")
+
+	var dimensions []DimensionTPS
+	overall := -1.0
+	add := func(name string, isOverall bool, tpsText, msptText string) {
+		tps, _ := strconv.ParseFloat(tpsText, 64)
+		mspt, _ := strconv.ParseFloat(msptText, 64)
+		if isOverall {
+			overall = tps
+			return
+		}
+		dimensions = append(dimensions, DimensionTPS{Name: name, TPS: tps, MSPT: mspt})
+	}
+	for _, match := range forgeTPSRegexp.FindAllStringSubmatch(response, -1) {
+		// Dim 后为维度 ID，括号中的维度类型可能由多个维度共用；1.12 及以前为数字 ID，有括号时取括号中的名称
+		name := match[1]
+		if _, err := strconv.Atoi(name); err == nil && match[2] != "" {
+			name = match[2]
+		}
+		add(name, match[3] != "", match[5], match[4])
+	}
+	for _, match := range neoForgeTPSRegexp.FindAllStringSubmatch(response, -1) {
+		// 有括号时括号外为维度的显示名称，括号中为维度 ID
+		name := match[3]
+		if name == "" {
+			name = match[2]
+		}
+		add(name, match[1] != "", match[4], match[5])
+	}
+
+	if len(dimensions) == 0 {
+		return nil, fmt.Errorf("no dimension TPS found")
+	}
+	if overall < 0 {
+		// 缺少 Overall 行时取各维度中最低的 TPS
+		overall = dimensions[0].TPS
+		for _, dimension := range dimensions[1:] {
+			if dimension.TPS < overall {
+				overall = dimension.TPS
+			}
+		}
+	}
+	return []Sample{TPSSample{L1m: overall}, DimensionSample{Dimensions: dimensions}}, nil
+}
@@ -0,0 +1,97 @@
+package collector
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestForgeParse(t *testing.T) {
+	tests := []struct {
+		name       string
+		output     string
+		overall    float64
+		dimensions []DimensionTPS
+	}{
+		{
+			// Forge 1.20.1 整合包，RCON 返回的多条消息直接拼接
+			"forge",
+			"Dim minecraft:overworld (minecraft:overworld): Mean tick time: 12.345 ms. Mean TPS: 20.000" +
+				"Dim minecraft:the_nether (minecraft:the_nether): Mean tick time: 0.482 ms. Mean TPS: 20.000" +
+				"Dim minecraft:the_end (minecraft:the_end): Mean tick time: 0.061 ms. Mean TPS: 20.000" +
+				"Dim twilightforest:twilight_forest (twilightforest:twilight_forest_type): Mean tick time: 61.904 ms. Mean TPS: 16.154" +
+				"Dim javd:void (minecraft:overworld): Mean tick time: 0.015 ms. Mean TPS: 20.000" +
+				"Overall: Mean tick time: 74.807 ms. Mean TPS: 13.368",
+			13.368,
+			[]DimensionTPS{
+				{"minecraft:overworld", 20, 12.345},
+				{"minecraft:the_nether", 20, 0.482},
+				{"minecraft:the_end", 20, 0.061},
+				{"twilightforest:twilight_forest", 16.154, 61.904},
+				{"javd:void", 20, 0.015},
+			},
+		},
+		{
+			"forge 1.12",
+			"Dim  0 : Mean tick time: 3.127 ms. Mean TPS: 20.000\nDim -1 : Mean tick time: 0.210 ms. Mean TPS: 20.000\n" +
+				"Dim  1 : Mean tick time: 0.034 ms. Mean TPS: 20.000\nDim  7 : Mean tick time: 55.000 ms. Mean TPS: 18.182\n" +
+				"Overall : Mean tick time: 58.371 ms. Mean TPS: 17.132",
+			17.132,
+			[]DimensionTPS{{"0", 20, 3.127}, {"-1", 20, 0.21}, {"1", 20, 0.034}, {"7", 18.182, 55}},
+		},
+		{
+			"neoforge",
+			"minecraft:overworld: 20.000 TPS (3.507 ms/tick)minecraft:the_nether: 20.000 TPS (0.125 ms/tick)" +
+				"minecraft:the_end: 20.000 TPS (0.048 ms/tick)aether:the_aether: 19.210 TPS (52.056 ms/tick)" +
+				"Overall: 18.175 TPS (55.021 ms/tick)",
+			18.175,
+			[]DimensionTPS{
+				{"minecraft:overworld", 20, 3.507},
+				{"minecraft:the_nether", 20, 0.125},
+				{"minecraft:the_end", 20, 0.048},
+				{"aether:the_aether", 19.21, 52.056},
+			},
+		},
+		{
+			// 带颜色代码与维度显示名称的输出
+			"neoforge named",
+			"§aOverworld (minecraft:overworld): 20.000 TPS (1.021 ms/tick)\n§eThe Nether (minecraft:the_nether): 17.540 TPS (57.012 ms/tick)\n" +
+				"§aOverall: 17.540 TPS (58.033 ms/tick)",
+			17.54,
+			[]DimensionTPS{{"minecraft:overworld", 20, 1.021}, {"minecraft:the_nether", 17.54, 57.012}},
+		},
+		{
+			// 缺少 Overall 行时取最低的维度 TPS
+			"without overall",
+			"Dim minecraft:overworld (minecraft:overworld): Mean tick time: 52.632 ms. Mean TPS: 19.000" +
+				"Dim mekanism:miner (minecraft:overworld): Mean tick time: 66.667 ms. Mean TPS: 15.000",
+			15,
+			[]DimensionTPS{{"minecraft:overworld", 19, 52.632}, {"mekanism:miner", 15, 66.667}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			samples, err := forgeCollector{}.Parse([]string{test.output})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := samples[0].(TPSSample); got != (TPSSample{L1m: test.overall}) {
+				t.Errorf("got %+v, want overall TPS %v", got, test.overall)
+			}
+			if got := samples[1].(DimensionSample).Dimensions; !slices.Equal(got, test.dimensions) {
+				t.Errorf("got dimensions %+v, want %+v", got, test.dimensions)
+			}
+		})
+	}
+}
+
+func TestForgeParseInvalid(t *testing.T) {
+	for _, output := range []string{
+		"Unknown or incomplete command, see below for error\nforge tps<--[HERE]",
+		"Overall: Mean tick time: 1.000 ms. Mean TPS: 20.000",
+		"Overall: 20.000 TPS (1.000 ms/tick)",
+	} {
+		if _, err := (forgeCollector{}).Parse([]string{output}); err == nil {
+			t.Errorf("%q: expected an error", output)
+		}
+	}
+}
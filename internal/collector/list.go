@@ -0,0 +1,94 @@
+package collector
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PlayerListSample 是 list 命令的解析结果
+type PlayerListSample struct {
+	OnlinePlayer int      `json:"online_player"`
+	MaxPlayer    int      `json:"max_player"`
+	PlayerList   []string `json:"player_list"`
+}
+
+var (
+	// vanillaListRegexp 匹配原版（1.13 起）及 Paper、Spigot、Purpur 的输出，例如 "There are 2 of a max of 20 players online: Steve, Alex"
+	vanillaListRegexp = regexp.MustCompile(`(?s)There are (\d+) of a max of (\d+) players online:?(.*)`)
+	// legacyListRegexp 匹配 1.12 及以前的 "There are 2/20 players online:"，玩家名位于其后（可能在下一行）
+	legacyListRegexp = regexp.MustCompile(`(?s)There are (\d+)/(\d+) players online:?(.*)`)
+	// essentialsListRegexp 匹配 EssentialsX 的 "There are 2 out of maximum 20 players online."，
+	// 有隐身玩家时为 "There are 2/1 out of maximum 20 players online."，其中 1 为隐身玩家数；玩家按权限组分行列出
+	essentialsListRegexp = regexp.MustCompile(`(?s)There are (\d+)(?:/\d+)? out of maximum (\d+) players online\.(.*)`)
+)
+
+type listCollector struct{}
+
+func init() {
+	Register(listCollector{})
+}
+
+func (listCollector) Name() string            { return "list" }
+func (listCollector) Commands() []string      { return []string{"list"} }
+func (listCollector) Interval() time.Duration { return 5 * time.Second }
+
+// Parse 解析 list 的输出，颜色代码会先被去掉；EssentialsX 的隐身玩家不计入在线人数，也不出现在玩家列表中
+func (listCollector) Parse(outputs []string) ([]Sample, error) {
+	response := colorCodeRegexp.ReplaceAllString(outputs[0], "")
+
+	var online, max, names string
+	var players []string
+	if m := vanillaListRegexp.FindStringSubmatch(response); m != nil {
+		online, max, names = m[1], m[2], m[3]
+		players = parsePlayerNames(names)
+	} else if m := legacyListRegexp.FindStringSubmatch(response); m != nil {
+		online, max, names = m[1], m[2], m[3]
+		players = parsePlayerNames(names)
+	} else if m := essentialsListRegexp.FindStringSubmatch(response); m != nil {
+		online, max = m[1], m[2]
+		players = parseEssentialsGroups(m[3])
+	} else {
+		return nil, errors.New("could not extract player count from list output")
+	}
+	onlinePlayer, _ := strconv.Atoi(online)
+	maxPlayer, _ := strconv.Atoi(max)
+
+	return []Sample{PlayerListSample{
+		OnlinePlayer: onlinePlayer,
+		MaxPlayer:    maxPlayer,
+		PlayerList:   players,
+	}}, nil
+}
+
+// parsePlayerNames 提取以 "," 分隔的玩家名，没有玩家时返回空列表
+func parsePlayerNames(names string) []string {
+	players := []string{}
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			players = append(players, name)
+		}
+	}
+	return players
+}
+
+// parseEssentialsGroups 提取 EssentialsX 按权限组分行列出的玩家，例如 "Admins: [AFK]Notch, Steve"，
+// 去掉 [AFK] 标记并跳过 [HIDDEN] 的隐身玩家
+func parseEssentialsGroups(groups string) []string {
+	players := []string{}
+	for _, line := range strings.Split(groups, "\n") {
+		_, names, ok := strings.Cut(line, ": ")
+		if !ok {
+			continue
+		}
+		for _, name := range parsePlayerNames(names) {
+			if strings.HasPrefix(name, "[HIDDEN]") {
+				continue
+			}
+			players = append(players, strings.TrimPrefix(name, "[AFK]"))
+		}
+	}
+	return players
+}
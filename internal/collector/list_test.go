@@ -0,0 +1,47 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestListParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   PlayerListSample
+	}{
+		{"paper", "There are 2 of a max of 20 players online: Steve, Alex", PlayerListSample{2, 20, []string{"Steve", "Alex"}}},
+		{"paper empty", "There are 0 of a max of 20 players online: ", PlayerListSample{0, 20, []string{}}},
+		{"spigot colored", "§6There are §c1§6 of a max of §c100§6 players online: §fNotch§r", PlayerListSample{1, 100, []string{"Notch"}}},
+		{"legacy", "There are 2/20 players online:\nSteve, Alex", PlayerListSample{2, 20, []string{"Steve", "Alex"}}},
+		{
+			"essentials grouped",
+			"§6There are §c3§6 out of maximum §c50§6 players online.\n§6admins§r: §7[AFK]§rNotch\n§6default§r: Steve, Alex",
+			PlayerListSample{3, 50, []string{"Notch", "Steve", "Alex"}},
+		},
+		{
+			"essentials hidden",
+			"§6There are §c2§6/§c1§6 out of maximum §c50§6 players online.\n§6default§r: Steve, §7[HIDDEN]§rHerobrine, Alex",
+			PlayerListSample{2, 50, []string{"Steve", "Alex"}},
+		},
+		{"essentials empty", "§6There are §c0§6 out of maximum §c50§6 players online.", PlayerListSample{0, 50, []string{}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			samples, err := listCollector{}.Parse([]string{test.output})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := samples[0].(PlayerListSample); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestListParseInvalid(t *testing.T) {
+	if _, err := (listCollector{}).Parse([]string{"Unknown command. Type \"/help\" for help."}); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,48 @@
+package collector
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MemorySample 是服务端 JVM 的内存占用（MB），Used 为已分配内存中正在使用的部分
+type MemorySample struct {
+	Used      int `json:"used"`
+	Allocated int `json:"allocated"`
+	Max       int `json:"max"`
+}
+
+// memoryRegexp 匹配 Essentials gc 命令输出中的内存信息，例如
+// "Maximum memory: 4,096 MB."、"Allocated memory: 2,048 MB."、"Free memory: 1,024 MB."
+var memoryRegexp = regexp.MustCompile(`(Maximum|Allocated|Free) memory:\s*([\d,]+)\s*MB`)
+
+// memoryCollector 通过 Essentials 的 gc 命令采集内存占用，需要安装 EssentialsX
+type memoryCollector struct{}
+
+func init() {
+	Register(memoryCollector{})
+}
+
+func (memoryCollector) Name() string            { return "memory" }
+func (memoryCollector) Commands() []string      { return []string{"gc"} }
+func (memoryCollector) Interval() time.Duration { return 10 * time.Second }
+
+func (memoryCollector) Parse(outputs []string) ([]Sample, error) {
+	response := colorCodeRegexp.ReplaceAllString(outputs[0], "")
+	values := map[string]int{}
+	for _, match := range memoryRegexp.FindAllStringSubmatch(response, -1) {
+		values[match[1]], _ = strconv.Atoi(strings.ReplaceAll(match[2], ",", ""))
+	}
+	if len(values) != 3 {
+		return nil, fmt.Errorf("memory usage not found")
+	}
+	sample := MemorySample{
+		Used:      values["Allocated"] - values["Free"],
+		Allocated: values["Allocated"],
+		Max:       values["Maximum"],
+	}
+	return []Sample{sample}, nil
+}
@@ -0,0 +1,41 @@
+package collector
+
+import "testing"
+
+func TestMemoryParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   MemorySample
+	}{
+		{
+			"essentials",
+			"§6Uptime:§c 2 hours 13 minutes 5 seconds\n§6Current TPS = §a20.0\n" +
+				"§6Maximum memory:§c 4,096 MB.\n§6Allocated memory:§c 2,048 MB.\n§6Free memory:§c 1,024 MB.\n" +
+				"§6World \"§cworld§6\" (§cNORMAL§6): §c1,234§6 chunks, §c567§6 entities, §c89§6 tiles.",
+			MemorySample{Used: 1024, Allocated: 2048, Max: 4096},
+		},
+		{
+			"small heap",
+			"Maximum memory: 512 MB.\nAllocated memory: 300 MB.\nFree memory: 45 MB.",
+			MemorySample{Used: 255, Allocated: 300, Max: 512},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			samples, err := memoryCollector{}.Parse([]string{test.output})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := samples[0].(MemorySample); got != test.want {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMemoryParseInvalid(t *testing.T) {
+	if _, err := (memoryCollector{}).Parse([]string{"§6Maximum memory:§c 4,096 MB."}); err == nil {
+		t.Error("expected an error")
+	}
+}
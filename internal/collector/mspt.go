@@ -0,0 +1,59 @@
+package collector
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// TickTimes 是某一时间窗口内每 tick 耗时（毫秒）的平均值、最小值与最大值
+type TickTimes struct {
+	Avg float64 `json:"avg"`
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+// MSPTSample 是 Paper/Purpur 的 mspt 命令给出的最近 5 秒、10 秒、1 分钟的 tick 耗时
+type MSPTSample struct {
+	L5s  TickTimes `json:"l5s"`
+	L10s TickTimes `json:"l10s"`
+	L1m  TickTimes `json:"l1m"`
+}
+
+var (
+	// colorCodeRegexp 匹配 § 格式代码
+	colorCodeRegexp = regexp.MustCompile(`§[0-9a-zA-Z]`)
+	// msptRegexp 匹配 "平均/最小/最大" 形式的一组 tick 耗时
+	msptRegexp = regexp.MustCompile(`(\d+(?:\.\d+)?)/(\d+(?:\.\d+)?)/(\d+(?:\.\d+)?)`)
+)
+
+type msptCollector struct{}
+
+func init() {
+	Register(msptCollector{})
+}
+
+func (msptCollector) Name() string            { return "mspt" }
+func (msptCollector) Commands() []string      { return []string{"mspt"} }
+func (msptCollector) Interval() time.Duration { return 5 * time.Second }
+
+// Parse 解析 mspt 的输出，例如
+//
+//	§6Server tick times §e(§7avg§e/§7min§e/§7max§e)§6 from last 5s§6,§6 10s§6,§6 1m§6:
+//	§6◴ §a5.2§7/§a3.1§7/§a12.4§e, §a5.0§7/§a2.9§7/§a15.0§e, §a5.1§7/§a2.8§7/§a30.2
+func (msptCollector) Parse(outputs []string) ([]Sample, error) {
+	response := colorCodeRegexp.ReplaceAllString(outputs[0], "")
+	matches := msptRegexp.FindAllStringSubmatch(response, -1)
+	if len(matches) != 3 {
+		return nil, fmt.Errorf("expected 3 tick time groups, got %d", len(matches))
+	}
+
+	var windows [3]TickTimes
+	for i, match := range matches {
+		windows[i].Avg, _ = strconv.ParseFloat(match[1], 64)
+		windows[i].Min, _ = strconv.ParseFloat(match[2], 64)
+		windows[i].Max, _ = strconv.ParseFloat(match[3], 64)
+	}
+	return []Sample{MSPTSample{L5s: windows[0], L10s: windows[1], L1m: windows[2]}}, nil
+}
@@ -0,0 +1,26 @@
+package collector
+
+import "testing"
+
+func TestMSPTParse(t *testing.T) {
+	output := "§6Server tick times §e(§7avg§e/§7min§e/§7max§e)§6 from last 5s§6,§6 10s§6,§6 1m§6:\n" +
+		"§6◴ §a5.2§7/§a3.1§7/§a12.4§e, §a5.0§7/§a2.9§7/§a15.0§e, §a5.1§7/§a2.8§7/§a30.2"
+	samples, err := msptCollector{}.Parse([]string{output})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := MSPTSample{
+		L5s:  TickTimes{Avg: 5.2, Min: 3.1, Max: 12.4},
+		L10s: TickTimes{Avg: 5.0, Min: 2.9, Max: 15.0},
+		L1m:  TickTimes{Avg: 5.1, Min: 2.8, Max: 30.2},
+	}
+	if got := samples[0].(MSPTSample); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestMSPTParseInvalid(t *testing.T) {
+	if _, err := (msptCollector{}).Parse([]string{"Unknown command. Type \"/help\" for help."}); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,59 @@
+package collector
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// sparkHeaderRegexp 匹配 TPS 的标题及其后的一行数值，数值可能与标题在同一行
+	sparkHeaderRegexp = regexp.MustCompile(`TPS from last ([\w ,]+):\s*(.*)`)
+	// sparkTPSRegexp 匹配 TPS 一行中的数值，超过 20 时带有 * 前缀
+	sparkTPSRegexp = regexp.MustCompile(`\*?(\d+(?:\.\d+)?)`)
+)
+
+// sparkCollector 适用于安装了 spark 的服务端（常见于 Fabric 和 Quilt）
+type sparkCollector struct{}
+
+func init() {
+	Register(sparkCollector{})
+}
+
+func (sparkCollector) Name() string            { return "spark_tps" }
+func (sparkCollector) Commands() []string      { return []string{"spark tps"} }
+func (sparkCollector) Interval() time.Duration { return 5 * time.Second }
+
+// Parse 解析 spark tps 的输出，例如
+//
+//	TPS from last 5s, 10s, 1m, 5m, 15m:
+//	 ▶ *20.0, 20.0, 19.97, 19.99, 20.0
+//
+//	Tick durations (min/med/95%ile/max ms) from last 10s, 1m:
+//	 ▶ 0.8/1.2/2.5/10.1;  0.7/1.3/2.6/35.2
+//
+// 只读取标题及其后第一行数值，tick 耗时、CPU 等其余部分在部分版本与平台上不存在，不参与解析
+func (sparkCollector) Parse(outputs []string) ([]Sample, error) {
+	m := sparkHeaderRegexp.FindStringSubmatch(colorCodeRegexp.ReplaceAllString(outputs[0], ""))
+	if m == nil {
+		return nil, fmt.Errorf("TPS header not found")
+	}
+	labels := strings.Split(m[1], ",")
+	matches := sparkTPSRegexp.FindAllStringSubmatch(m[2], -1)
+	if len(matches) != len(labels) {
+		return nil, fmt.Errorf("expected %d TPS values, got %d", len(labels), len(matches))
+	}
+
+	numbers := map[string]float64{}
+	for i, label := range labels {
+		numbers[strings.TrimSpace(label)], _ = strconv.ParseFloat(matches[i][1], 64)
+	}
+	for _, label := range []string{"1m", "5m", "15m"} {
+		if _, ok := numbers[label]; !ok {
+			return nil, fmt.Errorf("missing %s TPS", label)
+		}
+	}
+	return []Sample{TPSSample{L1m: numbers["1m"], L5m: numbers["5m"], L15m: numbers["15m"]}}, nil
+}
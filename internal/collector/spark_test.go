@@ -0,0 +1,52 @@
+package collector
+
+import "testing"
+
+func TestSparkParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   TPSSample
+	}{
+		{
+			"with tick durations",
+			"§8§l[§e§l⚡§8§l] §7TPS from last 5s, 10s, 1m, 5m, 15m:\n§8§l[§e§l⚡§8§l]  §a*20.0§7, §a20.0§7, §a19.97§7, §a19.99§7, §a20.0\n§8§l[§e§l⚡§8§l] \n" +
+				"§8§l[§e§l⚡§8§l] §7Tick durations (min/med/95%ile/max ms) from last 10s, 1m:\n§8§l[§e§l⚡§8§l]  §a0.8§7/§a1.2§7/§a2.5§7/§a10.1§7;  §a0.7§7/§a1.3§7/§a2.6§7/§e35.2\n§8§l[§e§l⚡§8§l] \n" +
+				"§8§l[§e§l⚡§8§l] §7CPU usage from last 10s, 1m, 15m:\n§8§l[§e§l⚡§8§l]  §a12%§7, §a10%§7, §a9%  §7(system)",
+			TPSSample{L1m: 19.97, L5m: 19.99, L15m: 20},
+		},
+		{
+			"without tick durations",
+			"TPS from last 5s, 10s, 1m, 5m, 15m:\n ▶ 18.2, 18.9, 19.5, 19.8, 19.9\n\n" +
+				"CPU usage from last 10s, 1m, 15m:\n ▶ 35%, 30%, 22%  (system)\n ▶ 20%, 18%, 15%  (process)",
+			TPSSample{L1m: 19.5, L5m: 19.8, L15m: 19.9},
+		},
+		{
+			"tps only",
+			"TPS from last 5s, 10s, 1m, 5m, 15m:\n ▶ *20.0, *20.0, *20.0, 20.0, 20.0",
+			TPSSample{L1m: 20, L5m: 20, L15m: 20},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			samples, err := sparkCollector{}.Parse([]string{test.output})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := samples[0].(TPSSample); got != test.want {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSparkParseInvalid(t *testing.T) {
+	for _, output := range []string{
+		"Unknown or incomplete command, see below for error",
+		"TPS from last 5s, 10s, 1m, 5m, 15m:\n ▶ 20.0, 20.0",
+	} {
+		if _, err := (sparkCollector{}).Parse([]string{output}); err == nil {
+			t.Errorf("%q: expected an error", output)
+		}
+	}
+}
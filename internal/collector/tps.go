@@ -0,0 +1,69 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TPSSample 是最近 1、5、15 分钟的平均 TPS
+type TPSSample struct {
+	L1m  float64 `json:"l1m"`
+	L5m  float64 `json:"l5m"`
+	L15m float64 `json:"l15m"`
+	// Estimated 表示服务端没有 TPS 命令，数值由原版机制推算得到
+	Estimated bool `json:"estimated"`
+}
+
+var (
+	// tpsLineRegexp 匹配去掉颜色代码后的 "TPS from last 1m, 5m, 15m: 20.0, 20.0, 20.0"，Purpur 会在最前面多出 5s 一项
+	tpsLineRegexp = regexp.MustCompile(`TPS from last ([\w ,]+):(.*)`)
+	// tpsValueRegexp 匹配一项 TPS，超过 20 时 Spigot 显示为 "*20.0"
+	tpsValueRegexp = regexp.MustCompile(`\*?(\d+(?:\.\d+)?)`)
+)
+
+// tpsCollector 适用于 Bukkit/Spigot/Paper 的 tps 命令，连接建立后会自动探测其他服务端的 TPS 命令
+type tpsCollector struct{}
+
+func init() {
+	Register(tpsCollector{})
+}
+
+func (tpsCollector) Name() string            { return "tps" }
+func (tpsCollector) Commands() []string      { return []string{"tps"} }
+func (tpsCollector) Interval() time.Duration { return 5 * time.Second }
+
+// Parse 解析 tps 的输出，例如 "§6TPS from last 1m, 5m, 15m: §a*20.0, §a19.87, §a19.92"
+func (tpsCollector) Parse(outputs []string) ([]Sample, error) {
+	m := tpsLineRegexp.FindStringSubmatch(colorCodeRegexp.ReplaceAllString(outputs[0], ""))
+	if m == nil {
+		return nil, errors.New("TPS line not found")
+	}
+	labels := strings.Split(m[1], ",")
+	values := tpsValueRegexp.FindAllStringSubmatch(m[2], -1)
+	if len(values) != len(labels) {
+		return nil, fmt.Errorf("expected %d TPS values, got %d", len(labels), len(values))
+	}
+
+	numbers := map[string]float64{}
+	for i, label := range labels {
+		numbers[strings.TrimSpace(label)], _ = strconv.ParseFloat(values[i][1], 64)
+	}
+	for _, label := range []string{"1m", "5m", "15m"} {
+		if _, ok := numbers[label]; !ok {
+			return nil, fmt.Errorf("missing %s TPS", label)
+		}
+	}
+	return []Sample{TPSSample{L1m: numbers["1m"], L5m: numbers["5m"], L15m: numbers["15m"]}}, nil
+}
+
+// tpsCandidates 是自动探测时依次尝试的 TPS 采集器，靠前的优先，原版的推算作为最后的手段
+var tpsCandidates = []string{"tps", "forge_tps", "neoforge_tps", "spark_tps", "vanilla_tps"}
+
+// Detect 依次执行各候选采集器的命令，返回第一个输出能被识别的采集器
+func (c tpsCollector) Detect(execute func(command string) (string, error)) (Collector, error) {
+	return detectFirst(c, tpsCandidates, execute)
+}
@@ -0,0 +1,45 @@
+package collector
+
+import "testing"
+
+func TestTPSParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   TPSSample
+	}{
+		{"paper", "§6TPS from last 1m, 5m, 15m: §a20.0, §a20.0, §a20.0", TPSSample{L1m: 20, L5m: 20, L15m: 20}},
+		{"spigot capped", "§6TPS from last 1m, 5m, 15m: §a*20.0, §a*20.0, §a19.97", TPSSample{L1m: 20, L5m: 20, L15m: 19.97}},
+		{"lagging", "§6TPS from last 1m, 5m, 15m: §c12.31, §e17.05, §a19.4", TPSSample{L1m: 12.31, L5m: 17.05, L15m: 19.4}},
+		{"purpur", "§6TPS from last 5s, 1m, 5m, 15m: §a19.98, §a*20.0, §a19.99, §a20.0", TPSSample{L1m: 20, L5m: 19.99, L15m: 20}},
+		{"plain", "TPS from last 1m, 5m, 15m: 18.5, 19.0, 19.5", TPSSample{L1m: 18.5, L5m: 19, L15m: 19.5}},
+		{
+			"paper with memory line",
+			"§6TPS from last 1m, 5m, 15m: §a20.0, §a20.0, §a20.0\n§6Current Memory Usage: §a1024/4096 mb (Max: 4096 mb)",
+			TPSSample{L1m: 20, L5m: 20, L15m: 20},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			samples, err := tpsCollector{}.Parse([]string{test.output})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := samples[0].(TPSSample); got != test.want {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTPSParseInvalid(t *testing.T) {
+	for _, output := range []string{
+		"Unknown command. Type \"/help\" for help.",
+		"§6TPS from last 1m, 5m, 15m: §a20.0, §a20.0",
+		"TPS from last 5s, 10s: 20.0, 20.0",
+	} {
+		if _, err := (tpsCollector{}).Parse([]string{output}); err == nil {
+			t.Errorf("%q: expected an error", output)
+		}
+	}
+}
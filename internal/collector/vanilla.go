@@ -0,0 +1,145 @@
+package collector
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// tickRateRegexp 与 tickTimeRegexp 匹配 1.20.3 起 tick query 的输出，例如
+	// "The game is running normallyTarget tick rate: 20.0 per second.\nAverage time per tick: 1.2ms (Target: 50.0ms)"
+	tickRateRegexp = regexp.MustCompile(`Target tick rate: (\d+(?:\.\d+)?) per second`)
+	tickTimeRegexp = regexp.MustCompile(`Average time per tick: (\d+(?:\.\d+)?)ms`)
+	// gametimeRegexp 匹配 time query gametime 的输出，例如 "The time is 123456"
+	gametimeRegexp = regexp.MustCompile(`The time is (\d+)`)
+)
+
+// vanillaCollector 通过原版的 tick query 命令估算 TPS，旧版本没有该命令时改用 gametime_tps
+type vanillaCollector struct{}
+
+func init() {
+	Register(vanillaCollector{})
+	Register(&gametimeCollector{})
+}
+
+func (vanillaCollector) Name() string            { return "vanilla_tps" }
+func (vanillaCollector) Commands() []string      { return []string{"tick query"} }
+func (vanillaCollector) Interval() time.Duration { return 5 * time.Second }
+
+// Parse 根据目标 tick 速率与平均 tick 耗时估算 TPS：耗时未超出目标时即为目标速率，
+// 超出时为 1000 / 平均耗时；冲刺（tick sprint）时以实际耗时为准，冻结时为 0
+func (vanillaCollector) Parse(outputs []string) ([]Sample, error) {
+	rate := tickRateRegexp.FindStringSubmatch(outputs[0])
+	avg := tickTimeRegexp.FindStringSubmatch(outputs[0])
+	if rate == nil || avg == nil {
+		return nil, fmt.Errorf("tick rate not found")
+	}
+	target, _ := strconv.ParseFloat(rate[1], 64)
+	mspt, _ := strconv.ParseFloat(avg[1], 64)
+
+	tps := target
+	switch {
+	case strings.Contains(outputs[0], "frozen"):
+		tps = 0
+	case mspt > 0 && (strings.Contains(outputs[0], "sprinting") || 1000/mspt < target):
+		tps = 1000 / mspt
+	}
+	tps = math.Round(tps*100) / 100
+	return []Sample{TPSSample{L1m: tps, L5m: tps, L15m: tps, Estimated: true}}, nil
+}
+
+// Detect 优先使用 tick query，不支持时改用 gametime_tps
+func (c vanillaCollector) Detect(execute func(command string) (string, error)) (Collector, error) {
+	return detectFirst(c, []string{"vanilla_tps", "gametime_tps"}, execute)
+}
+
+// gametimePoint 是一次采样得到的游戏刻数与采样时间
+type gametimePoint struct {
+	gametime int64
+	time     time.Time
+}
+
+// gametimeCollector 定期查询游戏刻数，以刻数增量与实际经过时间之比估算 TPS，适用于所有原版版本
+//
+// 需要保存历史采样，因此注册的实例只作为模板，每次连接通过 Detect 获得独立的实例
+type gametimeCollector struct {
+	mu     sync.Mutex
+	points []gametimePoint
+}
+
+// gametimeWindow 是保存采样的时长，对应 TPSSample 中最长的 15 分钟
+const gametimeWindow = 15 * time.Minute
+
+func (*gametimeCollector) Name() string            { return "gametime_tps" }
+func (*gametimeCollector) Commands() []string      { return []string{"time query gametime"} }
+func (*gametimeCollector) Interval() time.Duration { return 5 * time.Second }
+
+// Detect 返回一个没有历史采样的新实例
+func (*gametimeCollector) Detect(func(command string) (string, error)) (Collector, error) {
+	return &gametimeCollector{}, nil
+}
+
+// Parse 记录本次采样，并按 1、5、15 分钟内最早的采样估算 TPS；历史不足时用已有的最早采样，
+// 首次采样或距上次采样不足 1 秒时不产生数据
+func (c *gametimeCollector) Parse(outputs []string) ([]Sample, error) {
+	match := gametimeRegexp.FindStringSubmatch(outputs[0])
+	if match == nil {
+		return nil, fmt.Errorf("game time not found")
+	}
+	gametime, _ := strconv.ParseInt(match[1], 10, 64)
+	return c.record(gametime, time.Now()), nil
+}
+
+// record 记录 now 时的游戏刻数并返回估算的 TPS，没有数据时返回空
+func (c *gametimeCollector) record(gametime int64, now time.Time) []Sample {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// 游戏刻数倒退说明服务端重置了存档或换了世界，之前的采样不再可比
+	if n := len(c.points); n > 0 && gametime < c.points[n-1].gametime {
+		c.points = nil
+	}
+	c.points = append(c.points, gametimePoint{gametime: gametime, time: now})
+	for len(c.points) > 1 && now.Sub(c.points[0].time) > gametimeWindow {
+		c.points = c.points[1:]
+	}
+
+	if now.Sub(c.points[0].time) < time.Second {
+		return nil
+	}
+	sample := TPSSample{
+		L1m:       c.estimate(now, time.Minute),
+		L5m:       c.estimate(now, 5*time.Minute),
+		L15m:      c.estimate(now, 15*time.Minute),
+		Estimated: true,
+	}
+	return []Sample{sample}
+}
+
+// estimate 以 window 内最早的采样与最新采样之间的刻数增量估算 TPS，调用方需持有 c.mu
+func (c *gametimeCollector) estimate(now time.Time, window time.Duration) float64 {
+	latest := c.points[len(c.points)-1]
+	oldest := c.points[0]
+	for _, point := range c.points {
+		if now.Sub(point.time) <= window {
+			oldest = point
+			break
+		}
+	}
+	if latest.time.Sub(oldest.time) < time.Second {
+		// window 内只有最新的采样时（例如采集曾中断），退回到距今至少 1 秒的最近一次采样
+		for i := len(c.points) - 2; i >= 0; i-- {
+			oldest = c.points[i]
+			if latest.time.Sub(oldest.time) >= time.Second {
+				break
+			}
+		}
+	}
+	elapsed := latest.time.Sub(oldest.time).Seconds()
+	tps := float64(latest.gametime-oldest.gametime) / elapsed
+	return math.Round(tps*100) / 100
+}
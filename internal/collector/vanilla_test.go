@@ -0,0 +1,154 @@
+package collector
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVanillaParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   float64
+	}{
+		{"running", "The game is running normallyTarget tick rate: 20.0 per second.\nAverage time per tick: 1.2ms (Target: 50.0ms)", 20},
+		{"lagging", "The game is running normallyTarget tick rate: 20.0 per second.\nAverage time per tick: 80.0ms (Target: 50.0ms)", 12.5},
+		{"custom rate", "The game is running normallyTarget tick rate: 40.0 per second.\nAverage time per tick: 10.0ms (Target: 25.0ms)", 40},
+		{"custom rate lagging", "The game is running normallyTarget tick rate: 40.0 per second.\nAverage time per tick: 40.0ms (Target: 25.0ms)", 25},
+		{"rounded", "The game is running normallyTarget tick rate: 20.0 per second.\nAverage time per tick: 61.3ms (Target: 50.0ms)", 16.31},
+		{"sprinting", "The game is sprintingTarget tick rate: 20.0 per second (ignored, reference only).\nAverage time per tick: 2.5ms", 400},
+		{"frozen", "The game is frozenTarget tick rate: 20.0 per second.\nAverage time per tick: 0.3ms (Target: 50.0ms)", 0},
+		{
+			"with percentiles",
+			"The game is running normallyTarget tick rate: 20.0 per second.\nAverage time per tick: 55.6ms (Target: 50.0ms)Percentiles: P50: 54.1ms P95: 70.2ms P99: 88.0ms, sample: 100",
+			17.99,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			samples, err := vanillaCollector{}.Parse([]string{test.output})
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := TPSSample{L1m: test.want, L5m: test.want, L15m: test.want, Estimated: true}
+			if got := samples[0].(TPSSample); got != want {
+				t.Errorf("got %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestVanillaParseInvalid(t *testing.T) {
+	for _, output := range []string{
+		"Unknown or incomplete command, see below for error\ntick query<--[HERE]",
+		"The game is running normally",
+		"Target tick rate: 20.0 per second.",
+	} {
+		if _, err := (vanillaCollector{}).Parse([]string{output}); err == nil {
+			t.Errorf("%q: expected an error", output)
+		}
+	}
+}
+
+func TestGametimeParse(t *testing.T) {
+	c := &gametimeCollector{}
+	for _, output := range []string{"The time is 1000", "The time is 2000"} {
+		if samples, err := c.Parse([]string{output}); err != nil || samples != nil {
+			t.Errorf("%q: got %v, %v, want no sample within a second", output, samples, err)
+		}
+	}
+	if len(c.points) != 2 || c.points[1].gametime != 2000 {
+		t.Errorf("got points %+v", c.points)
+	}
+	if _, err := c.Parse([]string{"Unknown or incomplete command, see below for error"}); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+// gametimeStep 是 gametimeCollector 的一次采样：距开始的时间与游戏刻数
+type gametimeStep struct {
+	at       time.Duration
+	gametime int64
+}
+
+// steady 返回从 from 到 to（不含）每 5 秒一次、以 tps 推进的采样，刻数从 start 开始
+func steady(from, to time.Duration, start int64, tps float64) []gametimeStep {
+	var steps []gametimeStep
+	for at := from; at < to; at += 5 * time.Second {
+		steps = append(steps, gametimeStep{at, start + int64((at-from).Seconds()*tps)})
+	}
+	return steps
+}
+
+func TestGametimeEstimate(t *testing.T) {
+	start := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	// 前 14 分钟 20 TPS，最后 1 分钟 10 TPS
+	lagging := append(steady(0, 14*time.Minute, 0, 20), steady(14*time.Minute, 15*time.Minute+time.Second, 14*60*20, 10)...)
+
+	tests := []struct {
+		name  string
+		steps []gametimeStep
+		// want 为最后一次采样的结果，为空表示没有数据
+		want *TPSSample
+	}{
+		{"first sample", []gametimeStep{{0, 1000}}, nil},
+		{"under a second", []gametimeStep{{0, 1000}, {500 * time.Millisecond, 1010}}, nil},
+		{"one second", []gametimeStep{{0, 1000}, {time.Second, 1020}}, &TPSSample{L1m: 20, L5m: 20, L15m: 20, Estimated: true}},
+		// 历史不足 1 分钟时各时段都用最早的采样
+		{"short history", steady(0, 35*time.Second, 0, 19.5), &TPSSample{L1m: 19.5, L5m: 19.5, L15m: 19.5, Estimated: true}},
+		{"steady", steady(0, 20*time.Minute, 0, 20), &TPSSample{L1m: 20, L5m: 20, L15m: 20, Estimated: true}},
+		{"lagging", lagging, &TPSSample{L1m: 10, L5m: 18, L15m: 19.33, Estimated: true}},
+		// 刻数倒退后丢弃之前的采样，重新开始估算
+		{"reset", append(steady(0, time.Minute, 500000, 20), gametimeStep{time.Minute, 100}), nil},
+		{"after reset", append(steady(0, time.Minute, 500000, 20), steady(time.Minute, 2*time.Minute, 100, 15)...),
+			&TPSSample{L1m: 15, L5m: 15, L15m: 15, Estimated: true}},
+		// 采集中断后 1 分钟内只有最新的采样，L1m 退回到中断前最后一次（4 分 55 秒、5900 刻）的采样
+		{"gap", append(steady(0, 5*time.Minute, 0, 20), gametimeStep{7 * time.Minute, 5900 + 1250}),
+			&TPSSample{L1m: 10, L5m: 15.83, L15m: 17.02, Estimated: true}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &gametimeCollector{}
+			var samples []Sample
+			for _, step := range test.steps {
+				samples = c.record(step.gametime, start.Add(step.at))
+			}
+			if test.want == nil {
+				if samples != nil {
+					t.Errorf("got %+v, want no sample", samples)
+				}
+				return
+			}
+			if len(samples) != 1 {
+				t.Fatalf("got %+v, want one sample", samples)
+			}
+			if got := samples[0].(TPSSample); got != *test.want {
+				t.Errorf("got %+v, want %+v", got, *test.want)
+			}
+		})
+	}
+}
+
+// TestGametimeWindow 检查只保存最近 15 分钟的采样
+func TestGametimeWindow(t *testing.T) {
+	start := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	c := &gametimeCollector{}
+	for _, step := range steady(0, time.Hour, 0, 20) {
+		c.record(step.gametime, start.Add(step.at))
+	}
+	oldest, latest := c.points[0].time, c.points[len(c.points)-1].time
+	if span := latest.Sub(oldest); span > gametimeWindow || span < gametimeWindow-5*time.Second {
+		t.Errorf("kept %d points spanning %s, want about %s", len(c.points), span, gametimeWindow)
+	}
+}
+
+// TestGametimeDetect 检查每次连接获得独立的实例，不共享历史采样
+func TestGametimeDetect(t *testing.T) {
+	template := &gametimeCollector{}
+	first, _ := template.Detect(nil)
+	second, _ := template.Detect(nil)
+	first.(*gametimeCollector).record(1000, time.Now())
+	if len(second.(*gametimeCollector).points) != 0 || len(template.points) != 0 {
+		t.Error("instances share samples")
+	}
+}
@@ -0,0 +1,109 @@
+package event
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Event 是在监控各模块之间传递的一条消息
+//
+// Payload 为具体的事件类型，例如 collector.PlayerListSample、collector.TPSSample、
+// ConnectionStateChanged，订阅方通过类型断言按需处理
+type Event struct {
+	// Server 为事件来源服务器的 ID
+	Server  string
+	Time    time.Time
+	Payload interface{}
+}
+
+// ConnectionStateChanged 在与服务器的 RCON 连接建立或断开时发布
+type ConnectionStateChanged struct {
+	Connected bool
+	// Reason 为断开原因，连接成功时为空
+	Reason string
+	// AuthFailed 表示服务端可以连接但拒绝了 RCON 密码
+	AuthFailed bool
+}
+
+// CollectorFailed 在采集命令执行失败或输出无法解析时发布
+type CollectorFailed struct {
+	Collector string
+	Reason    string
+	// ParseError 表示命令已正常执行但输出无法识别，此时 RCON 连接仍然可用
+	ParseError bool
+}
+
+// CollectorSlow 在一次采集的命令耗时超过阈值时发布，此时 RCON 连接仍然可用
+type CollectorSlow struct {
+	Collector string
+	Duration  time.Duration
+}
+
+// CollectorsSelected 在 RCON 连接建立并识别服务端后发布，Collectors 为本次连接实际运行的采集器
+type CollectorsSelected struct {
+	Collectors []string
+	// Unsupported 为服务端不支持 TPS 采集的原因，支持时为空
+	Unsupported string
+}
+
+// ProbeFailed 在 RCON 以外的探测（如 Server List Ping、Query）失败时发布
+type ProbeFailed struct {
+	Probe  string
+	Reason string
+}
+
+// Bus 把发布的事件分发给所有订阅方，每个订阅方拥有独立的缓冲通道
+type Bus struct {
+	mu   sync.RWMutex
+	subs []chan Event
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe 注册一个新的订阅方，buffer 为通道缓冲区大小
+func (b *Bus) Subscribe(buffer int) <-chan Event {
+	ch := make(chan Event, buffer)
+	b.mu.Lock()
+	b.subs = append(b.subs, ch)
+	b.mu.Unlock()
+	return ch
+}
+
+// Publish 以当前时间发布一个来自 server 的采样结果（如 TPS、玩家列表、探测结果）
+//
+// 发布不会阻塞：某个订阅方的缓冲区已满时，该订阅方会丢失这条事件，其余订阅方不受影响；
+// 采样是周期性的，丢失的数据会被下一次采样取代
+func (b *Bus) Publish(server string, payload interface{}) {
+	ev := Event{Server: server, Time: time.Now(), Payload: payload}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, ch := range b.subs {
+		select {
+		case ch <- ev:
+		default:
+			log.Printf("[WARN] Event subscriber is full, dropping %T from %s", payload, server)
+		}
+	}
+}
+
+// PublishTransition 以当前时间发布一个来自 server 的状态变化事件（如连接建立或断开、采集器失败）
+//
+// 这类事件只发布一次，丢失后订阅方的状态会一直错误，因此订阅方的缓冲区已满时会等待，直到事件送达
+func (b *Bus) PublishTransition(server string, payload interface{}) {
+	ev := Event{Server: server, Time: time.Now(), Payload: payload}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, ch := range b.subs {
+		select {
+		case ch <- ev:
+		default:
+			log.Printf("[WARN] Event subscriber is full, waiting to deliver %T from %s", payload, server)
+			ch <- ev
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package event
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPublishDropsSamplesWhenFull(t *testing.T) {
+	bus := NewBus()
+	ch := bus.Subscribe(1)
+	bus.Publish("survival", 1)
+	bus.Publish("survival", 2)
+	if ev := <-ch; ev.Server != "survival" || ev.Payload != 1 {
+		t.Errorf("got %+v", ev)
+	}
+	select {
+	case ev := <-ch:
+		t.Errorf("expected the second sample to be dropped, got %+v", ev)
+	default:
+	}
+}
+
+// TestPublishTransitionWaits 中订阅方的缓冲区已满，状态变化事件应等到订阅方取走事件后按顺序送达
+func TestPublishTransitionWaits(t *testing.T) {
+	bus := NewBus()
+	ch := bus.Subscribe(1)
+	bus.Publish("survival", "sample")
+
+	published := make(chan struct{})
+	go func() {
+		bus.PublishTransition("survival", ConnectionStateChanged{Connected: false, Reason: "closed"})
+		close(published)
+	}()
+	select {
+	case <-published:
+		t.Fatal("PublishTransition returned before the subscriber had room")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if ev := <-ch; ev.Payload != "sample" {
+		t.Errorf("got %+v, want the sample first", ev)
+	}
+	<-published
+	if ev := <-ch; ev.Payload != (ConnectionStateChanged{Connected: false, Reason: "closed"}) {
+		t.Errorf("got %+v", ev)
+	}
+}
+
+func TestPublishFansOut(t *testing.T) {
+	bus := NewBus()
+	a, b := bus.Subscribe(4), bus.Subscribe(4)
+	bus.PublishTransition("lobby", ProbeFailed{Probe: "slp", Reason: "timeout"})
+	for _, ch := range []<-chan Event{a, b} {
+		if ev := <-ch; ev.Server != "lobby" || ev.Time.IsZero() {
+			t.Errorf("got %+v", ev)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package monitor
+
+import (
+	"github.com/MeowLynxSea/Uptimeow/config"
+	"github.com/MeowLynxSea/Uptimeow/internal/bedrock"
+	"github.com/MeowLynxSea/Uptimeow/internal/event"
+	"github.com/MeowLynxSea/Uptimeow/internal/query"
+	"github.com/MeowLynxSea/Uptimeow/internal/rcon"
+	"github.com/MeowLynxSea/Uptimeow/internal/slp"
+	"log"
+	"strings"
+)
+
+// Start 启动对 server 的监控，每种已启用的探测方式各自运行在独立的 goroutine 中，
+// 结果以 server.ID 为来源发布到 bus
+func Start(server config.ServerConfig, bus *event.Bus) {
+	log.Println("[INFO] [" + server.ID + "] Starting monitor with probes: " + strings.Join(server.Probes, ", "))
+
+	for _, probe := range server.Probes {
+		switch probe {
+		case "rcon":
+			go rcon.InitRcon(server, bus)
+		case "query":
+			go query.InitQuery(server, bus)
+		case "slp":
+			go slp.InitSLP(server, bus)
+		case "bedrock":
+			go bedrock.InitBedrock(server, bus)
+		default:
+			log.Println("[ERROR] [" + server.ID + "] Unknown probe " + probe + ", ignored")
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/MeowLynxSea/Uptimeow/config"
+)
+
+// bark 通过 Bark 向 iOS 设备推送，紧急告警使用时效性通知以突破专注模式
+type bark struct {
+	url       string
+	deviceKey string
+}
+
+func init() {
+	Register("bark", func(channel config.NotificationChannel) (Notifier, error) {
+		if channel.Token == "" {
+			return nil, errors.New("missing token")
+		}
+		return bark{url: baseURL(channel.URL, "https://api.day.app") + "/push", deviceKey: channel.Token}, nil
+	})
+}
+
+func (b bark) Send(ctx context.Context, msg Message) error {
+	level := "active"
+	if msg.Kind == KindAlert && msg.Severity == config.SeverityCritical {
+		level = "timeSensitive"
+	}
+	payload := map[string]string{
+		"device_key": b.deviceKey,
+		"title":      msg.Title,
+		"body":       msg.detail(),
+		"group":      "Uptimeow",
+		"level":      level,
+	}
+	var result struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := postJSON(ctx, b.url, payload, nil, &result); err != nil {
+		return err
+	}
+	if result.Code != 200 {
+		return fmt.Errorf("bark error %d: %s", result.Code, result.Message)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/MeowLynxSea/Uptimeow/config"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dingtalk 通过钉钉群机器人推送纯文本消息
+type dingtalk struct {
+	url      string
+	token    string
+	secret   string
+	atMobile string
+}
+
+func init() {
+	Register("dingtalk", func(channel config.NotificationChannel) (Notifier, error) {
+		if channel.Token == "" {
+			return nil, errors.New("missing token")
+		}
+		return dingtalk{
+			url:      baseURL(channel.URL, "https://oapi.dingtalk.com") + "/robot/send",
+			token:    channel.Token,
+			secret:   channel.Secret,
+			atMobile: channel.AtMobile,
+		}, nil
+	})
+}
+
+func (d dingtalk) Send(ctx context.Context, msg Message) error {
+	payload := map[string]interface{}{
+		"msgtype": "text",
+		"text":    map[string]string{"content": msg.Text()},
+	}
+	atMobile := d.atMobile
+	if msg.AtMobile != "" {
+		atMobile = msg.AtMobile
+	}
+	if atMobile == "*" {
+		payload["at"] = map[string]interface{}{"isAtAll": true}
+	} else if atMobile != "" {
+		payload["at"] = map[string]interface{}{"atMobiles": strings.Split(atMobile, ",")}
+	}
+
+	query := url.Values{"access_token": {d.token}}
+	if d.secret != "" {
+		// 签名为以 secret 为密钥对 "timestamp\nsecret" 计算的 HmacSHA256，timestamp 为毫秒
+		timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+		mac := hmac.New(sha256.New, []byte(d.secret))
+		mac.Write([]byte(timestamp + "\n" + d.secret))
+		query.Set("timestamp", timestamp)
+		query.Set("sign", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	}
+	var result struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if err := postJSON(ctx, d.url+"?"+query.Encode(), payload, nil, &result); err != nil {
+		return err
+	}
+	if result.ErrCode != 0 {
+		return fmt.Errorf("dingtalk error %d: %s", result.ErrCode, result.ErrMsg)
+	}
+	return nil
+}
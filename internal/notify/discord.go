@@ -0,0 +1,48 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"github.com/MeowLynxSea/Uptimeow/config"
+)
+
+// discord 通过 Discord 频道的 Webhook 以 embed 推送，颜色表示严重程度
+type discord struct {
+	url string
+}
+
+func init() {
+	Register("discord", func(channel config.NotificationChannel) (Notifier, error) {
+		if channel.URL == "" {
+			return nil, errors.New("missing url")
+		}
+		return discord{url: channel.URL}, nil
+	})
+}
+
+func (d discord) Send(ctx context.Context, msg Message) error {
+	payload := map[string]interface{}{
+		"embeds": []map[string]interface{}{{
+			"title":       msg.Title,
+			"description": msg.Body,
+			"color":       color(msg),
+			"timestamp":   msg.Time.Format("2006-01-02T15:04:05Z07:00"),
+		}},
+	}
+	return postJSON(ctx, d.url, payload, nil, nil)
+}
+
+// color 返回消息对应的 RGB 颜色：恢复为绿色，其余按严重程度为红、橙、蓝
+func color(msg Message) int {
+	if msg.Kind == KindRecovery {
+		return 0x2ecc71
+	}
+	switch msg.Severity {
+	case config.SeverityCritical:
+		return 0xe74c3c
+	case config.SeverityWarning:
+		return 0xf39c12
+	default:
+		return 0x3498db
+	}
+}
@@ -0,0 +1,53 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/MeowLynxSea/Uptimeow/config"
+	"strconv"
+	"time"
+)
+
+// feishu 通过飞书（Lark）群机器人的 Webhook 推送纯文本消息
+type feishu struct {
+	url    string
+	secret string
+}
+
+func init() {
+	Register("feishu", func(channel config.NotificationChannel) (Notifier, error) {
+		if channel.URL == "" {
+			return nil, errors.New("missing url")
+		}
+		return feishu{url: channel.URL, secret: channel.Secret}, nil
+	})
+}
+
+func (f feishu) Send(ctx context.Context, msg Message) error {
+	payload := map[string]interface{}{
+		"msg_type": "text",
+		"content":  map[string]string{"text": msg.Text()},
+	}
+	if f.secret != "" {
+		// 签名为以 "timestamp\nsecret" 为密钥对空内容计算的 HmacSHA256
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, []byte(timestamp+"\n"+f.secret))
+		payload["timestamp"] = timestamp
+		payload["sign"] = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+	var result struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	if err := postJSON(ctx, f.url, payload, nil, &result); err != nil {
+		return err
+	}
+	if result.Code != 0 {
+		return fmt.Errorf("feishu error %d: %s", result.Code, result.Msg)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"github.com/MeowLynxSea/Uptimeow/config"
+)
+
+// gotify 向自建的 Gotify 服务推送消息，严重程度对应消息优先级
+type gotify struct {
+	url   string
+	token string
+}
+
+func init() {
+	Register("gotify", func(channel config.NotificationChannel) (Notifier, error) {
+		if channel.URL == "" || channel.Token == "" {
+			return nil, errors.New("missing url or token")
+		}
+		return gotify{url: baseURL(channel.URL, "") + "/message", token: channel.Token}, nil
+	})
+}
+
+func (g gotify) Send(ctx context.Context, msg Message) error {
+	priority := 2
+	if msg.Kind != KindRecovery {
+		switch msg.Severity {
+		case config.SeverityCritical:
+			priority = 8
+		case config.SeverityWarning:
+			priority = 5
+		}
+	}
+	payload := map[string]interface{}{
+		"title":    msg.Title,
+		"message":  msg.detail(),
+		"priority": priority,
+	}
+	return postJSON(ctx, g.url, payload, map[string]string{"X-Gotify-Key": g.token}, nil)
+}
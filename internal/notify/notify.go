@@ -0,0 +1,173 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/MeowLynxSea/Uptimeow/config"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 消息的类别
+const (
+	KindAlert        = "alert"
+	KindRecovery     = "recovery"
+	KindAnnouncement = "announcement"
+	KindSystem       = "system"
+)
+
+// Message 是一条待推送的消息
+type Message struct {
+	Kind     string `json:"kind"`
+	Severity string `json:"severity"`
+	// Title 为消息的第一行，例如 "【紧急】服务器离线"
+	Title string `json:"title"`
+	// Body 为其余各行，可以为空
+	Body string `json:"body"`
+	// Servers 为消息涉及的服务器 ID，为空表示不属于特定服务器
+	Servers []string  `json:"servers"`
+	Time    time.Time `json:"time"`
+	// AtMobile 为需要提醒的手机号（以 , 分隔，* 表示所有人），不为空时覆盖渠道配置中的 at_mobile，
+	// 只有 dingtalk 与 wecom 渠道支持
+	AtMobile string `json:"-"`
+}
+
+// Text 返回完整的纯文本消息
+func (m Message) Text() string {
+	if m.Body == "" {
+		return m.Title
+	}
+	return m.Title + "\n" + m.Body
+}
+
+// detail 返回消息正文，Body 为空时为 Title，用于要求正文不能为空的渠道
+func (m Message) detail() string {
+	if m.Body == "" {
+		return m.Title
+	}
+	return m.Body
+}
+
+// Notifier 是一种通知渠道的实现
+type Notifier interface {
+	// Send 推送一条消息，推送失败（包括服务端返回错误）时返回错误
+	Send(ctx context.Context, msg Message) error
+}
+
+// Factory 根据渠道配置创建 Notifier，缺少必要的字段时返回错误
+type Factory func(channel config.NotificationChannel) (Notifier, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{}
+)
+
+// Register 注册一种渠道类型，类型重复时 panic
+func Register(typ string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[typ]; ok {
+		panic("notify: Register called twice for " + typ)
+	}
+	registry[typ] = factory
+}
+
+// Types 返回所有已注册的渠道类型（按字母序）
+func Types() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	types := make([]string, 0, len(registry))
+	for typ := range registry {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// New 按渠道类型创建 Notifier
+func New(channel config.NotificationChannel) (Notifier, error) {
+	registryMu.RLock()
+	factory, ok := registry[channel.Type]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("notify: unknown channel type %q (available: %v)", channel.Type, Types())
+	}
+	notifier, err := factory(channel)
+	if err != nil {
+		return nil, fmt.Errorf("notify: channel %q: %w", channel.Name, err)
+	}
+	return notifier, nil
+}
+
+// client 是各 HTTP 渠道共用的客户端，超时由调用方通过 ctx 控制
+var client = &http.Client{}
+
+// postJSON 以 JSON 发送 payload，非 2xx 响应视为失败；result 不为空时把响应解析到 result 中
+func postJSON(ctx context.Context, endpoint string, payload interface{}, headers map[string]string, result interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return withoutURL(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return withoutURL(err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, truncate(string(respBody)))
+	}
+	if result != nil {
+		if err := json.Unmarshal(respBody, result); err != nil {
+			return fmt.Errorf("invalid response %q: %w", truncate(string(respBody)), err)
+		}
+	}
+	return nil
+}
+
+// withoutURL 去掉错误信息中的 URL，只保留原因：telegram、dingtalk 等渠道的令牌位于 URL 中，
+// 不能随错误写入日志与通知日志
+func withoutURL(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return fmt.Errorf("%s request failed: %w", urlErr.Op, urlErr.Err)
+	}
+	return err
+}
+
+// truncate 截短写入错误信息的响应内容
+func truncate(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) > 200 {
+		return s[:200] + "..."
+	}
+	return s
+}
+
+// baseURL 返回去掉末尾 / 的服务地址，未配置时为 fallback
+func baseURL(url, fallback string) string {
+	if url == "" {
+		url = fallback
+	}
+	return strings.TrimRight(url, "/")
+}
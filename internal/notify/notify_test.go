@@ -0,0 +1,348 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/MeowLynxSea/Uptimeow/config"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// request 是测试服务端收到的一次请求
+type request struct {
+	method string
+	path   string
+	query  map[string][]string
+	header http.Header
+	body   map[string]interface{}
+}
+
+// fakeServer 记录收到的请求并以 status 与 response 回应
+func fakeServer(t *testing.T, status int, response string) (*httptest.Server, <-chan request) {
+	t.Helper()
+	requests := make(chan request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		req := request{method: r.Method, path: r.URL.Path, query: r.URL.Query(), header: r.Header}
+		if err := json.Unmarshal(data, &req.body); err != nil {
+			t.Errorf("invalid JSON body %q: %v", data, err)
+		}
+		requests <- req
+		w.WriteHeader(status)
+		io.WriteString(w, response)
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+var testMessage = Message{
+	Kind:     KindAlert,
+	Severity: config.SeverityCritical,
+	Title:    "【紧急】服务器离线",
+	Body:     "服务器：生存服\n时间：2025-03-01 12:00:00",
+	Servers:  []string{"survival"},
+	Time:     time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC),
+}
+
+func send(t *testing.T, channel config.NotificationChannel, msg Message) error {
+	t.Helper()
+	notifier, err := New(channel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return notifier.Send(ctx, msg)
+}
+
+// get 按 . 分隔的路径读取 JSON 中的值，数组以下标表示
+func get(body interface{}, path string) interface{} {
+	for _, key := range strings.Split(path, ".") {
+		switch value := body.(type) {
+		case map[string]interface{}:
+			body = value[key]
+		case []interface{}:
+			i, _ := strconv.Atoi(key)
+			if i >= len(value) {
+				return nil
+			}
+			body = value[i]
+		default:
+			return nil
+		}
+	}
+	return body
+}
+
+func TestPayloads(t *testing.T) {
+	tests := []struct {
+		name     string
+		channel  config.NotificationChannel
+		response string
+		// path 为请求路径，fields 为请求体中应有的值，数字按 float64 比较
+		path   string
+		fields map[string]interface{}
+		header map[string]string
+	}{
+		{
+			name:    "webhook",
+			channel: config.NotificationChannel{Type: "webhook", Headers: map[string]string{"Authorization": "Bearer abc"}},
+			path:    "/hook",
+			fields: map[string]interface{}{
+				"kind": KindAlert, "severity": config.SeverityCritical, "title": testMessage.Title, "body": testMessage.Body,
+				"servers.0": "survival", "time": "2025-03-01T12:00:00Z", "text": testMessage.Text(),
+			},
+			header: map[string]string{"Authorization": "Bearer abc", "Content-Type": "application/json"},
+		},
+		{
+			name:     "dingtalk",
+			channel:  config.NotificationChannel{Type: "dingtalk", Token: "token", AtMobile: "13800000000,13900000000"},
+			response: `{"errcode":0,"errmsg":"ok"}`,
+			path:     "/robot/send",
+			fields: map[string]interface{}{
+				"msgtype": "text", "text.content": testMessage.Text(), "at.atMobiles.0": "13800000000", "at.atMobiles.1": "13900000000",
+			},
+		},
+		{
+			name:     "telegram",
+			channel:  config.NotificationChannel{Type: "telegram", Token: "123:abc", ChatID: "-10042"},
+			response: `{"ok":true,"result":{}}`,
+			path:     "/bot123:abc/sendMessage",
+			fields:   map[string]interface{}{"chat_id": "-10042", "text": testMessage.Text()},
+		},
+		{
+			name:    "discord",
+			channel: config.NotificationChannel{Type: "discord"},
+			path:    "/hook",
+			fields: map[string]interface{}{
+				"embeds.0.title": testMessage.Title, "embeds.0.description": testMessage.Body,
+				"embeds.0.color": float64(0xe74c3c), "embeds.0.timestamp": "2025-03-01T12:00:00Z",
+			},
+		},
+		{
+			name:    "slack",
+			channel: config.NotificationChannel{Type: "slack"},
+			path:    "/hook",
+			fields: map[string]interface{}{
+				"text": testMessage.Title, "attachments.0.color": "#e74c3c", "attachments.0.title": testMessage.Title,
+				"attachments.0.text": testMessage.Body, "attachments.0.ts": float64(testMessage.Time.Unix()),
+			},
+		},
+		{
+			name:     "feishu",
+			channel:  config.NotificationChannel{Type: "feishu"},
+			response: `{"code":0,"msg":"success"}`,
+			path:     "/hook",
+			fields:   map[string]interface{}{"msg_type": "text", "content.text": testMessage.Text()},
+		},
+		{
+			name:     "wecom",
+			channel:  config.NotificationChannel{Type: "wecom"},
+			response: `{"errcode":0,"errmsg":"ok"}`,
+			path:     "/hook",
+			fields:   map[string]interface{}{"msgtype": "text", "text.content": testMessage.Text()},
+		},
+		{
+			name:    "ntfy",
+			channel: config.NotificationChannel{Type: "ntfy", Topic: "uptimeow", Token: "tk_abc"},
+			path:    "/",
+			fields: map[string]interface{}{
+				"topic": "uptimeow", "title": testMessage.Title, "message": testMessage.Body, "priority": float64(5), "tags.0": "rotating_light",
+			},
+			header: map[string]string{"Authorization": "Bearer tk_abc"},
+		},
+		{
+			name:    "gotify",
+			channel: config.NotificationChannel{Type: "gotify", Token: "app-token"},
+			path:    "/message",
+			fields:  map[string]interface{}{"title": testMessage.Title, "message": testMessage.Body, "priority": float64(8)},
+			header:  map[string]string{"X-Gotify-Key": "app-token"},
+		},
+		{
+			name:     "bark",
+			channel:  config.NotificationChannel{Type: "bark", Token: "device"},
+			response: `{"code":200,"message":"success"}`,
+			path:     "/push",
+			fields: map[string]interface{}{
+				"device_key": "device", "title": testMessage.Title, "body": testMessage.Body, "group": "Uptimeow", "level": "timeSensitive",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, requests := fakeServer(t, http.StatusOK, test.response)
+			channel := test.channel
+			channel.Name = test.name
+			channel.URL = server.URL
+			if test.path == "/hook" {
+				channel.URL += "/hook"
+			}
+			if err := send(t, channel, testMessage); err != nil {
+				t.Fatal(err)
+			}
+			req := <-requests
+			if req.method != http.MethodPost || req.path != test.path {
+				t.Errorf("got %s %s, want POST %s", req.method, req.path, test.path)
+			}
+			for path, want := range test.fields {
+				if got := get(req.body, path); !reflect.DeepEqual(got, want) {
+					t.Errorf("%s: got %#v, want %#v", path, got, want)
+				}
+			}
+			for key, want := range test.header {
+				if got := req.header.Get(key); got != want {
+					t.Errorf("header %s: got %q, want %q", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDingTalkSignature(t *testing.T) {
+	server, requests := fakeServer(t, http.StatusOK, `{"errcode":0,"errmsg":"ok"}`)
+	channel := config.NotificationChannel{Name: "dingtalk", Type: "dingtalk", URL: server.URL, Token: "token", Secret: "SEC123"}
+	msg := testMessage
+	msg.AtMobile = "*"
+	if err := send(t, channel, msg); err != nil {
+		t.Fatal(err)
+	}
+	req := <-requests
+	if got := req.query["access_token"]; len(got) != 1 || got[0] != "token" {
+		t.Errorf("got access_token %v", got)
+	}
+	timestamp := req.query["timestamp"][0]
+	ms, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || time.Since(time.UnixMilli(ms)).Abs() > time.Minute {
+		t.Errorf("bad timestamp %q", timestamp)
+	}
+	mac := hmac.New(sha256.New, []byte("SEC123"))
+	mac.Write([]byte(timestamp + "\nSEC123"))
+	if want := base64.StdEncoding.EncodeToString(mac.Sum(nil)); req.query["sign"][0] != want {
+		t.Errorf("got sign %q, want %q", req.query["sign"][0], want)
+	}
+	if got := get(req.body, "at.isAtAll"); got != true {
+		t.Errorf("got isAtAll %v", got)
+	}
+}
+
+func TestFeishuSignature(t *testing.T) {
+	server, requests := fakeServer(t, http.StatusOK, `{"code":0,"msg":"success"}`)
+	channel := config.NotificationChannel{Name: "feishu", Type: "feishu", URL: server.URL, Secret: "SEC456"}
+	if err := send(t, channel, testMessage); err != nil {
+		t.Fatal(err)
+	}
+	req := <-requests
+	timestamp, _ := req.body["timestamp"].(string)
+	mac := hmac.New(sha256.New, []byte(timestamp+"\nSEC456"))
+	if want := base64.StdEncoding.EncodeToString(mac.Sum(nil)); req.body["sign"] != want {
+		t.Errorf("got sign %v, want %q", req.body["sign"], want)
+	}
+}
+
+func TestWeComMention(t *testing.T) {
+	server, requests := fakeServer(t, http.StatusOK, `{"errcode":0,"errmsg":"ok"}`)
+	msg := testMessage
+	msg.AtMobile = "*"
+	if err := send(t, config.NotificationChannel{Name: "wecom", Type: "wecom", URL: server.URL}, msg); err != nil {
+		t.Fatal(err)
+	}
+	if got := get((<-requests).body, "text.mentioned_mobile_list.0"); got != "@all" {
+		t.Errorf("got %v", got)
+	}
+}
+
+// TestRecoveryPayloads 检查恢复消息使用的颜色与优先级
+func TestRecoveryPayloads(t *testing.T) {
+	msg := testMessage
+	msg.Kind = KindRecovery
+	msg.Title = "【恢复】服务器已恢复在线"
+	tests := []struct {
+		channel config.NotificationChannel
+		path    string
+		want    interface{}
+	}{
+		{config.NotificationChannel{Type: "discord"}, "embeds.0.color", float64(0x2ecc71)},
+		{config.NotificationChannel{Type: "ntfy", Topic: "uptimeow"}, "tags.0", "white_check_mark"},
+		{config.NotificationChannel{Type: "gotify", Token: "app-token"}, "priority", float64(2)},
+	}
+	for _, test := range tests {
+		server, requests := fakeServer(t, http.StatusOK, "")
+		test.channel.Name, test.channel.URL = test.channel.Type, server.URL
+		if err := send(t, test.channel, msg); err != nil {
+			t.Fatal(err)
+		}
+		if got := get((<-requests).body, test.path); got != test.want {
+			t.Errorf("%s %s: got %#v, want %#v", test.channel.Type, test.path, got, test.want)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		channel  config.NotificationChannel
+		status   int
+		response string
+		want     string
+	}{
+		{config.NotificationChannel{Type: "webhook"}, http.StatusInternalServerError, "boom", "unexpected status 500"},
+		{config.NotificationChannel{Type: "dingtalk", Token: "token"}, http.StatusOK, `{"errcode":310000,"errmsg":"sign not match"}`, "dingtalk error 310000: sign not match"},
+		{config.NotificationChannel{Type: "telegram", Token: "t", ChatID: "1"}, http.StatusOK, `{"ok":false,"description":"chat not found"}`, "telegram error: chat not found"},
+		{config.NotificationChannel{Type: "feishu"}, http.StatusOK, `{"code":19021,"msg":"sign match fail"}`, "feishu error 19021"},
+		{config.NotificationChannel{Type: "wecom"}, http.StatusOK, `{"errcode":93000,"errmsg":"invalid webhook url"}`, "wecom error 93000"},
+		{config.NotificationChannel{Type: "bark"}, http.StatusOK, `{"code":400,"message":"failed to get device token"}`, "bark error 400"},
+		{config.NotificationChannel{Type: "bark", Token: "device"}, http.StatusOK, "not json", "invalid response"},
+	}
+	for _, test := range tests {
+		server, requests := fakeServer(t, test.status, test.response)
+		test.channel.Name, test.channel.URL = test.channel.Type, server.URL
+		if test.channel.Type == "bark" && test.channel.Token == "" {
+			test.channel.Token = "device"
+		}
+		err := send(t, test.channel, testMessage)
+		<-requests
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: got %v, want %q", test.channel.Type, err, test.want)
+		}
+	}
+}
+
+func TestNewMissingFields(t *testing.T) {
+	for _, typ := range []string{"webhook", "dingtalk", "telegram", "discord", "slack", "feishu", "wecom", "ntfy", "gotify", "bark", "smtp"} {
+		if _, err := New(config.NotificationChannel{Name: typ, Type: typ}); err == nil {
+			t.Errorf("%s: expected an error", typ)
+		}
+	}
+	if _, err := New(config.NotificationChannel{Name: "x", Type: "pager"}); err == nil {
+		t.Error("expected an error for unknown type")
+	}
+}
+
+// TestErrorsHideToken 中请求未能发出，错误信息不应包含位于 URL 中的令牌
+func TestErrorsHideToken(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	addr := server.URL
+	server.Close()
+
+	for _, channel := range []config.NotificationChannel{
+		{Name: "telegram", Type: "telegram", URL: addr, Token: "123456:SECRET-TOKEN", ChatID: "1"},
+		{Name: "dingtalk", Type: "dingtalk", URL: addr, Token: "SECRET-TOKEN", Secret: "SEC123"},
+		{Name: "webhook", Type: "webhook", URL: "http://[::1]:namedport/SECRET-TOKEN"},
+	} {
+		err := send(t, channel, testMessage)
+		if err == nil {
+			t.Fatalf("%s: expected an error", channel.Type)
+		}
+		if strings.Contains(err.Error(), "SECRET") {
+			t.Errorf("%s: error leaks the token: %v", channel.Type, err)
+		}
+	}
+}
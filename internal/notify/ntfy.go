@@ -0,0 +1,47 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"github.com/MeowLynxSea/Uptimeow/config"
+)
+
+// ntfy 以 JSON 方式向 ntfy 的主题发布消息，严重程度对应消息优先级
+type ntfy struct {
+	url     string
+	topic   string
+	headers map[string]string
+}
+
+func init() {
+	Register("ntfy", func(channel config.NotificationChannel) (Notifier, error) {
+		if channel.Topic == "" {
+			return nil, errors.New("missing topic")
+		}
+		n := ntfy{url: baseURL(channel.URL, "https://ntfy.sh"), topic: channel.Topic}
+		if channel.Token != "" {
+			n.headers = map[string]string{"Authorization": "Bearer " + channel.Token}
+		}
+		return n, nil
+	})
+}
+
+func (n ntfy) Send(ctx context.Context, msg Message) error {
+	priority, tag := 3, "information_source"
+	switch {
+	case msg.Kind == KindRecovery:
+		tag = "white_check_mark"
+	case msg.Severity == config.SeverityCritical:
+		priority, tag = 5, "rotating_light"
+	case msg.Severity == config.SeverityWarning:
+		priority, tag = 4, "warning"
+	}
+	payload := map[string]interface{}{
+		"topic":    n.topic,
+		"title":    msg.Title,
+		"message":  msg.detail(),
+		"priority": priority,
+		"tags":     []string{tag},
+	}
+	return postJSON(ctx, n.url, payload, n.headers, nil)
+}
@@ -0,0 +1,36 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/MeowLynxSea/Uptimeow/config"
+)
+
+// slack 通过 Slack 的 Incoming Webhook 推送，颜色表示严重程度
+type slack struct {
+	url string
+}
+
+func init() {
+	Register("slack", func(channel config.NotificationChannel) (Notifier, error) {
+		if channel.URL == "" {
+			return nil, errors.New("missing url")
+		}
+		return slack{url: channel.URL}, nil
+	})
+}
+
+func (s slack) Send(ctx context.Context, msg Message) error {
+	payload := map[string]interface{}{
+		// text 用于客户端的通知预览
+		"text": msg.Title,
+		"attachments": []map[string]interface{}{{
+			"color": fmt.Sprintf("#%06x", color(msg)),
+			"title": msg.Title,
+			"text":  msg.Body,
+			"ts":    msg.Time.Unix(),
+		}},
+	}
+	return postJSON(ctx, s.url, payload, nil, nil)
+}
@@ -0,0 +1,105 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"github.com/MeowLynxSea/Uptimeow/config"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// smtpMailer 通过 SMTP 发送纯文本邮件，标题为邮件主题
+type smtpMailer struct {
+	config.SMTPConfig
+}
+
+func init() {
+	Register("smtp", func(channel config.NotificationChannel) (Notifier, error) {
+		if channel.SMTP.Host == "" || channel.SMTP.From == "" || len(channel.SMTP.To) == 0 {
+			return nil, errors.New("missing smtp host, from or to")
+		}
+		m := smtpMailer{channel.SMTP}
+		if m.Port == 0 {
+			m.Port = 587
+		}
+		return m, nil
+	})
+}
+
+func (m smtpMailer) Send(ctx context.Context, msg Message) error {
+	address := net.JoinHostPort(m.Host, strconv.Itoa(m.Port))
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	tlsConfig := &tls.Config{ServerName: m.Host}
+	if m.Port == 465 {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	c, err := smtp.NewClient(conn, m.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok && m.Port != 465 {
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if m.Username != "" {
+		// PlainAuth 只允许在 TLS 连接或 localhost 上发送密码
+		if err := c.Auth(smtp.PlainAuth("", m.Username, m.Password, m.Host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(m.From); err != nil {
+		return err
+	}
+	for _, to := range m.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(m.compose(msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// compose 生成邮件内容，主题与正文均为 UTF-8，正文使用 base64 编码
+func (m smtpMailer) compose(msg Message) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + m.From + "\r\n")
+	b.WriteString("To: " + strings.Join(m.To, ", ") + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", msg.Title) + "\r\n")
+	b.WriteString("Date: " + msg.Time.Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	encoded := base64.StdEncoding.EncodeToString([]byte(msg.Text()))
+	for len(encoded) > 76 {
+		b.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	b.WriteString(encoded + "\r\n")
+	return []byte(b.String())
+}
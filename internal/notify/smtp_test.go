@@ -0,0 +1,153 @@
+package notify
+
+import (
+	"bufio"
+	"encoding/base64"
+	"github.com/MeowLynxSea/Uptimeow/config"
+	"mime"
+	"net"
+	"net/mail"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// smtpSession 是测试 SMTP 服务端收到的一封邮件
+type smtpSession struct {
+	auth string
+	from string
+	to   []string
+	data string
+}
+
+// fakeSMTP 在本地监听并实现 SMTP 的最小子集（不支持 STARTTLS），rejectRcpt 中的收件人会被拒绝
+func fakeSMTP(t *testing.T, rejectRcpt string) (string, int, <-chan smtpSession) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	sessions := make(chan smtpSession, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		var session smtpSession
+		reply("220 localhost ESMTP fake")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+			switch verb {
+			case "EHLO", "HELO":
+				reply("250-localhost")
+				reply("250 AUTH PLAIN")
+			case "AUTH":
+				session.auth = line
+				reply("235 2.7.0 Authentication successful")
+			case "MAIL":
+				session.from = strings.TrimSuffix(strings.TrimPrefix(line, "MAIL FROM:<"), ">")
+				session.from, _, _ = strings.Cut(session.from, ">")
+				reply("250 OK")
+			case "RCPT":
+				to := strings.TrimSuffix(strings.TrimPrefix(line, "RCPT TO:<"), ">")
+				if to == rejectRcpt {
+					reply("550 5.1.1 No such user")
+					continue
+				}
+				session.to = append(session.to, to)
+				reply("250 OK")
+			case "DATA":
+				reply("354 End data with <CR><LF>.<CR><LF>")
+				var data strings.Builder
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				session.data = data.String()
+				reply("250 OK: queued")
+			case "QUIT":
+				reply("221 Bye")
+				sessions <- session
+				return
+			default:
+				reply("502 Command not implemented")
+			}
+		}
+	}()
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	return host, portNumber, sessions
+}
+
+func TestSMTP(t *testing.T) {
+	host, port, sessions := fakeSMTP(t, "")
+	channel := config.NotificationChannel{Name: "mail", Type: "smtp", SMTP: config.SMTPConfig{
+		Host: host, Port: port, Username: "uptimeow", Password: "secret",
+		From: "uptimeow@example.com", To: []string{"ops@example.com", "admin@example.com"},
+	}}
+	if err := send(t, channel, testMessage); err != nil {
+		t.Fatal(err)
+	}
+	session := <-sessions
+
+	// PlainAuth 的凭据为 "\x00用户名\x00密码" 的 base64
+	if want := "AUTH PLAIN " + base64.StdEncoding.EncodeToString([]byte("\x00uptimeow\x00secret")); session.auth != want {
+		t.Errorf("got %q, want %q", session.auth, want)
+	}
+	if session.from != "uptimeow@example.com" || strings.Join(session.to, ",") != "ops@example.com,admin@example.com" {
+		t.Errorf("got from %q to %v", session.from, session.to)
+	}
+
+	message, err := mail.ReadMessage(strings.NewReader(session.data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+	if err != nil || subject != testMessage.Title {
+		t.Errorf("got subject %q (%v), want %q", subject, err, testMessage.Title)
+	}
+	if got := message.Header.Get("To"); got != "ops@example.com, admin@example.com" {
+		t.Errorf("got To %q", got)
+	}
+	if got := message.Header.Get("Content-Type"); got != "text/plain; charset=utf-8" {
+		t.Errorf("got Content-Type %q", got)
+	}
+	body, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(readAll(t, message), "\r\n", ""))
+	if err != nil || string(body) != testMessage.Text() {
+		t.Errorf("got body %q (%v), want %q", body, err, testMessage.Text())
+	}
+}
+
+func TestSMTPRejectedRecipient(t *testing.T) {
+	host, port, _ := fakeSMTP(t, "nobody@example.com")
+	channel := config.NotificationChannel{Name: "mail", Type: "smtp", SMTP: config.SMTPConfig{
+		Host: host, Port: port, From: "uptimeow@example.com", To: []string{"nobody@example.com"},
+	}}
+	if err := send(t, channel, testMessage); err == nil || !strings.Contains(err.Error(), "550") {
+		t.Fatalf("got %v, want 550", err)
+	}
+}
+
+func readAll(t *testing.T, message *mail.Message) string {
+	t.Helper()
+	var b strings.Builder
+	if _, err := bufio.NewReader(message.Body).WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
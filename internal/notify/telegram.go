@@ -0,0 +1,40 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/MeowLynxSea/Uptimeow/config"
+)
+
+// telegram 通过 Telegram Bot API 的 sendMessage 推送纯文本消息
+type telegram struct {
+	url    string
+	chatID string
+}
+
+func init() {
+	Register("telegram", func(channel config.NotificationChannel) (Notifier, error) {
+		if channel.Token == "" || channel.ChatID == "" {
+			return nil, errors.New("missing token or chat_id")
+		}
+		return telegram{
+			url:    baseURL(channel.URL, "https://api.telegram.org") + "/bot" + channel.Token + "/sendMessage",
+			chatID: channel.ChatID,
+		}, nil
+	})
+}
+
+func (t telegram) Send(ctx context.Context, msg Message) error {
+	var result struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := postJSON(ctx, t.url, map[string]string{"chat_id": t.chatID, "text": msg.Text()}, nil, &result); err != nil {
+		return err
+	}
+	if !result.OK {
+		return fmt.Errorf("telegram error: %s", result.Description)
+	}
+	return nil
+}
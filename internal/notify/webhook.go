@@ -0,0 +1,33 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"github.com/MeowLynxSea/Uptimeow/config"
+)
+
+// webhook 以 JSON 推送完整的消息结构，适合对接自建服务
+type webhook struct {
+	url     string
+	headers map[string]string
+}
+
+func init() {
+	Register("webhook", func(channel config.NotificationChannel) (Notifier, error) {
+		if channel.URL == "" {
+			return nil, errors.New("missing url")
+		}
+		return webhook{url: channel.URL, headers: channel.Headers}, nil
+	})
+}
+
+func (w webhook) Send(ctx context.Context, msg Message) error {
+	if msg.Servers == nil {
+		msg.Servers = []string{}
+	}
+	payload := struct {
+		Message
+		Text string `json:"text"`
+	}{msg, msg.Text()}
+	return postJSON(ctx, w.url, payload, w.headers, nil)
+}
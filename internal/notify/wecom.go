@@ -0,0 +1,44 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/MeowLynxSea/Uptimeow/config"
+	"strings"
+)
+
+// wecom 通过企业微信群机器人的 Webhook 推送纯文本消息
+type wecom struct {
+	url string
+}
+
+func init() {
+	Register("wecom", func(channel config.NotificationChannel) (Notifier, error) {
+		if channel.URL == "" {
+			return nil, errors.New("missing url")
+		}
+		return wecom{url: channel.URL}, nil
+	})
+}
+
+func (w wecom) Send(ctx context.Context, msg Message) error {
+	text := map[string]interface{}{"content": msg.Text()}
+	if msg.AtMobile == "*" {
+		text["mentioned_mobile_list"] = []string{"@all"}
+	} else if msg.AtMobile != "" {
+		text["mentioned_mobile_list"] = strings.Split(msg.AtMobile, ",")
+	}
+	payload := map[string]interface{}{"msgtype": "text", "text": text}
+	var result struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if err := postJSON(ctx, w.url, payload, nil, &result); err != nil {
+		return err
+	}
+	if result.ErrCode != 0 {
+		return fmt.Errorf("wecom error %d: %s", result.ErrCode, result.ErrMsg)
+	}
+	return nil
+}
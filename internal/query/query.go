@@ -0,0 +1,312 @@
+package query
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/MeowLynxSea/Uptimeow/config"
+	"github.com/MeowLynxSea/Uptimeow/internal/event"
+	"log"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FullStat 是 Query 协议完整状态查询的结果
+type FullStat struct {
+	Motd     string
+	GameType string
+	GameID   string
+	Version  string
+	// Software 为服务端软件及版本，例如 "Paper on 1.20.4"，原版服务端为空
+	Software     string
+	Plugins      []string
+	Map          string
+	OnlinePlayer int
+	MaxPlayer    int
+	HostPort     int
+	HostIP       string
+	PlayerList   []string
+	Latency      time.Duration
+}
+
+// BasicStat 是 Query 协议基础状态查询的结果
+type BasicStat struct {
+	Motd         string
+	GameType     string
+	Map          string
+	OnlinePlayer int
+	MaxPlayer    int
+	HostPort     int
+	HostIP       string
+	Latency      time.Duration
+}
+
+const (
+	typeHandshake = 0x09
+	typeStat      = 0x00
+
+	defaultPort = 25565
+
+	// retryInterval 是未收到回应时重发请求的间隔，UDP 包可能丢失
+	retryInterval = time.Second
+)
+
+var magic = []byte{0xfe, 0xfd}
+
+// colorCodeRegexp 匹配 MOTD 中的 § 格式代码
+var colorCodeRegexp = regexp.MustCompile(`§.`)
+
+// InitQuery 按 server 配置的周期进行完整状态查询，结果发布到 bus
+//
+// 成功时发布 FullStat，失败时发布 event.ProbeFailed
+func InitQuery(server config.ServerConfig, bus *event.Bus) {
+	probe := server.Query
+	addr := probe.Address
+	log.Println("[INFO] [" + server.ID + "] Starting Query probe for " + addr + "...")
+
+	ticker := time.NewTicker(probe.Interval)
+	defer ticker.Stop()
+	for ; ; <-ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), probe.Timeout)
+		stat, err := QueryFull(ctx, addr)
+		cancel()
+		if err != nil {
+			bus.Publish(server.ID, event.ProbeFailed{Probe: "query", Reason: err.Error()})
+			continue
+		}
+		bus.Publish(server.ID, stat)
+	}
+}
+
+// QueryFull 对 addr 进行完整状态查询，需要服务端开启 enable-query，addr 未指定端口时使用 25565
+func QueryFull(ctx context.Context, addr string) (FullStat, error) {
+	var stat FullStat
+	err := withSession(ctx, addr, func(s *session) error {
+		token, err := s.handshake(ctx)
+		if err != nil {
+			return err
+		}
+
+		startTime := time.Now()
+		// 完整状态请求在挑战令牌后追加 4 个字节的填充
+		resp, err := s.request(ctx, typeStat, token, []byte{0, 0, 0, 0})
+		if err != nil {
+			return err
+		}
+		stat, err = parseFullStat(resp)
+		stat.Latency = time.Since(startTime)
+		return err
+	})
+	return stat, err
+}
+
+// QueryBasic 对 addr 进行基础状态查询，只返回玩家数量而不包含玩家列表
+func QueryBasic(ctx context.Context, addr string) (BasicStat, error) {
+	var stat BasicStat
+	err := withSession(ctx, addr, func(s *session) error {
+		token, err := s.handshake(ctx)
+		if err != nil {
+			return err
+		}
+
+		startTime := time.Now()
+		resp, err := s.request(ctx, typeStat, token, nil)
+		if err != nil {
+			return err
+		}
+		stat, err = parseBasicStat(resp)
+		stat.Latency = time.Since(startTime)
+		return err
+	})
+	return stat, err
+}
+
+// session 是一次查询使用的 UDP 连接和会话 ID
+type session struct {
+	conn net.Conn
+	id   int32
+	buf  []byte
+}
+
+func withSession(ctx context.Context, addr string, fn func(s *session) error) error {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, strconv.Itoa(defaultPort))
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// 服务端只使用会话 ID 每个字节的低 4 位
+	id := int32(time.Now().UnixNano()) & 0x0f0f0f0f
+	return fn(&session{conn: conn, id: id, buf: make([]byte, 65536)})
+}
+
+// handshake 获取挑战令牌，服务端以十进制字符串返回
+func (s *session) handshake(ctx context.Context) (int32, error) {
+	resp, err := s.request(ctx, typeHandshake, 0, nil)
+	if err != nil {
+		return 0, err
+	}
+	token, err := strconv.ParseInt(string(bytes.TrimRight(resp, "\x00")), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("query: bad challenge token %q", resp)
+	}
+	return int32(token), nil
+}
+
+// request 发送一个请求并返回回应中类型与会话 ID 之后的内容
+//
+// 握手请求不携带令牌，token 仅在 typ 为 typeStat 时写入
+func (s *session) request(ctx context.Context, typ byte, token int32, padding []byte) ([]byte, error) {
+	var req bytes.Buffer
+	req.Write(magic)
+	req.WriteByte(typ)
+	binary.Write(&req, binary.BigEndian, s.id)
+	if typ == typeStat {
+		binary.Write(&req, binary.BigEndian, token)
+		req.Write(padding)
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if _, err := s.conn.Write(req.Bytes()); err != nil {
+			return nil, err
+		}
+
+		deadline := time.Now().Add(retryInterval)
+		if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+			deadline = ctxDeadline
+		}
+		s.conn.SetReadDeadline(deadline)
+
+		for {
+			n, err := s.conn.Read(s.buf)
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					break
+				}
+				return nil, err
+			}
+			resp := s.buf[:n]
+			if n < 5 || resp[0] != typ || int32(binary.BigEndian.Uint32(resp[1:5])) != s.id {
+				// 忽略无关或过期的包
+				continue
+			}
+			return append([]byte(nil), resp[5:]...), nil
+		}
+	}
+}
+
+// parseFullStat 解析完整状态回应
+//
+// 回应由固定的填充、以空字节分隔的键值对（空键结束）、"\x01player_\x00\x00" 和玩家列表（空名结束）组成
+func parseFullStat(b []byte) (FullStat, error) {
+	const kvPadding = "splitnum\x00\x80\x00"
+	const playerPadding = "\x01player_\x00\x00"
+
+	if !bytes.HasPrefix(b, []byte(kvPadding)) {
+		return FullStat{}, errors.New("query: bad full stat padding")
+	}
+	b = b[len(kvPadding):]
+
+	sections := bytes.SplitN(b, []byte(playerPadding), 2)
+	if len(sections) != 2 {
+		return FullStat{}, errors.New("query: missing player section")
+	}
+
+	kv := map[string]string{}
+	fields := strings.Split(string(sections[0]), "\x00")
+	for i := 0; i+1 < len(fields) && fields[i] != ""; i += 2 {
+		kv[fields[i]] = fields[i+1]
+	}
+
+	stat := FullStat{
+		Motd:       colorCodeRegexp.ReplaceAllString(kv["hostname"], ""),
+		GameType:   kv["gametype"],
+		GameID:     kv["game_id"],
+		Version:    kv["version"],
+		Map:        kv["map"],
+		HostIP:     kv["hostip"],
+		Plugins:    []string{},
+		PlayerList: []string{},
+	}
+	stat.Software, stat.Plugins = parsePlugins(kv["plugins"])
+
+	var err error
+	if stat.OnlinePlayer, err = strconv.Atoi(kv["numplayers"]); err != nil {
+		return FullStat{}, fmt.Errorf("query: bad numplayers %q", kv["numplayers"])
+	}
+	if stat.MaxPlayer, err = strconv.Atoi(kv["maxplayers"]); err != nil {
+		return FullStat{}, fmt.Errorf("query: bad maxplayers %q", kv["maxplayers"])
+	}
+	stat.HostPort, _ = strconv.Atoi(kv["hostport"])
+
+	for _, name := range strings.Split(string(sections[1]), "\x00") {
+		if name == "" {
+			break
+		}
+		stat.PlayerList = append(stat.PlayerList, name)
+	}
+	return stat, nil
+}
+
+// parsePlugins 解析 Bukkit 系服务端的 plugins 字段，例如
+// "Paper on 1.20.4-R0.1-SNAPSHOT: LuckPerms 5.4.102; EssentialsX 2.20.1"
+func parsePlugins(s string) (string, []string) {
+	plugins := []string{}
+	software, list, found := strings.Cut(s, ":")
+	if !found {
+		return strings.TrimSpace(s), plugins
+	}
+	for _, plugin := range strings.Split(list, ";") {
+		if plugin = strings.TrimSpace(plugin); plugin != "" {
+			plugins = append(plugins, plugin)
+		}
+	}
+	return strings.TrimSpace(software), plugins
+}
+
+// parseBasicStat 解析基础状态回应：MOTD、游戏类型、地图、玩家数、最大玩家数均为空字节结尾的字符串，
+// 随后是小端序的端口号和空字节结尾的 IP
+func parseBasicStat(b []byte) (BasicStat, error) {
+	var fields []string
+	for i := 0; i < 5; i++ {
+		end := bytes.IndexByte(b, 0)
+		if end < 0 {
+			return BasicStat{}, errors.New("query: truncated basic stat")
+		}
+		fields = append(fields, string(b[:end]))
+		b = b[end+1:]
+	}
+	if len(b) < 2 {
+		return BasicStat{}, errors.New("query: truncated basic stat")
+	}
+
+	stat := BasicStat{
+		Motd:     colorCodeRegexp.ReplaceAllString(fields[0], ""),
+		GameType: fields[1],
+		Map:      fields[2],
+		HostPort: int(binary.LittleEndian.Uint16(b[:2])),
+		HostIP:   string(bytes.TrimRight(b[2:], "\x00")),
+	}
+	var err error
+	if stat.OnlinePlayer, err = strconv.Atoi(fields[3]); err != nil {
+		return BasicStat{}, fmt.Errorf("query: bad numplayers %q", fields[3])
+	}
+	if stat.MaxPlayer, err = strconv.Atoi(fields[4]); err != nil {
+		return BasicStat{}, fmt.Errorf("query: bad maxplayers %q", fields[4])
+	}
+	return stat, nil
+}
@@ -0,0 +1,267 @@
+package query
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 原版 1.21.4 服务端的完整状态回应（不含类型与会话 ID）
+const vanillaFullStat = "splitnum\x00\x80\x00" +
+	"hostname\x00§aA Minecraft §lServer\x00gametype\x00SMP\x00game_id\x00MINECRAFT\x00version\x001.21.4\x00plugins\x00\x00map\x00world\x00" +
+	"numplayers\x002\x00maxplayers\x0020\x00hostport\x0025565\x00hostip\x00127.0.0.1\x00\x00" +
+	"\x01player_\x00\x00Steve\x00Alex\x00\x00"
+
+// Paper 服务端的完整状态回应，plugins 中带有服务端软件与插件列表
+const paperFullStat = "splitnum\x00\x80\x00" +
+	"hostname\x00Paper Server\x00gametype\x00SMP\x00game_id\x00MINECRAFT\x00version\x001.20.4\x00" +
+	"plugins\x00Paper on 1.20.4-R0.1-SNAPSHOT: LuckPerms 5.4.102; EssentialsX 2.20.1\x00map\x00world\x00" +
+	"numplayers\x000\x00maxplayers\x00100\x00hostport\x0025566\x00hostip\x000.0.0.0\x00\x00" +
+	"\x01player_\x00\x00\x00"
+
+// basicStat 构造基础状态回应
+func basicStat(motd, numPlayers string, port uint16, ip string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(motd + "\x00SMP\x00world\x00" + numPlayers + "\x0020\x00")
+	binary.Write(&buf, binary.LittleEndian, port)
+	buf.WriteString(ip + "\x00")
+	return buf.Bytes()
+}
+
+func TestParseFullStat(t *testing.T) {
+	tests := []struct {
+		name string
+		resp string
+		want FullStat
+	}{
+		{"vanilla", vanillaFullStat, FullStat{
+			Motd: "A Minecraft Server", GameType: "SMP", GameID: "MINECRAFT", Version: "1.21.4", Plugins: []string{}, Map: "world",
+			OnlinePlayer: 2, MaxPlayer: 20, HostPort: 25565, HostIP: "127.0.0.1", PlayerList: []string{"Steve", "Alex"},
+		}},
+		{"paper", paperFullStat, FullStat{
+			Motd: "Paper Server", GameType: "SMP", GameID: "MINECRAFT", Version: "1.20.4",
+			Software: "Paper on 1.20.4-R0.1-SNAPSHOT", Plugins: []string{"LuckPerms 5.4.102", "EssentialsX 2.20.1"}, Map: "world",
+			OnlinePlayer: 0, MaxPlayer: 100, HostPort: 25566, HostIP: "0.0.0.0", PlayerList: []string{},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stat, err := parseFullStat([]byte(test.resp))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(stat, test.want) {
+				t.Errorf("got %+v, want %+v", stat, test.want)
+			}
+		})
+	}
+}
+
+func TestParseFullStatInvalid(t *testing.T) {
+	for _, resp := range []string{
+		"",
+		"hostname\x00Server\x00\x00\x01player_\x00\x00\x00",
+		strings.TrimSuffix(vanillaFullStat, "\x01player_\x00\x00Steve\x00Alex\x00\x00"),
+		strings.Replace(vanillaFullStat, "numplayers\x002", "numplayers\x00two", 1),
+		strings.Replace(vanillaFullStat, "maxplayers\x0020", "maxplayers\x00", 1),
+	} {
+		if _, err := parseFullStat([]byte(resp)); err == nil {
+			t.Errorf("%q: expected an error", resp)
+		}
+	}
+}
+
+func TestParseBasicStat(t *testing.T) {
+	stat, err := parseBasicStat(basicStat("§aA Minecraft Server", "3", 25565, "127.0.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := BasicStat{Motd: "A Minecraft Server", GameType: "SMP", Map: "world", OnlinePlayer: 3, MaxPlayer: 20, HostPort: 25565, HostIP: "127.0.0.1"}
+	if stat != want {
+		t.Errorf("got %+v, want %+v", stat, want)
+	}
+
+	valid := basicStat("Server", "3", 25565, "127.0.0.1")
+	for _, resp := range [][]byte{
+		[]byte("Server\x00SMP\x00world\x003\x00"),
+		valid[:bytes.LastIndex(valid, []byte("20\x00"))+4],
+		basicStat("Server", "many", 25565, "127.0.0.1"),
+	} {
+		if _, err := parseBasicStat(resp); err == nil {
+			t.Errorf("%q: expected an error", resp)
+		}
+	}
+}
+
+func TestParsePlugins(t *testing.T) {
+	tests := []struct {
+		plugins  string
+		software string
+		want     []string
+	}{
+		{"", "", []string{}},
+		{"Paper on 1.20.4-R0.1-SNAPSHOT: LuckPerms 5.4.102; EssentialsX 2.20.1", "Paper on 1.20.4-R0.1-SNAPSHOT", []string{"LuckPerms 5.4.102", "EssentialsX 2.20.1"}},
+		// 没有安装插件时只有服务端软件
+		{"CraftBukkit on Bukkit 1.21.4-R0.1-SNAPSHOT", "CraftBukkit on Bukkit 1.21.4-R0.1-SNAPSHOT", []string{}},
+		{"Purpur on 1.21.4-R0.1-SNAPSHOT: ", "Purpur on 1.21.4-R0.1-SNAPSHOT", []string{}},
+		{"Paper on 1.20.4: ViaVersion 5.2.1;; Geyser-Spigot 2.6.0 ;", "Paper on 1.20.4", []string{"ViaVersion 5.2.1", "Geyser-Spigot 2.6.0"}},
+	}
+	for _, test := range tests {
+		software, plugins := parsePlugins(test.plugins)
+		if software != test.software || !reflect.DeepEqual(plugins, test.want) {
+			t.Errorf("%q: got %q %q, want %q %q", test.plugins, software, plugins, test.software, test.want)
+		}
+	}
+}
+
+// packet 构造一个回应包
+func packet(typ byte, id []byte, payload []byte) []byte {
+	return append(append([]byte{typ}, id...), payload...)
+}
+
+// fakeServer 在本地监听 UDP，模拟开启 enable-query 的服务端：握手时回应挑战令牌 token，
+// 状态请求交给 stat 处理，n 为收到的第几个状态请求（从 0 开始），full 表示是否为完整状态请求，返回的每一项为一个回应包
+func fakeServer(t *testing.T, token string, stat func(n int, id []byte, full bool) [][]byte) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 1500)
+		for n := 0; ; {
+			size, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			req := buf[:size]
+			if size < 7 || !bytes.Equal(req[:2], magic) {
+				t.Errorf("bad request % x", req)
+				continue
+			}
+			id := append([]byte(nil), req[3:7]...)
+			switch {
+			case req[2] == typeHandshake && size == 7:
+				conn.WriteTo(packet(typeHandshake, id, []byte(token+"\x00")), addr)
+			case req[2] == typeStat && (size == 11 || size == 15):
+				want, _ := strconv.ParseInt(token, 10, 32)
+				if got := int32(binary.BigEndian.Uint32(req[7:11])); got != int32(want) {
+					t.Errorf("got challenge token %d, want %d", got, want)
+				}
+				for _, reply := range stat(n, id, size == 15) {
+					conn.WriteTo(reply, addr)
+				}
+				n++
+			default:
+				t.Errorf("bad request % x", req)
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func queryFull(t *testing.T, addr string, timeout time.Duration) (FullStat, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return QueryFull(ctx, addr)
+}
+
+func TestQueryFull(t *testing.T) {
+	// 令牌可能为负数
+	for _, token := range []string{"9513307", "-2136491120"} {
+		addr := fakeServer(t, token, func(n int, id []byte, full bool) [][]byte {
+			if !full {
+				t.Error("got a basic stat request")
+			}
+			return [][]byte{packet(typeStat, id, []byte(vanillaFullStat))}
+		})
+		stat, err := queryFull(t, addr, 2*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stat.Version != "1.21.4" || !reflect.DeepEqual(stat.PlayerList, []string{"Steve", "Alex"}) {
+			t.Errorf("token %s: got %+v", token, stat)
+		}
+	}
+}
+
+func TestQueryBasic(t *testing.T) {
+	addr := fakeServer(t, "9513307", func(n int, id []byte, full bool) [][]byte {
+		if full {
+			t.Error("got a full stat request")
+		}
+		return [][]byte{packet(typeStat, id, basicStat("A Minecraft Server", "2", 25565, "127.0.0.1"))}
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	stat, err := QueryBasic(ctx, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Motd != "A Minecraft Server" || stat.OnlinePlayer != 2 || stat.HostPort != 25565 {
+		t.Errorf("got %+v", stat)
+	}
+}
+
+func TestQueryBadToken(t *testing.T) {
+	addr := fakeServer(t, "not a token", func(n int, id []byte, full bool) [][]byte {
+		t.Error("got a stat request after a bad challenge token")
+		return nil
+	})
+	if _, err := queryFull(t, addr, 2*time.Second); err == nil || !strings.Contains(err.Error(), "bad challenge token") {
+		t.Errorf("got %v, want a bad challenge token error", err)
+	}
+}
+
+// TestQueryIgnoresStale 中无关会话、类型不符与过短的包应被忽略
+func TestQueryIgnoresStale(t *testing.T) {
+	addr := fakeServer(t, "9513307", func(n int, id []byte, full bool) [][]byte {
+		other := append([]byte(nil), id...)
+		other[3] ^= 0x01
+		return [][]byte{
+			packet(typeStat, other, []byte(paperFullStat)),
+			packet(typeHandshake, id, []byte("9513307\x00")),
+			{typeStat, 0x01},
+			packet(typeStat, id, []byte(vanillaFullStat)),
+		}
+	})
+	stat, err := queryFull(t, addr, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Version != "1.21.4" {
+		t.Errorf("got %+v", stat)
+	}
+}
+
+// TestQueryRetry 中第一个状态请求没有回应，应在 retryInterval 后重发
+func TestQueryRetry(t *testing.T) {
+	addr := fakeServer(t, "9513307", func(n int, id []byte, full bool) [][]byte {
+		if n == 0 {
+			return nil
+		}
+		return [][]byte{packet(typeStat, id, []byte(vanillaFullStat))}
+	})
+	stat, err := queryFull(t, addr, 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.MaxPlayer != 20 {
+		t.Errorf("got %+v", stat)
+	}
+}
+
+func TestQueryTimeout(t *testing.T) {
+	addr := fakeServer(t, "9513307", func(n int, id []byte, full bool) [][]byte { return nil })
+	if _, err := queryFull(t, addr, 200*time.Millisecond); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+}
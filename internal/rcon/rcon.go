@@ -1,203 +1,393 @@
 package rcon
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/binary"
-	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/MeowLynxSea/Uptimeow/config"
+	"github.com/MeowLynxSea/Uptimeow/internal/collector"
+	"github.com/MeowLynxSea/Uptimeow/internal/event"
+	"github.com/MeowLynxSea/Uptimeow/internal/software"
 	"github.com/robfig/cron/v3"
+	"io"
 	"log"
+	"math"
 	"net"
-	"regexp"
 	"strconv"
+	"sync"
 	"time"
 )
 
+// Connection 是一个 RCON 会话，可被多个 goroutine 共享
+//
+// 同一时间只有一个命令在线路上执行，其余调用方在 sem 上排队，排队期间 ctx 结束时直接返回，不影响连接；
+// 请求 ID 由连接自身分配，响应按 ID 匹配，迟到的旧响应会被丢弃
 type Connection struct {
-	conn net.Conn
-	pass string
-	addr string
+	// sem 是容量为 1 的信号量，持有者独占线路
+	sem    chan struct{}
+	conn   net.Conn
+	rd     *bufio.Reader
+	pass   string
+	addr   string
+	nextID int32
+	err    error
 }
 
-const (
-	DataType_data_list = iota
-	DataType_data_tps
-	DataType_connection_error
-	DataType_connection_success
-	DataType_execution_error
-)
+// ErrConnectionClosed 在连接已关闭或因错误失效后继续发送命令时返回
+var ErrConnectionClosed = errors.New("rcon: connection closed")
+
+// ErrAuthFailed 在服务端拒绝 RCON 密码时返回
+var ErrAuthFailed = errors.New("rcon: incorrect password")
+
+// commandTimeout 是单条命令从发送到收齐响应的最长等待时间
+const commandTimeout = 5 * time.Second
 
-var GlobalConfig config.ConfigData
-var Cron = cron.New()
-var isRunning bool
+// slowThreshold 是一次采集的所有命令耗时之和的告警阈值，超过时发布 CollectorSlow
+const slowThreshold = 2 * time.Second
 
-func InitRcon(callback func(data string)) {
+// reconnectDelay 是连接失败或断开后重新连接前的等待时间
+const reconnectDelay = 3 * time.Second
 
-	GlobalConfig = config.Load()
+// autoCollectors 是配置中代表“按识别出的服务端类型选择采集器”的名称
+const autoCollectors = "auto"
 
-	var conn *Connection
+// InitRcon 持续维持与 server 的 RCON 连接并按配置运行采集器，结果发布到 bus
+func InitRcon(server config.ServerConfig, bus *event.Bus) {
+	if _, err := collector.Lookup(expandCollectors(server.Rcon.Collectors, nil)); err != nil {
+		log.Fatalln("[ERROR] ["+server.ID+"] Invalid RCON collector config:", err)
+	}
+
+	addr := net.JoinHostPort(server.Rcon.Host, strconv.Itoa(server.Rcon.Port))
+	for {
+		log.Println("[INFO] [" + server.ID + "] Connecting to RCON server " + addr + "...")
 
-	Cron.AddFunc("@every 5s", func() {
-		command := [...]string{"list", "tps"}
-		for _, v := range command {
-			response, err := conn.SendCommand(v)
-			if err != nil {
-				// log.Println("[ERROR] Error executing command:", err)
-				callback("{\"type\": " + strconv.Itoa(DataType_execution_error) + ", \"data\": \"Error executing command: " + err.Error() + "\"}")
-				isRunning = false
-				break
+		conn, err := NewConnection(addr, server.Rcon.Password)
+		if err != nil {
+			bus.PublishTransition(server.ID, event.ConnectionStateChanged{Connected: false, Reason: "Error connecting to RCON server: " + err.Error(), AuthFailed: errors.Is(err, ErrAuthFailed)})
+		} else {
+			bus.PublishTransition(server.ID, event.ConnectionStateChanged{Connected: true})
+			if detected, err := negotiate(server, conn, bus); err != nil {
+				bus.PublishTransition(server.ID, event.CollectorFailed{Collector: "detect", Reason: "Error executing command: " + err.Error()})
 			} else {
-				switch v {
-				case "list":
-					// 编译正则表达式
-					onlinePlayerRegexp := regexp.MustCompile(`(\d+) of a max of (\d+) players online`)
-					playerListRegexp := regexp.MustCompile(`online: ([^:]+)`)
-
-					// 使用正则表达式提取信息
-					onlinePlayerMatches := onlinePlayerRegexp.FindStringSubmatch(response)
-					playerListMatches := playerListRegexp.FindStringSubmatch(response)
-
-					// 检查是否匹配成功
-					if onlinePlayerMatches != nil {
-						// 提取online_player和max_player
-						onlinePlayer, _ := strconv.Atoi(onlinePlayerMatches[1])
-						maxPlayer, _ := strconv.Atoi(onlinePlayerMatches[2])
-
-						var playerList string
-						if playerListMatches != nil {
-							playerList = playerListMatches[1]
-						}
-
-						// 创建一个结构体来保存数据
-						type PlayerData struct {
-							OnlinePlayer int      `json:"online_player"`
-							MaxPlayer    int      `json:"max_player"`
-							PlayerList   []string `json:"player_list"`
-						}
-
-						// 将玩家名字字符串分割成列表
-						playerNames := regexp.MustCompile(`, `).Split(playerList, -1)
-
-						// 实例化结构体并填充数据
-						data := PlayerData{
-							OnlinePlayer: onlinePlayer,
-							MaxPlayer:    maxPlayer,
-							PlayerList:   playerNames,
-						}
-
-						// 将结构体格式化为JSON
-						jsonData, err := json.MarshalIndent(data, "", "  ")
-						if err != nil {
-							log.Println("[ERROR] Error marshalling JSON:", err)
-						}
-
-						callback("{\"type\": " + strconv.Itoa(DataType_data_list) + ", \"data\": " + string(jsonData) + "}")
-					} else {
-						log.Println("[ERROR] Could not extract the required information.")
-						isRunning = false
-						callback("{\"type\": " + strconv.Itoa(DataType_execution_error) + "}")
-						break
-					}
-				case "tps":
-					re := regexp.MustCompile(`§[a-zA-Z](\d+\.\d+|\d+)`)
-					matches := re.FindAllStringSubmatch(response, -1)
-					var numbers []string
-					if len(matches) != 3 {
-						isRunning = false
-						callback("{\"type\": " + strconv.Itoa(DataType_execution_error) + "}")
-						break
-					}
-					for _, match := range matches {
-						if len(match) > 1 {
-							numbers = append(numbers, match[1])
-						}
-					}
-					callback(`{
-					"type": ` + strconv.Itoa(DataType_data_tps) + `,
-					"data": {
-						"l1m": ` + numbers[0] + `,
-						"l5m": ` + numbers[1] + `,
-						"l15m": ` + numbers[2] + `
-					}
-				}`)
-				}
+				runCollectors(server.ID, conn, detected, bus)
 			}
+			conn.Close()
+			log.Println("[INFO] [" + server.ID + "] RCON server has disconnected.")
 		}
-	})
 
-	for {
-		isRunning = true
-		log.Println("[INFO] Connecting to RCON server " + GlobalConfig.Rcon.Host + ":" + strconv.Itoa(GlobalConfig.Rcon.Port) + "...")
+		log.Println("[INFO] [" + server.ID + "] Trying to reconnect in " + reconnectDelay.String() + "...")
+		time.Sleep(reconnectDelay)
+	}
+}
 
-		var err error
-		conn, err = NewConnection(GlobalConfig.Rcon.Host+":"+strconv.Itoa(GlobalConfig.Rcon.Port), GlobalConfig.Rcon.Password)
-		if err != nil {
-			callback("{\"type\": " + strconv.Itoa(DataType_connection_error) + ", \"data\": \"Error connecting to RCON server: " + err.Error() + "\"}")
-			isRunning = false
+// negotiate 识别服务端类型并发布到 bus，再据此确定本次连接运行的采集器
+//
+// 服务端可能在重连之间更换或升级，因此每次连接后都重新识别
+func negotiate(server config.ServerConfig, conn *Connection, bus *event.Bus) ([]collector.Collector, error) {
+	info, err := software.Detect(conn.executor())
+	if err != nil {
+		return nil, err
+	}
+	log.Println("[INFO] [" + server.ID + "] Detected server software: " + info.Family + " " + info.Version)
+	bus.PublishTransition(server.ID, info)
+
+	collectors, err := collector.Lookup(expandCollectors(server.Rcon.Collectors, info.Collectors()))
+	if err != nil {
+		return nil, err
+	}
+	if collectors, err = detectCollectors(server.ID, conn, collectors); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(collectors))
+	for _, c := range collectors {
+		names = append(names, c.Name())
+	}
+	unsupported := info.Unsupported()
+	if unsupported != "" {
+		log.Println("[INFO] [" + server.ID + "] " + unsupported)
+	}
+	bus.PublishTransition(server.ID, event.CollectorsSelected{Collectors: names, Unsupported: unsupported})
+	return collectors, nil
+}
+
+// expandCollectors 把配置中的 auto 替换为 detected，并去掉重复的采集器
+func expandCollectors(names, detected []string) []string {
+	seen := map[string]bool{}
+	expanded := make([]string, 0, len(names)+len(detected))
+	for _, name := range names {
+		candidates := []string{name}
+		if name == autoCollectors {
+			candidates = detected
+		}
+		for _, candidate := range candidates {
+			if !seen[candidate] {
+				seen[candidate] = true
+				expanded = append(expanded, candidate)
+			}
 		}
+	}
+	return expanded
+}
+
+// executor 返回以 commandTimeout 为超时执行单条命令的函数，供探测服务端类型使用
+func (c *Connection) executor() func(command string) (string, error) {
+	return func(command string) (string, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+		defer cancel()
+		return c.SendCommand(ctx, command)
+	}
+}
 
-		if isRunning {
-			callback("{\"type\": " + strconv.Itoa(DataType_connection_success) + "}")
-			Cron.Start()
+// detectCollectors 为需要按服务端类型选择实现的采集器执行探测
+func detectCollectors(serverID string, conn *Connection, collectors []collector.Collector) ([]collector.Collector, error) {
+	execute := conn.executor()
+
+	detected := make([]collector.Collector, 0, len(collectors))
+	for _, c := range collectors {
+		d, err := collector.Detect(c, execute)
+		if err != nil {
+			return nil, err
 		}
+		if d.Name() != c.Name() {
+			log.Println("[INFO] [" + serverID + "] Collector " + c.Name() + " detected as " + d.Name())
+		}
+		detected = append(detected, d)
+	}
+	return detected, nil
+}
 
-		for isRunning {
-			time.Sleep(10 * time.Nanosecond)
+// runCollectors 按各采集器的周期调度采集，直到某条命令执行失败（连接失效）后返回
+func runCollectors(serverID string, conn *Connection, collectors []collector.Collector, bus *event.Bus) {
+	scheduler := cron.New()
+	broken := make(chan struct{})
+	var once sync.Once
+	for _, c := range collectors {
+		c := c
+		scheduler.AddFunc("@every "+c.Interval().String(), func() {
+			if !runCollector(serverID, conn, c, bus) {
+				once.Do(func() { close(broken) })
+			}
+		})
+	}
+
+	scheduler.Start()
+	<-broken
+	<-scheduler.Stop().Done()
+}
+
+const (
+	packetTypeResponse     int32 = 0
+	packetTypeCommand      int32 = 2
+	packetTypeAuthResponse int32 = 2
+	packetTypeAuth         int32 = 3
+)
+
+// 单个数据包的最小长度（ID + Type + 两个结尾空字节）与允许的最大长度
+// 服务端单包正文最多 4096 字节，这里留出余量以兼容不同实现
+const (
+	minPacketSize = 4 + 4 + 2
+	maxPacketSize = 64 * 1024
+)
+
+// runCollector 执行一次采集，命令执行失败时返回 false 表示连接已失效；输出无法解析时只发布错误
+func runCollector(serverID string, conn *Connection, c collector.Collector, bus *event.Bus) bool {
+	start := time.Now()
+	outputs := make([]string, 0, len(c.Commands()))
+	for _, command := range c.Commands() {
+		ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+		response, err := conn.SendCommand(ctx, command)
+		cancel()
+		if err != nil {
+			bus.PublishTransition(serverID, event.CollectorFailed{Collector: c.Name(), Reason: "Error executing command: " + err.Error()})
+			return false
 		}
+		outputs = append(outputs, response)
+	}
+	if elapsed := time.Since(start); elapsed > slowThreshold {
+		bus.PublishTransition(serverID, event.CollectorSlow{Collector: c.Name(), Duration: elapsed})
+	}
 
-		Cron.Stop()
+	samples, err := c.Parse(outputs)
+	if err != nil {
+		log.Println("[ERROR] [" + serverID + "] Collector " + c.Name() + " could not parse output: " + err.Error())
+		bus.PublishTransition(serverID, event.CollectorFailed{Collector: c.Name(), Reason: err.Error(), ParseError: true})
+		return true
+	}
 
-		log.Println("[INFO] RCON server has disconnected. Trying to reconnect in 1 seconds...")
-		time.Sleep(3 * time.Second)
+	for _, sample := range samples {
+		bus.Publish(serverID, sample)
 	}
+	return true
 }
 
-var uniqueID int32 = 0
-
 func NewConnection(addr, pass string) (*Connection, error) {
-	uniqueID++
-	conn, err := net.Dial("tcp", addr)
+	return NewConnectionContext(context.Background(), addr, pass)
+}
+
+// NewConnectionContext 建立连接并完成认证，ctx 同时约束拨号与认证过程
+func NewConnectionContext(ctx context.Context, addr, pass string) (*Connection, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
 	if err != nil {
 		return nil, err
 	}
-	c := &Connection{conn: conn, pass: pass, addr: addr}
-	if err := c.auth(); err != nil {
+	c := &Connection{sem: make(chan struct{}, 1), conn: conn, rd: bufio.NewReader(conn), pass: pass, addr: addr}
+
+	c.sem <- struct{}{}
+	defer c.release()
+	if err := c.withContext(ctx, c.auth); err != nil {
+		conn.Close()
 		return nil, err
 	}
 	return c, nil
 }
 
-func (c *Connection) SendCommand(cmd string) (string, error) {
-	err := c.sendCommand(2, []byte(cmd))
+// Close 等待正在执行的命令结束后关闭连接，之后排队的命令会返回 ErrConnectionClosed
+func (c *Connection) Close() error {
+	c.sem <- struct{}{}
+	defer c.release()
+	if c.err != nil {
+		return nil
+	}
+	c.err = ErrConnectionClosed
+	return c.conn.Close()
+}
+
+// acquire 等待取得线路，ctx 先结束时返回 ctx.Err()
+func (c *Connection) acquire(ctx context.Context) error {
+	select {
+	case c.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Connection) release() {
+	<-c.sem
+}
+
+// withContext 在 ctx 的约束下执行 fn
+//
+// ctx 的截止时间会被设置为连接的读写期限，ctx 被取消时立即让阻塞的读写返回。
+// 一旦 fn 出错，线路上可能残留半个数据包，此时连接不再可用，会被关闭并记录错误
+func (c *Connection) withContext(ctx context.Context, fn func() error) error {
+	if c.err != nil {
+		return c.err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	deadline, _ := ctx.Deadline()
+	c.conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() {
+		c.conn.SetDeadline(time.Unix(1, 0))
+	})
+
+	err := fn()
+	if !stop() && ctx.Err() != nil {
+		err = ctx.Err()
+	}
 	if err != nil {
+		c.err = fmt.Errorf("rcon: connection broken: %w", err)
+		c.conn.Close()
+	}
+	return err
+}
+
+// SendCommand 执行命令并返回完整的响应正文
+//
+// 服务端会把较长的输出拆分为多个数据包，且无法从单个包得知是否已结束，
+// 因此在收到命令的第一个回应包后再发送一个空的 RESPONSE_VALUE 包作为哨兵：服务端按顺序处理请求，
+// 收到哨兵的回应时说明命令的所有分包都已到达
+//
+// 并发调用是安全的，命令依次执行；ctx 超时或取消时返回 ctx.Err()。
+// 还在排队时连接不受影响，已在执行时线路上可能残留半个回应，该连接随之失效，调用方应重新建立连接
+func (c *Connection) SendCommand(ctx context.Context, cmd string) (string, error) {
+	if err := c.acquire(ctx); err != nil {
 		return "", err
 	}
-	pkg, err := c.readPkg()
+	defer c.release()
+
+	var response string
+	err := c.withContext(ctx, func() error {
+		var err error
+		response, err = c.execute(cmd)
+		return err
+	})
+	return response, err
+}
+
+// execute 发送命令并读取全部回应包
+//
+// 原版服务端每次 read 只处理一个数据包，读到的字节数与包头的 Size 不符时会断开连接，
+// 因此哨兵不能与命令紧接着写出（可能在 TCP 中合并为一次读取），而是等到命令的第一个回应包到达后再发送
+func (c *Connection) execute(cmd string) (string, error) {
+	id, err := c.sendCommand(packetTypeCommand, []byte(cmd))
 	if err != nil {
 		return "", err
 	}
-	return string(pkg.Body), err
+
+	var body bytes.Buffer
+	var sentinel int32
+	sent := false
+	for {
+		pkg, err := c.readPkg()
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case pkg.ID == id:
+			body.Write(pkg.Body)
+			if !sent {
+				if sentinel, err = c.sendCommand(packetTypeResponse, nil); err != nil {
+					return "", err
+				}
+				sent = true
+			}
+		case sent && pkg.ID == sentinel:
+			return body.String(), nil
+		}
+		// 其余 ID 的包（例如 Source 服务端对哨兵追加的第二个回应）直接丢弃
+	}
 }
 
 func (c *Connection) auth() error {
-	c.sendCommand(3, []byte(c.pass))
-	pkg, err := c.readPkg()
+	id, err := c.sendCommand(packetTypeAuth, []byte(c.pass))
 	if err != nil {
 		return err
 	}
 
-	if pkg.Type != 2 || pkg.ID != uniqueID {
-		return errors.New("incorrect password")
-	}
+	for {
+		pkg, err := c.readPkg()
+		if err != nil {
+			return err
+		}
 
-	return nil
+		// 部分服务端会在认证结果之前先回一个空的 RESPONSE_VALUE 包
+		if pkg.Type != packetTypeAuthResponse {
+			continue
+		}
+		if pkg.ID != id {
+			return ErrAuthFailed
+		}
+		return nil
+	}
 }
 
-func (c *Connection) sendCommand(typ int32, body []byte) error {
+func (c *Connection) sendCommand(typ int32, body []byte) (int32, error) {
 	size := int32(4 + 4 + len(body) + 2)
-	uniqueID += 1
-	id := uniqueID
+	// 服务端用 -1 表示认证失败，因此 ID 只在正数范围内循环
+	if c.nextID == math.MaxInt32 {
+		c.nextID = 0
+	}
+	c.nextID++
+	id := c.nextID
 
 	wtr := binaryReadWriter{ByteOrder: binary.LittleEndian}
 	wtr.Write(size)
@@ -206,35 +396,39 @@ func (c *Connection) sendCommand(typ int32, body []byte) error {
 	wtr.Write(body)
 	wtr.Write([]byte{0x0, 0x0})
 	if wtr.err != nil {
-		return wtr.err
+		return 0, wtr.err
 	}
 
-	c.conn.Write(wtr.buf.Bytes())
-	return nil
+	if _, err := c.conn.Write(wtr.buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return id, nil
 }
 
+// readPkg 按照包头的 Size 字段读取一个完整的数据包，TCP 分段到达时会持续读取直到凑齐
 func (c *Connection) readPkg() (pkg, error) {
-	const bufSize = 4096
-	b := make([]byte, bufSize)
+	p := pkg{}
+	if err := binary.Read(c.rd, binary.LittleEndian, &p.Size); err != nil {
+		return p, err
+	}
+	if p.Size < minPacketSize || p.Size > maxPacketSize {
+		return p, fmt.Errorf("invalid packet size %d", p.Size)
+	}
 
-	// Doesn't handle split messages correctly.
-	read, err := c.conn.Read(b)
-	if err != nil {
-		return pkg{}, err
+	b := make([]byte, p.Size)
+	if _, err := io.ReadFull(c.rd, b); err != nil {
+		return p, err
 	}
 
-	p := pkg{}
 	rdr := binaryReadWriter{ByteOrder: binary.LittleEndian,
 		buf: bytes.NewBuffer(b)}
-	rdr.Read(&p.Size)
 	rdr.Read(&p.ID)
 	rdr.Read(&p.Type)
-	body := [bufSize - 12]byte{}
-	rdr.Read(&body)
 	if rdr.err != nil {
 		return p, rdr.err
 	}
-	p.Body = body[:read-14]
+	// 去掉正文结尾和包结尾的两个空字节
+	p.Body = b[8 : len(b)-2]
 	return p, nil
 }
 
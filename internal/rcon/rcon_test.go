@@ -0,0 +1,279 @@
+package rcon
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeServer 是进程内的 RCON 服务端，读取方式与原版一致：每次 read 处理一个数据包，
+// 读到的字节数与包头的 Size 不符时断开连接
+type fakeServer struct {
+	ln       net.Listener
+	password string
+	// respond 返回命令的回应正文，每个元素为一个数据包
+	respond func(cmd string) []string
+	// readDelay 为每次读取前的等待时间，客户端连续写出的数据包会在此期间合并到同一次读取中
+	readDelay time.Duration
+	// split 表示逐字节写出回应，让包头与正文分段到达
+	split bool
+	// doubleSentinel 表示像 Source 服务端一样对 RESPONSE_VALUE 包追加第二个回应
+	doubleSentinel bool
+	errs           chan error
+}
+
+// newFakeServer 启动服务端，options 在开始接受连接前修改服务端的行为
+func newFakeServer(t *testing.T, respond func(cmd string) []string, options ...func(f *fakeServer)) *fakeServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeServer{ln: ln, password: "password", respond: respond, errs: make(chan error, 16)}
+	for _, option := range options {
+		option(f)
+	}
+	t.Cleanup(func() {
+		ln.Close()
+		select {
+		case err := <-f.errs:
+			t.Errorf("fake server: %v", err)
+		default:
+		}
+	})
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeServer) addr() string {
+	return f.ln.Addr().String()
+}
+
+func (f *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+	buf := make([]byte, 1460)
+	for {
+		time.Sleep(f.readDelay)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return
+		}
+		if n < 4+minPacketSize {
+			f.errs <- fmt.Errorf("short read of %d bytes", n)
+			return
+		}
+		size := int(binary.LittleEndian.Uint32(buf))
+		if size != n-4 {
+			f.errs <- fmt.Errorf("read %d bytes for a packet of size %d", n, size)
+			return
+		}
+		id := int32(binary.LittleEndian.Uint32(buf[4:]))
+		typ := int32(binary.LittleEndian.Uint32(buf[8:]))
+		body := string(buf[12 : n-2])
+
+		switch typ {
+		case packetTypeAuth:
+			if body != f.password {
+				id = -1
+			}
+			f.write(conn, id, packetTypeAuthResponse, "")
+		case packetTypeCommand:
+			for _, chunk := range f.respond(body) {
+				f.write(conn, id, packetTypeResponse, chunk)
+			}
+		default:
+			f.write(conn, id, packetTypeResponse, "Unknown request "+strconv.FormatInt(int64(typ), 16))
+			if f.doubleSentinel {
+				f.write(conn, id, packetTypeResponse, "\x00\x00\x00\x01\x00\x00\x00\x00")
+			}
+		}
+	}
+}
+
+func (f *fakeServer) write(conn net.Conn, id, typ int32, body string) {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, int32(4+4+len(body)+2))
+	binary.Write(&b, binary.LittleEndian, id)
+	binary.Write(&b, binary.LittleEndian, typ)
+	b.WriteString(body)
+	b.Write([]byte{0, 0})
+	if !f.split {
+		conn.Write(b.Bytes())
+		return
+	}
+	for _, c := range b.Bytes() {
+		conn.Write([]byte{c})
+	}
+}
+
+func connect(t *testing.T, f *fakeServer) *Connection {
+	t.Helper()
+	conn, err := NewConnection(f.addr(), f.password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func send(t *testing.T, conn *Connection, cmd string) string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	response, err := conn.SendCommand(ctx, cmd)
+	if err != nil {
+		t.Fatalf("SendCommand(%q): %v", cmd, err)
+	}
+	return response
+}
+
+func TestSendCommand(t *testing.T) {
+	f := newFakeServer(t, func(cmd string) []string {
+		return []string{"There are 1 of a max of 20 players online: Steve"}
+	})
+	conn := connect(t, f)
+	if got := send(t, conn, "list"); got != "There are 1 of a max of 20 players online: Steve" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestMultiPacketResponse(t *testing.T) {
+	chunks := []string{strings.Repeat("a", 4096), strings.Repeat("b", 4096), "tail"}
+	f := newFakeServer(t, func(cmd string) []string { return chunks })
+	conn := connect(t, f)
+	if got := send(t, conn, "help"); got != strings.Join(chunks, "") {
+		t.Errorf("got %d bytes, want %d", len(got), len(strings.Join(chunks, "")))
+	}
+}
+
+func TestSplitWrites(t *testing.T) {
+	f := newFakeServer(t, func(cmd string) []string { return []string{"first ", "second"} }, func(f *fakeServer) {
+		f.split = true
+	})
+	conn := connect(t, f)
+	for i := 0; i < 3; i++ {
+		if got := send(t, conn, "tps"); got != "first second" {
+			t.Errorf("got %q", got)
+		}
+	}
+}
+
+// TestSentinelNotCoalesced 中服务端读取较慢，客户端若把命令与哨兵连续写出，两个包会落在同一次读取中被服务端拒绝
+func TestSentinelNotCoalesced(t *testing.T) {
+	f := newFakeServer(t, func(cmd string) []string { return []string{"ok"} }, func(f *fakeServer) {
+		f.readDelay = 50 * time.Millisecond
+	})
+	conn := connect(t, f)
+	for i := 0; i < 3; i++ {
+		if got := send(t, conn, "list"); got != "ok" {
+			t.Errorf("got %q", got)
+		}
+	}
+}
+
+func TestEmptyResponse(t *testing.T) {
+	f := newFakeServer(t, func(cmd string) []string { return []string{""} })
+	conn := connect(t, f)
+	if got := send(t, conn, "save-all"); got != "" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestDoubleSentinelDiscarded(t *testing.T) {
+	f := newFakeServer(t, func(cmd string) []string { return []string{"echo " + cmd} }, func(f *fakeServer) {
+		f.doubleSentinel = true
+	})
+	conn := connect(t, f)
+	for _, cmd := range []string{"one", "two", "three"} {
+		if got := send(t, conn, cmd); got != "echo "+cmd {
+			t.Errorf("got %q, want %q", got, "echo "+cmd)
+		}
+	}
+}
+
+func TestAuthFailed(t *testing.T) {
+	f := newFakeServer(t, nil)
+	_, err := NewConnection(f.addr(), "wrong")
+	if !errors.Is(err, ErrAuthFailed) {
+		t.Fatalf("got %v, want ErrAuthFailed", err)
+	}
+}
+
+func TestInvalidPacketSize(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Read(make([]byte, 1460))
+		conn.Write([]byte{0xff, 0xff, 0xff, 0x7f})
+		conn.Read(make([]byte, 1))
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := NewConnectionContext(ctx, ln.Addr().String(), "password"); err == nil || !strings.Contains(err.Error(), "invalid packet size") {
+		t.Fatalf("got %v, want invalid packet size", err)
+	}
+}
+
+// TestQueuedCommandTimeout 中排队的命令应在自身超时后返回，且不影响正在执行的命令与之后的命令
+func TestQueuedCommandTimeout(t *testing.T) {
+	f := newFakeServer(t, func(cmd string) []string {
+		if cmd == "slow" {
+			time.Sleep(300 * time.Millisecond)
+		}
+		return []string{"done " + cmd}
+	})
+	conn := connect(t, f)
+
+	slow := make(chan string)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		response, err := conn.SendCommand(ctx, "slow")
+		if err != nil {
+			response = err.Error()
+		}
+		slow <- response
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := conn.SendCommand(ctx, "queued"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Errorf("queued command returned after %s", elapsed)
+	}
+
+	if got := <-slow; got != "done slow" {
+		t.Errorf("slow command got %q", got)
+	}
+	if got := send(t, conn, "after"); got != "done after" {
+		t.Errorf("got %q", got)
+	}
+}
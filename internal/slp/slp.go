@@ -0,0 +1,189 @@
+package slp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/MeowLynxSea/Uptimeow/config"
+	"github.com/MeowLynxSea/Uptimeow/internal/event"
+	"github.com/Tnze/go-mc/chat"
+	mcnet "github.com/Tnze/go-mc/net"
+	pk "github.com/Tnze/go-mc/net/packet"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Status 是一次 Server List Ping 的结果
+type Status struct {
+	Version      string
+	Protocol     int
+	Motd         string
+	OnlinePlayer int
+	MaxPlayer    int
+	PlayerSample []string
+	Latency      time.Duration
+}
+
+// response 对应状态响应中的 JSON，见 https://wiki.vg/Server_List_Ping#Status_Response
+type response struct {
+	Version struct {
+		Name     string `json:"name"`
+		Protocol int    `json:"protocol"`
+	} `json:"version"`
+	Players struct {
+		Max    int `json:"max"`
+		Online int `json:"online"`
+		Sample []struct {
+			Name string `json:"name"`
+			ID   string `json:"id"`
+		} `json:"sample"`
+	} `json:"players"`
+	Description chat.Message `json:"description"`
+}
+
+const (
+	packetIDHandshake = 0x00
+	packetIDStatus    = 0x00
+	packetIDPing      = 0x01
+
+	// 握手时声明的协议版本，-1 表示仅用于查询状态
+	pingProtocolVersion = -1
+	nextStateStatus     = 1
+
+	defaultPort = 25565
+)
+
+// InitSLP 按 server 配置的周期对服务器进行 Server List Ping，结果发布到 bus
+//
+// 成功时发布 Status，失败时发布 event.ProbeFailed
+func InitSLP(server config.ServerConfig, bus *event.Bus) {
+	probe := server.SLP
+	addr := probe.Address
+	log.Println("[INFO] [" + server.ID + "] Starting Server List Ping probe for " + addr + "...")
+
+	ticker := time.NewTicker(probe.Interval)
+	defer ticker.Stop()
+	for ; ; <-ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), probe.Timeout)
+		status, err := Ping(ctx, addr)
+		cancel()
+		if err != nil {
+			bus.Publish(server.ID, event.ProbeFailed{Probe: "slp", Reason: err.Error()})
+			continue
+		}
+		bus.Publish(server.ID, status)
+	}
+}
+
+// Ping 向 addr 发起一次 Java 版 Server List Ping
+//
+// addr 未指定端口时会像客户端一样查询 SRV 记录，默认端口为 25565。
+// Latency 为 ping/pong 的往返时间，不包含建立连接和状态查询的耗时
+func Ping(ctx context.Context, addr string) (Status, error) {
+	host, port, err := splitHostPort(addr)
+	if err != nil {
+		return Status{}, err
+	}
+	conn, err := mcnet.DefaultDialer.DialMCContext(ctx, addr)
+	if err != nil {
+		return Status{}, err
+	}
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	conn.Socket.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() {
+		conn.Socket.SetDeadline(time.Unix(1, 0))
+	})
+	defer stop()
+
+	status, err := ping(conn, host, port)
+	if err != nil && (ctx.Err() != nil || errors.Is(err, os.ErrDeadlineExceeded)) {
+		// 套接字的截止时间与 ctx 相同，可能先于 ctx 到期，此时 ctx 也即将结束
+		<-ctx.Done()
+		return Status{}, ctx.Err()
+	}
+	return status, err
+}
+
+// ping 在已建立的连接上完成握手、状态查询和 ping/pong，host 与 port 为握手包中声明的地址
+func ping(conn *mcnet.Conn, host string, port uint16) (Status, error) {
+	err := conn.WritePacket(pk.Marshal(
+		packetIDHandshake,
+		pk.VarInt(pingProtocolVersion),
+		pk.String(host),
+		pk.UnsignedShort(port),
+		pk.VarInt(nextStateStatus),
+	))
+	if err != nil {
+		return Status{}, fmt.Errorf("slp: send handshake: %w", err)
+	}
+	if err = conn.WritePacket(pk.Marshal(packetIDStatus)); err != nil {
+		return Status{}, fmt.Errorf("slp: send status request: %w", err)
+	}
+
+	var p pk.Packet
+	if err = conn.ReadPacket(&p); err != nil {
+		return Status{}, fmt.Errorf("slp: read status response: %w", err)
+	}
+	var raw pk.String
+	if err = p.Scan(&raw); err != nil {
+		return Status{}, fmt.Errorf("slp: scan status response: %w", err)
+	}
+	var resp response
+	if err = json.Unmarshal([]byte(raw), &resp); err != nil {
+		return Status{}, fmt.Errorf("slp: decode status response: %w", err)
+	}
+
+	startTime := time.Now()
+	payload := pk.Long(startTime.UnixMilli())
+	if err = conn.WritePacket(pk.Marshal(packetIDPing, payload)); err != nil {
+		return Status{}, fmt.Errorf("slp: send ping: %w", err)
+	}
+	if err = conn.ReadPacket(&p); err != nil {
+		return Status{}, fmt.Errorf("slp: read pong: %w", err)
+	}
+	latency := time.Since(startTime)
+	var pong pk.Long
+	if err = p.Scan(&pong); err != nil {
+		return Status{}, fmt.Errorf("slp: scan pong: %w", err)
+	}
+	if pong != payload {
+		return Status{}, errors.New("slp: pong payload mismatch")
+	}
+
+	status := Status{
+		Version:      resp.Version.Name,
+		Protocol:     resp.Version.Protocol,
+		Motd:         resp.Description.ClearString(),
+		OnlinePlayer: resp.Players.Online,
+		MaxPlayer:    resp.Players.Max,
+		PlayerSample: []string{},
+		Latency:      latency,
+	}
+	for _, player := range resp.Players.Sample {
+		status.PlayerSample = append(status.PlayerSample, player.Name)
+	}
+	return status, nil
+}
+
+// splitHostPort 拆分地址，未指定端口时使用默认端口
+func splitHostPort(addr string) (string, uint16, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		var addrErr *net.AddrError
+		if errors.As(err, &addrErr) && addrErr.Err == "missing port in address" {
+			return addr, defaultPort, nil
+		}
+		return "", 0, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return "", 0, err
+	}
+	return host, uint16(port), nil
+}
@@ -0,0 +1,194 @@
+package slp
+
+import (
+	"context"
+	"encoding/json"
+	mcnet "github.com/Tnze/go-mc/net"
+	pk "github.com/Tnze/go-mc/net/packet"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// statusJSON 是 Paper 服务端返回的状态，MOTD 同时使用了 § 格式代码与 extra
+const statusJSON = `{"version":{"name":"Paper 1.21.4","protocol":769},` +
+	`"players":{"max":20,"online":2,"sample":[{"name":"Steve","id":"8667ba71-b85a-4004-af54-457a9734eed7"},{"name":"Alex","id":"ec561538-f3fd-461d-aff5-086b22154bce"}]},` +
+	`"description":{"text":"§aA Minecraft ","extra":[{"text":"Server","bold":true}]}}`
+
+// fakeServer 在本地监听并用 handle 处理每个连接，返回监听地址
+func fakeServer(t *testing.T, handle func(conn net.Conn)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handle(conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// serveStatus 像原版服务端一样完成握手、状态查询与 ping/pong，write 用于写出每个响应包
+func serveStatus(t *testing.T, status string, write func(conn net.Conn, data []byte)) func(conn net.Conn) {
+	return func(conn net.Conn) {
+		c := mcnet.WrapConn(conn)
+		var p pk.Packet
+		var protocol, nextState pk.VarInt
+		var host pk.String
+		var port pk.UnsignedShort
+		if err := c.ReadPacket(&p); err != nil || p.Scan(&protocol, &host, &port, &nextState) != nil || nextState != nextStateStatus {
+			t.Errorf("bad handshake: %v", err)
+			return
+		}
+		if err := c.ReadPacket(&p); err != nil || p.ID != packetIDStatus {
+			t.Errorf("bad status request: %v", err)
+			return
+		}
+		write(conn, encode(pk.Marshal(packetIDStatus, pk.String(status))))
+
+		var payload pk.Long
+		if err := c.ReadPacket(&p); err != nil || p.ID != packetIDPing || p.Scan(&payload) != nil {
+			t.Errorf("bad ping: %v", err)
+			return
+		}
+		write(conn, encode(pk.Marshal(packetIDPing, payload)))
+	}
+}
+
+// encode 返回带长度前缀的未压缩数据包
+func encode(p pk.Packet) []byte {
+	var b strings.Builder
+	p.Pack(&b, -1)
+	return []byte(b.String())
+}
+
+func writeAll(conn net.Conn, data []byte) {
+	conn.Write(data)
+}
+
+// writeSplit 把数据包拆成多次写出，长度前缀、包 ID 与 JSON 分段到达
+func writeSplit(conn net.Conn, data []byte) {
+	writeChunks(7)(conn, data)
+}
+
+func writeChunks(size int) func(conn net.Conn, data []byte) {
+	return func(conn net.Conn, data []byte) {
+		for len(data) > 0 {
+			n := min(len(data), size)
+			conn.Write(data[:n])
+			data = data[n:]
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+func pingAddr(t *testing.T, addr string) (Status, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return Ping(ctx, addr)
+}
+
+func TestPing(t *testing.T) {
+	for name, write := range map[string]func(net.Conn, []byte){"single write": writeAll, "split writes": writeSplit} {
+		t.Run(name, func(t *testing.T) {
+			addr := fakeServer(t, serveStatus(t, statusJSON, write))
+			status, err := pingAddr(t, addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			status.Latency = 0
+			want := Status{
+				Version:      "Paper 1.21.4",
+				Protocol:     769,
+				Motd:         "A Minecraft Server",
+				OnlinePlayer: 2,
+				MaxPlayer:    20,
+				PlayerSample: []string{"Steve", "Alex"},
+			}
+			if !reflect.DeepEqual(status, want) {
+				t.Errorf("got %+v, want %+v", status, want)
+			}
+		})
+	}
+}
+
+func TestPingLargeStatus(t *testing.T) {
+	var resp response
+	if err := json.Unmarshal([]byte(statusJSON), &resp); err != nil {
+		t.Fatal(err)
+	}
+	// 带图标的状态通常有数十 KB，超过一次 TCP 读取的大小
+	status := strings.TrimSuffix(statusJSON, "}") + `,"favicon":"data:image/png;base64,` + strings.Repeat("A", 64*1024) + `"}`
+	addr := fakeServer(t, serveStatus(t, status, writeChunks(1000)))
+	got, err := pingAddr(t, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Version != resp.Version.Name || got.OnlinePlayer != resp.Players.Online {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestPingInvalidReply(t *testing.T) {
+	tests := map[string][]byte{
+		// 1.6 及以前的服务端对未知的握手回应踢出包 0xFF
+		"legacy kick":  append([]byte{0xff, 0x00, 0x1b}, []byte("\x00§\x001\x00\x00\x007\x008\x00\x00\x001\x00.\x006\x00.\x004\x00\x00")...),
+		"http":         []byte("HTTP/1.1 400 Bad Request\r\nContent-Length: 0\r\n\r\n"),
+		"invalid json": encode(pk.Marshal(packetIDStatus, pk.String(`{"version":`))),
+	}
+	for name, reply := range tests {
+		t.Run(name, func(t *testing.T) {
+			addr := fakeServer(t, func(conn net.Conn) {
+				conn.Read(make([]byte, 1024))
+				conn.Write(reply)
+			})
+			start := time.Now()
+			if _, err := pingAddr(t, addr); err == nil {
+				t.Fatal("expected an error")
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("returned after %s", elapsed)
+			}
+		})
+	}
+}
+
+func TestPingTimeout(t *testing.T) {
+	addr := fakeServer(t, func(conn net.Conn) {
+		conn.Read(make([]byte, 1024))
+		time.Sleep(time.Second)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := Ping(ctx, addr); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestPingPongMismatch(t *testing.T) {
+	addr := fakeServer(t, func(conn net.Conn) {
+		c := mcnet.WrapConn(conn)
+		var p pk.Packet
+		c.ReadPacket(&p)
+		c.ReadPacket(&p)
+		conn.Write(encode(pk.Marshal(packetIDStatus, pk.String(statusJSON))))
+		c.ReadPacket(&p)
+		conn.Write(encode(pk.Marshal(packetIDPing, pk.Long(42))))
+	})
+	if _, err := pingAddr(t, addr); err == nil || !strings.Contains(err.Error(), "pong payload mismatch") {
+		t.Fatalf("got %v, want pong payload mismatch", err)
+	}
+}
@@ -0,0 +1,135 @@
+package software
+
+import (
+	"github.com/MeowLynxSea/Uptimeow/internal/collector"
+	"regexp"
+	"strings"
+)
+
+// 可识别的服务端类型
+const (
+	Vanilla  = "Vanilla"
+	Bukkit   = "CraftBukkit"
+	Spigot   = "Spigot"
+	Paper    = "Paper"
+	Purpur   = "Purpur"
+	Folia    = "Folia"
+	Forge    = "Forge"
+	NeoForge = "NeoForge"
+	Fabric   = "Fabric"
+)
+
+// Info 是通过 RCON 识别出的服务端类型与版本，连接建立后发布一次
+type Info struct {
+	// Family 为服务端类型，Bukkit 系的其他分支（如 Pufferfish）保留其自报的名称
+	Family string
+	// Version 为 Minecraft 版本，无法获知时为空
+	Version string
+	// Build 为服务端自身的版本号，例如 Paper 的构建号
+	Build string
+}
+
+// Collectors 返回适用于该服务端的 TPS 相关采集器
+func (i Info) Collectors() []string {
+	switch i.Family {
+	case Paper, Purpur:
+		return []string{"tps", "mspt"}
+	case Forge:
+		return []string{"forge_tps"}
+	case NeoForge:
+		return []string{"neoforge_tps"}
+	case Fabric:
+		return []string{"spark_tps"}
+	case Vanilla:
+		// 原版没有 TPS 命令，只能推算
+		return []string{"vanilla_tps"}
+	case Folia:
+		// 见 Unsupported
+		return nil
+	default:
+		return []string{"tps"}
+	}
+}
+
+// Unsupported 返回无法采集该服务端 TPS 的原因，可以采集时返回空字符串
+//
+// Folia 的 tps 命令输出的是各区域当前的 TPS 与负载（"Server Health Report"），没有整体的 1、5、15 分钟平均值，
+// 也不支持原版的 tick query，因此不运行 TPS 相关的采集器，只采集玩家列表等
+func (i Info) Unsupported() string {
+	if i.Family == Folia {
+		return "Folia reports TPS per region only, overall TPS is not collected"
+	}
+	return ""
+}
+
+var (
+	// bukkitVersionRegexp 匹配 Bukkit 系服务端 version 命令的输出，例如
+	// "This server is running Paper version 1.21.4-232-ver/1.21.4@a1b2c3d (2025-03-01T00:00:00Z) (Implementing API version 1.21.4-R0.1-SNAPSHOT)"、
+	// "This server is running CraftBukkit version 4226-Spigot-146439e-2d5b3a8 (MC: 1.21.4) (Implementing API version ...)"
+	bukkitVersionRegexp = regexp.MustCompile(`running (\S+) version (\S+)(?:\s*\(MC: ([^)]+)\))?`)
+	// vanillaVersionRegexp 匹配 1.21.6 起原版 version 命令输出中的版本 ID
+	vanillaVersionRegexp = regexp.MustCompile(`id = (\d+\.\d+(?:\.\d+)?|\d{2}w\d{2}[a-z])`)
+	// mcVersionRegexp 匹配版本号开头的 Minecraft 版本
+	mcVersionRegexp = regexp.MustCompile(`^\d+\.\d+(?:\.\d+)?`)
+	colorCodeRegexp = regexp.MustCompile(`§[0-9a-zA-Z]`)
+)
+
+// fallbacks 是 version 命令无法识别时依次尝试的采集器及其对应的服务端
+//
+// 没有安装 spark 的 Fabric 服务端无法与原版区分，会被识别为原版
+var fallbacks = []struct {
+	collector string
+	family    string
+}{
+	{"neoforge_tps", NeoForge},
+	{"forge_tps", Forge},
+	{"spark_tps", Fabric},
+}
+
+// Detect 借助 execute 执行 version 等命令识别服务端，仅在命令执行失败时返回错误
+func Detect(execute func(command string) (string, error)) (Info, error) {
+	output, err := execute("version")
+	if err != nil {
+		return Info{}, err
+	}
+	output = colorCodeRegexp.ReplaceAllString(output, "")
+	if info, ok := parseBukkitVersion(output); ok {
+		return info, nil
+	}
+
+	info := Info{Family: Vanilla}
+	if match := vanillaVersionRegexp.FindStringSubmatch(output); match != nil {
+		info.Version = match[1]
+	}
+	for _, fallback := range fallbacks {
+		c, ok := collector.Get(fallback.collector)
+		if !ok {
+			continue
+		}
+		output, err := execute(c.Commands()[0])
+		if err != nil {
+			return Info{}, err
+		}
+		if _, err := c.Parse([]string{output}); err == nil {
+			info.Family = fallback.family
+			return info, nil
+		}
+	}
+	return info, nil
+}
+
+// parseBukkitVersion 解析 Bukkit 系服务端的 version 输出
+func parseBukkitVersion(output string) (Info, bool) {
+	match := bukkitVersionRegexp.FindStringSubmatch(output)
+	if match == nil {
+		return Info{}, false
+	}
+	info := Info{Family: match[1], Version: match[3], Build: match[2]}
+	if info.Family == Bukkit && strings.Contains(info.Build, "Spigot") {
+		info.Family = Spigot
+	}
+	if info.Version == "" {
+		info.Version = mcVersionRegexp.FindString(info.Build)
+	}
+	return info, true
+}
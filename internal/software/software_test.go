@@ -0,0 +1,118 @@
+package software
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDetectBukkit(t *testing.T) {
+	tests := []struct {
+		output      string
+		family      string
+		version     string
+		collectors  []string
+		unsupported bool
+	}{
+		{"§fThis server is running Paper version 1.21.4-232-ver/1.21.4@a1b2c3d (2025-03-01T00:00:00Z) (Implementing API version 1.21.4-R0.1-SNAPSHOT)", Paper, "1.21.4", []string{"tps", "mspt"}, false},
+		{"This server is running CraftBukkit version 4226-Spigot-146439e-2d5b3a8 (MC: 1.21.4) (Implementing API version 1.21.4-R0.1-SNAPSHOT)", Spigot, "1.21.4", []string{"tps"}, false},
+		{"This server is running Folia version 1.21.4-6-ver/1.21.4@0a1b2c3 (2025-02-20T00:00:00Z) (Implementing API version 1.21.4-R0.1-SNAPSHOT)", Folia, "1.21.4", nil, true},
+	}
+	for _, test := range tests {
+		info, err := Detect(func(command string) (string, error) { return test.output, nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Family != test.family || info.Version != test.version {
+			t.Errorf("%q: got %s %s, want %s %s", test.output, info.Family, info.Version, test.family, test.version)
+		}
+		if got := info.Collectors(); !reflect.DeepEqual(got, test.collectors) {
+			t.Errorf("%s: got collectors %v, want %v", info.Family, got, test.collectors)
+		}
+		if got := info.Unsupported() != ""; got != test.unsupported {
+			t.Errorf("%s: got unsupported %q", info.Family, info.Unsupported())
+		}
+	}
+}
+
+// TestDetectFallback 检查 version 无法识别时依次尝试 neoforge_tps、forge_tps 与 spark_tps，都失败时识别为原版
+func TestDetectFallback(t *testing.T) {
+	const unknown = "Unknown or incomplete command, see below for error"
+	vanillaVersion := "Server version info:\nid = 1.21.6\nname = 1.21.6\ndata = 4435\nseries = main\nprotocol = 771 (0x303)\nstable = yes"
+	tests := []struct {
+		name    string
+		outputs map[string]string
+		family  string
+		version string
+		// commands 为依次执行的命令
+		commands []string
+	}{
+		{
+			"neoforge",
+			map[string]string{"neoforge tps": "minecraft:overworld: 20.000 TPS (1.523 ms/tick)Overall: 20.000 TPS (1.523 ms/tick)"},
+			NeoForge, "",
+			[]string{"version", "neoforge tps"},
+		},
+		{
+			"forge",
+			map[string]string{"forge tps": "Dim minecraft:overworld (minecraft:overworld): Mean tick time: 1.523 ms. Mean TPS: 20.000Overall: Mean tick time: 1.523 ms. Mean TPS: 20.000"},
+			Forge, "",
+			[]string{"version", "neoforge tps", "forge tps"},
+		},
+		{
+			"fabric with spark",
+			map[string]string{"version": vanillaVersion, "spark tps": "TPS from last 5s, 10s, 1m, 5m, 15m:\n ▶ *20.0, *20.0, *20.0, 20.0, 20.0"},
+			Fabric, "1.21.6",
+			[]string{"version", "neoforge tps", "forge tps", "spark tps"},
+		},
+		{
+			"vanilla",
+			map[string]string{"version": vanillaVersion},
+			Vanilla, "1.21.6",
+			[]string{"version", "neoforge tps", "forge tps", "spark tps"},
+		},
+		{
+			// 1.21.6 以前的原版没有 version 命令
+			"old vanilla",
+			nil,
+			Vanilla, "",
+			[]string{"version", "neoforge tps", "forge tps", "spark tps"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var commands []string
+			info, err := Detect(func(command string) (string, error) {
+				commands = append(commands, command)
+				if output, ok := test.outputs[command]; ok {
+					return output, nil
+				}
+				return unknown, nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Family != test.family || info.Version != test.version {
+				t.Errorf("got %s %s, want %s %s", info.Family, info.Version, test.family, test.version)
+			}
+			if !reflect.DeepEqual(commands, test.commands) {
+				t.Errorf("got commands %q, want %q", commands, test.commands)
+			}
+		})
+	}
+}
+
+// TestDetectError 检查命令执行失败时返回错误，不再尝试后面的采集器
+func TestDetectError(t *testing.T) {
+	var commands []string
+	_, err := Detect(func(command string) (string, error) {
+		commands = append(commands, command)
+		if command == "forge tps" {
+			return "", errors.New("connection reset")
+		}
+		return "Unknown or incomplete command, see below for error", nil
+	})
+	if err == nil || len(commands) != 3 {
+		t.Errorf("got %v after %q, want an error after forge tps", err, commands)
+	}
+}
@@ -14,8 +14,11 @@ var GlobalConfig config.ConfigData
 
 func main() {
 	GlobalConfig = config.Load()
+	api.Start()
 
 	http.HandleFunc("/ws", api.WebSocketHandler)
+	http.HandleFunc("/api/v1/leaderboards", api.LeaderboardsHandler)
+	http.HandleFunc("/api/admin/", api.AdminHandler)
 	http.HandleFunc("/api/", api.APIHandler)
 	http.HandleFunc("/", web.IndexHandler)
 